@@ -37,10 +37,10 @@ var jsonFile *regexp.Regexp
 var yamlFile *regexp.Regexp
 var mdFile *regexp.Regexp
 
-//go:embed opentsg-core/canvaswidget/jsonschema/baseschema.json opentsg-core/config/core/jsonschema/includeschema.json opentsg-core/config/core/jsonschema/widgetEssentials.json opentsg-core/gridgen/jsonschema/tsigschema.json opentsg-widgets/addimage/jsonschema/addimageschema.json opentsg-widgets/bowtie/jsonschema/jsonschema.json opentsg-widgets/ebu3373/bars/jsonschema/barschema.json opentsg-widgets/ebu3373/luma/jsonschema/lumaschema.json opentsg-widgets/ebu3373/nearblack/jsonschema/nbschema.json opentsg-widgets/ebu3373/saturation/jsonschema/satschema.json opentsg-widgets/ebu3373/twosi/jsonschema/twoschema.json opentsg-widgets/fourcolour/jsonschema/fourColourSchema.json opentsg-widgets/framecount/jsonschema/framecounter.json opentsg-widgets/geometryText/jsonschema/geometryText.json opentsg-widgets/gradients/jsonschema/gradientSchema.json opentsg-widgets/jsonschema/framecounter.json opentsg-widgets/jsonschema/gridschema.json opentsg-widgets/noise/jsonschema/noiseschema.json opentsg-widgets/qrgen/jsonschema/qrgenschema.json opentsg-widgets/resize/jsonschema/resize.json opentsg-widgets/textbox/jsonschema/textBoxSchema.json opentsg-widgets/zoneplate/jsonschema/zoneplateschema.json
+//go:embed opentsg-core/canvaswidget/jsonschema/baseschema.json opentsg-core/config/core/jsonschema/includeschema.json opentsg-core/config/core/jsonschema/widgetEssentials.json opentsg-core/gridgen/jsonschema/tsigschema.json opentsg-core/tsg/jsonschema/dpxoptions.json opentsg-core/tsg/jsonschema/exroptions.json opentsg-core/tsg/jsonschema/pngoptions.json opentsg-core/tsg/jsonschema/tiffoptions.json opentsg-widgets/addimage/jsonschema/addimageschema.json opentsg-widgets/bowtie/jsonschema/jsonschema.json opentsg-widgets/ebu3373/bars/jsonschema/barschema.json opentsg-widgets/ebu3373/luma/jsonschema/lumaschema.json opentsg-widgets/ebu3373/nearblack/jsonschema/nbschema.json opentsg-widgets/ebu3373/saturation/jsonschema/satschema.json opentsg-widgets/ebu3373/twosi/jsonschema/twoschema.json opentsg-widgets/fourcolour/jsonschema/fourColourSchema.json opentsg-widgets/framecount/jsonschema/framecounter.json opentsg-widgets/geometryText/jsonschema/geometryText.json opentsg-widgets/gradients/jsonschema/gradientSchema.json opentsg-widgets/jsonschema/framecounter.json opentsg-widgets/jsonschema/gridschema.json opentsg-widgets/noise/jsonschema/noiseschema.json opentsg-widgets/qrgen/jsonschema/qrgenschema.json opentsg-widgets/resize/jsonschema/resize.json opentsg-widgets/textbox/jsonschema/textBoxSchema.json opentsg-widgets/zoneplate/jsonschema/zoneplateschema.json
 var schemas embed.FS
 
-var schemaNames = []string{"opentsg-core/canvaswidget/jsonschema/baseschema.json", "opentsg-core/config/core/jsonschema/includeschema.json", "opentsg-core/config/core/jsonschema/widgetEssentials.json", "opentsg-core/gridgen/jsonschema/tsigschema.json", "opentsg-widgets/addimage/jsonschema/addimageschema.json", "opentsg-widgets/bowtie/jsonschema/jsonschema.json", "opentsg-widgets/ebu3373/bars/jsonschema/barschema.json", "opentsg-widgets/ebu3373/luma/jsonschema/lumaschema.json", "opentsg-widgets/ebu3373/nearblack/jsonschema/nbschema.json", "opentsg-widgets/ebu3373/saturation/jsonschema/satschema.json", "opentsg-widgets/ebu3373/twosi/jsonschema/twoschema.json", "opentsg-widgets/fourcolour/jsonschema/fourColourSchema.json", "opentsg-widgets/framecount/jsonschema/framecounter.json", "opentsg-widgets/geometryText/jsonschema/geometryText.json", "opentsg-widgets/gradients/jsonschema/gradientSchema.json", "opentsg-widgets/jsonschema/framecounter.json", "opentsg-widgets/jsonschema/gridschema.json", "opentsg-widgets/noise/jsonschema/noiseschema.json", "opentsg-widgets/qrgen/jsonschema/qrgenschema.json", "opentsg-widgets/resize/jsonschema/resize.json", "opentsg-widgets/textbox/jsonschema/textBoxSchema.json", "opentsg-widgets/zoneplate/jsonschema/zoneplateschema.json"}
+var schemaNames = []string{"opentsg-core/canvaswidget/jsonschema/baseschema.json", "opentsg-core/config/core/jsonschema/includeschema.json", "opentsg-core/config/core/jsonschema/widgetEssentials.json", "opentsg-core/gridgen/jsonschema/tsigschema.json", "opentsg-core/tsg/jsonschema/dpxoptions.json", "opentsg-core/tsg/jsonschema/exroptions.json", "opentsg-core/tsg/jsonschema/pngoptions.json", "opentsg-core/tsg/jsonschema/tiffoptions.json", "opentsg-widgets/addimage/jsonschema/addimageschema.json", "opentsg-widgets/bowtie/jsonschema/jsonschema.json", "opentsg-widgets/ebu3373/bars/jsonschema/barschema.json", "opentsg-widgets/ebu3373/luma/jsonschema/lumaschema.json", "opentsg-widgets/ebu3373/nearblack/jsonschema/nbschema.json", "opentsg-widgets/ebu3373/saturation/jsonschema/satschema.json", "opentsg-widgets/ebu3373/twosi/jsonschema/twoschema.json", "opentsg-widgets/fourcolour/jsonschema/fourColourSchema.json", "opentsg-widgets/framecount/jsonschema/framecounter.json", "opentsg-widgets/geometryText/jsonschema/geometryText.json", "opentsg-widgets/gradients/jsonschema/gradientSchema.json", "opentsg-widgets/jsonschema/framecounter.json", "opentsg-widgets/jsonschema/gridschema.json", "opentsg-widgets/noise/jsonschema/noiseschema.json", "opentsg-widgets/qrgen/jsonschema/qrgenschema.json", "opentsg-widgets/resize/jsonschema/resize.json", "opentsg-widgets/textbox/jsonschema/textBoxSchema.json", "opentsg-widgets/zoneplate/jsonschema/zoneplateschema.json"}
 
 type schemaBody struct {
 	data     []byte
@@ -43,6 +43,80 @@ type ConfigVals struct {
 	Background  parameters.HexString `json:"backgroundFillColor,omitempty" yaml:"backgroundFillColor,omitempty"`
 	ImageType   string               `json:"imageType,omitempty" yaml:"imageType,omitempty"`
 	Analytics   analytics            `json:"frame analytics" yaml:"frame analytics"`
+	// OutputOptions are the encoder options of each output,
+	// it is only set if any of the outputs have options.
+	OutputOptions []map[string]any `json:"-" yaml:"-"`
+}
+
+// Output is an entry of the canvas outputs. It is either the
+// filename as a string or an object of the filename
+// and the options for the encoder of that file type.
+type Output struct {
+	File    string         `json:"file" yaml:"file"`
+	Options map[string]any `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// UnmarshalYAML allows an output to be declared as
+// a filename string or an object.
+func (o *Output) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&o.File)
+	}
+
+	type plain Output
+	var p plain
+	if err := value.Decode(&p); err != nil {
+		return err
+	}
+	*o = Output(p)
+
+	return nil
+}
+
+// UnmarshalYAML extracts the outputs with their options,
+// separately from the rest of the canvas configuration.
+func (c *ConfigVals) UnmarshalYAML(value *yaml.Node) error {
+	var outs struct {
+		Outputs []Output `yaml:"outputs"`
+	}
+	if err := value.Decode(&outs); err != nil {
+		return err
+	}
+
+	// decode everything that is not the outputs
+	rest := *value
+	rest.Content = make([]*yaml.Node, 0, len(value.Content))
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		if value.Content[i].Value != "outputs" {
+			rest.Content = append(rest.Content, value.Content[i], value.Content[i+1])
+		}
+	}
+
+	type plain ConfigVals
+	var p plain
+	if err := rest.Decode(&p); err != nil {
+		return err
+	}
+	*c = ConfigVals(p)
+
+	if outs.Outputs == nil {
+		return nil
+	}
+
+	c.Outputs = make([]string, len(outs.Outputs))
+	options := make([]map[string]any, len(outs.Outputs))
+	var hasOptions bool
+	for i, out := range outs.Outputs {
+		c.Outputs[i] = out.File
+		options[i] = out.Options
+		hasOptions = hasOptions || out.Options != nil
+	}
+
+	if hasOptions {
+		c.OutputOptions = options
+	}
+
+	return nil
 }
 
 type analytics struct {
@@ -170,6 +244,22 @@ func GetOutputs(c context.Context) []string {
 	return g.Outputs
 }
 
+// GetOutputConfigurations returns the outputs with
+// any encoder options they have been given.
+func GetOutputConfigurations(c context.Context) []Output {
+	g := contToConf(c)
+
+	outs := make([]Output, len(g.Outputs))
+	for i, file := range g.Outputs {
+		outs[i].File = file
+		if i < len(g.OutputOptions) {
+			outs[i].Options = g.OutputOptions[i]
+		}
+	}
+
+	return outs
+}
+
 // GetGridRows returns the number of rows required, the minimum returned value is 1
 func GetGridRows(c context.Context) int {
 	g := contToConf(c)
@@ -228,7 +318,7 @@ func GetPictureSize(c context.Context) image.Point {
 }
 
 // GetCanvasType returns the type of image to be used for the testcard.
-// With either "ACES" or "NRGBA64" as available strings
+// With either "ACES", "NRGBA64" or "float" as available strings
 func GetCanvasType(c context.Context) string {
 	g := contToConf(c)
 
@@ -97,6 +97,26 @@ func TestInitStage(t *testing.T) {
 
 }
 
+func TestOutputOptions(t *testing.T) {
+	cIn, _, importErr := core.FileImport("testdata/outputsloader.json", "", false)
+	cFrame, _ := core.FrameWidgetsGeneratorHandle(cIn, 0)
+	errs := LoopInitHandle(&cFrame)
+
+	expected := []Output{{File: "testname.png"},
+		{File: "testname.dpx", Options: map[string]any{"bitDepth": 10, "packing": "filledB"}}}
+
+	Convey("Checking outputs can be declared with encoder options", t, func() {
+		Convey("run using a input of ./testdata/outputs.json, with a png without options and a dpx with options", func() {
+			Convey("the filenames and options are extracted for each output", func() {
+				So(importErr, ShouldBeNil)
+				So(errs, ShouldBeEmpty)
+				So(GetOutputs(cFrame), ShouldResemble, []string{"testname.png", "testname.dpx"})
+				So(GetOutputConfigurations(cFrame), ShouldResemble, expected)
+			})
+		})
+	})
+}
+
 /*
 func TestSchema(t *testing.T) {
 	schemaLoader := gojsonschema.NewBytesLoader(baseschema)
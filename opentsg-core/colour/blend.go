@@ -0,0 +1,181 @@
+package colour
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// BlendMode is the operation used to combine a source image
+// with the destination image it is drawn on to.
+type BlendMode string
+
+const (
+	// BlendOver is the Porter-Duff over operation, the default
+	BlendOver BlendMode = "over"
+	// BlendSource replaces the destination with the source
+	BlendSource     BlendMode = "source"
+	BlendAdd        BlendMode = "add"
+	BlendMultiply   BlendMode = "multiply"
+	BlendScreen     BlendMode = "screen"
+	BlendDifference BlendMode = "difference"
+	BlendMin        BlendMode = "min"
+	BlendMax        BlendMode = "max"
+)
+
+// blendFuncs are the separable blend functions, for each channel,
+// where b is the backdrop (destination) and s is the source.
+// Values are non alpha multiplied and in the range 0 to 1.
+var blendFuncs = map[BlendMode]func(b, s float64) float64{
+	BlendAdd:        func(b, s float64) float64 { return math.Min(1, b+s) },
+	BlendMultiply:   func(b, s float64) float64 { return b * s },
+	BlendScreen:     func(b, s float64) float64 { return b + s - b*s },
+	BlendDifference: func(b, s float64) float64 { return math.Abs(b - s) },
+	BlendMin:        math.Min,
+	BlendMax:        math.Max,
+}
+
+// DrawMaskBlend works in the same way as DrawMask, but the source is combined with the
+// destination using the blend mode and an overall opacity in the range 0 to 1.
+/*
+Colour space aware colours are transformed to the destination colour space before
+they are blended, so blending is always carried out in the colour space of the destination.
+
+The blend modes of over and source at full opacity are the same as calling DrawMask
+with draw.Over and draw.Src respectively.
+*/
+func DrawMaskBlend(dest draw.Image, r image.Rectangle, src image.Image, sp image.Point, mask image.Image, mp image.Point, mode BlendMode, opacity float64) {
+
+	opacity = math.Max(0, math.Min(1, opacity))
+
+	// use the standard draw functions where possible
+	if opacity == 1 {
+		switch mode {
+		case "", BlendOver:
+			DrawMask(dest, r, src, sp, mask, mp, draw.Over)
+			return
+		case BlendSource:
+			DrawMask(dest, r, src, sp, mask, mp, draw.Src)
+			return
+		}
+	}
+
+	clip(dest, &r, src, &sp, mask, &mp)
+	if r.Empty() {
+		return
+	}
+
+	var destSpace ColorSpace
+	if cImg, ok := dest.(Image); ok {
+		destSpace = cImg.Space()
+	}
+
+	blender := blendFuncs[mode]
+	// float images keep values above 1
+	if _, ok := dest.(*NRGBAF32); ok && mode == BlendAdd {
+		blender = func(b, s float64) float64 { return b + s }
+	}
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		sy := sp.Y + y - r.Min.Y
+		my := mp.Y + y - r.Min.Y
+		for x := r.Min.X; x < r.Max.X; x++ {
+			sx := sp.X + x - r.Min.X
+			mx := mp.X + x - r.Min.X
+
+			ma := float64(maxAlpha)
+			if mask != nil {
+				_, _, _, m := mask.At(mx, my).RGBA()
+				ma = float64(m)
+			}
+			// the total coverage of the source
+			cover := ma / maxAlpha * opacity
+
+			// nothing is drawn
+			if cover == 0 {
+				continue
+			}
+
+			sr, sg, sb, sa := toBlendChannels(src.At(sx, sy), destSpace)
+			dr, dg, db, da := toBlendChannels(dest.At(x, y), destSpace)
+
+			var out [4]float64
+			switch mode {
+			case BlendSource:
+				// interpolate between the destination and source
+				// based on the coverage, with alpha multiplied values
+				out[3] = sa*cover + da*(1-cover)
+				if out[3] > 0 {
+					out[0] = (sr*sa*cover + dr*da*(1-cover)) / out[3]
+					out[1] = (sg*sa*cover + dg*da*(1-cover)) / out[3]
+					out[2] = (sb*sa*cover + db*da*(1-cover)) / out[3]
+				}
+			default:
+				sa *= cover
+				if blender != nil {
+					// mix the blended colour with the source
+					// based on the backdrop alpha
+					sr = (1-da)*sr + da*blender(dr, sr)
+					sg = (1-da)*sg + da*blender(dg, sg)
+					sb = (1-da)*sb + da*blender(db, sb)
+				}
+
+				// then composite over the destination
+				out[3] = sa + da*(1-sa)
+				if out[3] > 0 {
+					out[0] = (sr*sa + dr*da*(1-sa)) / out[3]
+					out[1] = (sg*sa + dg*da*(1-sa)) / out[3]
+					out[2] = (sb*sa + db*da*(1-sa)) / out[3]
+				}
+			}
+
+			// float images keep the values outside of 0 to 1
+			if fImg, ok := dest.(*NRGBAF32); ok {
+				fImg.Set(x, y, &CNRGBAF32{R: float32(out[0]), G: float32(out[1]), B: float32(out[2]), A: float32(out[3]), ColorSpace: destSpace})
+				continue
+			}
+
+			res := CNRGBA64{R: toUint16(out[0]), G: toUint16(out[1]), B: toUint16(out[2]), A: toUint16(out[3]), ColorSpace: destSpace}
+			if (destSpace == ColorSpace{}) {
+				dest.Set(x, y, color.NRGBA64{R: res.R, G: res.G, B: res.B, A: res.A})
+			} else {
+				dest.Set(x, y, &res)
+			}
+		}
+	}
+}
+
+// toBlendChannels returns the non alpha multiplied values of a colour
+// in the range 0 to 1, transforming it to the target colour space if required.
+// Float colours are not clipped to the range.
+func toBlendChannels(c color.Color, target ColorSpace) (r, g, b, a float64) {
+
+	// float colours are not clipped
+	if _, ok := c.(*CNRGBAF32); ok {
+		f := toFloatChannels(c, target)
+		return float64(f.R), float64(f.G), float64(f.B), float64(f.A)
+	}
+
+	if cspace, ok := c.(*CNRGBA64); ok {
+		c = transform(cspace.ColorSpace, target, c)
+	}
+
+	var n color.NRGBA64
+	switch col := c.(type) {
+	case *CNRGBA64:
+		n = color.NRGBA64{R: col.R, G: col.G, B: col.B, A: col.A}
+	case color.NRGBA64:
+		n = col
+	default:
+		n = color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	}
+
+	return float64(n.R) / maxAlpha, float64(n.G) / maxAlpha, float64(n.B) / maxAlpha, float64(n.A) / maxAlpha
+}
+
+// toUint16 converts a 0 to 1 value to a 16 bit value,
+// clipping any values outside of the range.
+func toUint16(v float64) uint16 {
+	return uint16(math.Round(math.Max(0, math.Min(1, v)) * maxAlpha))
+}
@@ -0,0 +1,75 @@
+package colour
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDrawMaskBlend(t *testing.T) {
+
+	backdrop := color.NRGBA64{R: 0x8000, G: 0xffff, B: 0x4000, A: 0xffff}
+	source := color.NRGBA64{R: 0x8000, G: 0x8000, B: 0xffff, A: 0xffff}
+
+	modes := []BlendMode{BlendMultiply, BlendScreen, BlendAdd, BlendDifference, BlendMin, BlendMax}
+	expected := []color.NRGBA64{
+		{R: 0x4000, G: 0x8000, B: 0x4000, A: 0xffff},
+		{R: 0xc000, G: 0xffff, B: 0xffff, A: 0xffff},
+		{R: 0xffff, G: 0xffff, B: 0xffff, A: 0xffff},
+		{R: 0x0000, G: 0x7fff, B: 0xbfff, A: 0xffff},
+		{R: 0x8000, G: 0x8000, B: 0x4000, A: 0xffff},
+		{R: 0x8000, G: 0xffff, B: 0xffff, A: 0xffff},
+	}
+
+	for i, mode := range modes {
+		base := image.NewNRGBA64(image.Rect(0, 0, 4, 4))
+		Draw(base, base.Bounds(), &image.Uniform{backdrop}, image.Point{}, draw.Src)
+		DrawMaskBlend(base, base.Bounds(), &image.Uniform{source}, image.Point{}, nil, image.Point{}, mode, 1)
+
+		Convey("Checking the blend modes combine the source and destination", t, func() {
+			Convey(fmt.Sprintf("blending with a mode of %s", mode), func() {
+				Convey("the expected colour is returned, within a rounding error", func() {
+					got := base.NRGBA64At(1, 1)
+					So(got.R, ShouldAlmostEqual, expected[i].R, 1)
+					So(got.G, ShouldAlmostEqual, expected[i].G, 1)
+					So(got.B, ShouldAlmostEqual, expected[i].B, 1)
+					So(got.A, ShouldEqual, expected[i].A)
+				})
+			})
+		})
+	}
+
+	opaque := image.NewNRGBA64(image.Rect(0, 0, 4, 4))
+	Draw(opaque, opaque.Bounds(), &image.Uniform{color.NRGBA64{A: 0xffff}}, image.Point{}, draw.Src)
+	DrawMaskBlend(opaque, opaque.Bounds(), &image.Uniform{color.NRGBA64{R: 0xffff, A: 0xffff}}, image.Point{}, nil, image.Point{}, BlendOver, 0.5)
+
+	Convey("Checking the opacity is applied to the source", t, func() {
+		Convey("drawing red over black at 50% opacity", func() {
+			Convey("the red channel is at half intensity", func() {
+				So(opaque.NRGBA64At(0, 0), ShouldResemble, color.NRGBA64{R: 0x8000, A: 0xffff})
+			})
+		})
+	})
+
+	spaceAware := NewNRGBA64(ColorSpace{ColorSpace: "rec2020"}, image.Rect(0, 0, 4, 4))
+	Draw(spaceAware, spaceAware.Bounds(), &image.Uniform{&CNRGBA64{R: 0xffff, G: 0xffff, B: 0xffff, A: 0xffff}}, image.Point{}, draw.Src)
+	red709 := &CNRGBA64{R: 0xffff, A: 0xffff, ColorSpace: ColorSpace{ColorSpace: "rec709"}}
+	DrawMaskBlend(spaceAware, spaceAware.Bounds(), &image.Uniform{red709}, image.Point{}, nil, image.Point{}, BlendMultiply, 1)
+
+	converted := transform(red709.ColorSpace, spaceAware.Space(), red709).(*CNRGBA64)
+	got := spaceAware.At(2, 2).(*CNRGBA64)
+
+	Convey("Checking blending is colour space aware", t, func() {
+		Convey("multiplying a rec709 red over a rec2020 white image", func() {
+			Convey("the result is the rec709 red transformed to rec2020", func() {
+				So(got.R, ShouldAlmostEqual, converted.R, 1)
+				So(got.G, ShouldAlmostEqual, converted.G, 1)
+				So(got.B, ShouldAlmostEqual, converted.B, 1)
+			})
+		})
+	})
+}
@@ -236,6 +236,13 @@ func DrawMask(dest draw.Image, r image.Rectangle, src image.Image, sp image.Poin
 			}
 		}
 
+	case *NRGBAF32:
+		clip(dest, &r, src, &sp, mask, &mp)
+		if r.Empty() {
+			return
+		}
+
+		drawFloat(dst, r, src, sp, mask, mp, op == draw.Over)
 	default:
 		draw.DrawMask(dest, r, src, sp, mask, mp, op)
 
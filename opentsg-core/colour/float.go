@@ -0,0 +1,222 @@
+package colour
+
+import (
+	"image"
+	"image/color"
+)
+
+/*
+CNRGBAF32 is a non alpha multiplied linear colour, with
+float32 values where 0 to 1 is the nominal range. Values
+outside of the range are kept, so super whites and negative
+values can be drawn on float canvases.
+*/
+type CNRGBAF32 struct {
+	R, G, B, A float32
+	ColorSpace ColorSpace
+}
+
+func (c *CNRGBAF32) GetColorSpace() ColorSpace {
+	return c.ColorSpace
+}
+
+func (c *CNRGBAF32) UpdateColorSpace(s ColorSpace) {
+	c.ColorSpace = s
+}
+
+// RGBA returns the alpha multiplied 16 bit values of the colour,
+// clipping any values outside of the 0 to 1 range.
+func (c *CNRGBAF32) RGBA() (r, g, b, a uint32) {
+	return color.NRGBA64{R: floatToUint16(c.R), G: floatToUint16(c.G), B: floatToUint16(c.B), A: floatToUint16(c.A)}.RGBA()
+}
+
+// NRGBAF32Model converts any colour to a *CNRGBAF32.
+// Colour space aware colours keep their colour space.
+var NRGBAF32Model color.Model = color.ModelFunc(nrgbaf32Model)
+
+func nrgbaf32Model(c color.Color) color.Color {
+	switch col := c.(type) {
+	case *CNRGBAF32:
+		return col
+	case *CNRGBA64:
+		return &CNRGBAF32{R: float32(col.R) / maxAlpha, G: float32(col.G) / maxAlpha,
+			B: float32(col.B) / maxAlpha, A: float32(col.A) / maxAlpha, ColorSpace: col.ColorSpace}
+	case RGBA128:
+		// aces colours are stored in the range 0 to 65535
+		return &CNRGBAF32{R: col.R / maxAlpha, G: col.G / maxAlpha, B: col.B / maxAlpha, A: col.A / maxAlpha}
+	default:
+		n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+
+		return &CNRGBAF32{R: float32(n.R) / maxAlpha, G: float32(n.G) / maxAlpha,
+			B: float32(n.B) / maxAlpha, A: float32(n.A) / maxAlpha}
+	}
+}
+
+// NRGBAF32 is a linear float32 image with a colour space.
+// It is used for canvases with an imageType of "float",
+// so that the values of widgets are not clipped or
+// rounded to 16 bits until the frame is saved.
+type NRGBAF32 struct {
+	// Pix holds the image's pixels, in R, G, B, A order. The pixel at
+	// (x, y) starts at Pix[(y-Rect.Min.Y)*Stride + (x-Rect.Min.X)*4].
+	Pix []float32
+	// Stride is the Pix stride (in float32s) between vertically adjacent pixels.
+	Stride int
+	// Rect is the image's bounds.
+	Rect        image.Rectangle
+	ColourSpace ColorSpace
+}
+
+// NewNRGBAF32 generates a float image of size r,
+// with the colour space s.
+func NewNRGBAF32(s ColorSpace, r image.Rectangle) *NRGBAF32 {
+	return &NRGBAF32{
+		Pix:         make([]float32, r.Dx()*r.Dy()*4),
+		Stride:      4 * r.Dx(),
+		Rect:        r,
+		ColourSpace: s,
+	}
+}
+
+// Bounds gives the size of the image
+func (n *NRGBAF32) Bounds() image.Rectangle { return n.Rect }
+
+// Space returns the ColorSpace of the Image
+func (n *NRGBAF32) Space() ColorSpace { return n.ColourSpace }
+
+// ColorModel returns the NRGBAF32Model
+func (n *NRGBAF32) ColorModel() color.Model { return NRGBAF32Model }
+
+// PixOffset gives the pixel position at X,Y
+func (n *NRGBAF32) PixOffset(x, y int) int {
+	return (y-n.Rect.Min.Y)*n.Stride + (x-n.Rect.Min.X)*4
+}
+
+// At returns the colour space aware colour at x,y
+func (n *NRGBAF32) At(x, y int) color.Color {
+	c := n.NRGBAF32At(x, y)
+
+	return &c
+}
+
+// NRGBAF32At returns the float values at x,y
+func (n *NRGBAF32) NRGBAF32At(x, y int) CNRGBAF32 {
+	if !(image.Point{x, y}.In(n.Rect)) {
+		return CNRGBAF32{ColorSpace: n.ColourSpace}
+	}
+	i := n.PixOffset(x, y)
+	s := n.Pix[i : i+4 : i+4]
+
+	return CNRGBAF32{R: s[0], G: s[1], B: s[2], A: s[3], ColorSpace: n.ColourSpace}
+}
+
+// Set sets the colour at x,y, transforming colour space
+// aware colours to the colour space of the image first.
+func (n *NRGBAF32) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(n.Rect)) {
+		return
+	}
+
+	f := toFloatChannels(c, n.ColourSpace)
+	i := n.PixOffset(x, y)
+	s := n.Pix[i : i+4 : i+4]
+	s[0], s[1], s[2], s[3] = f.R, f.G, f.B, f.A
+}
+
+// ToNRGBA64 returns the image as an *image.NRGBA64, clipping
+// any values outside of the 0 to 1 range. It is used for
+// saving to formats that do not support float values.
+func (n *NRGBAF32) ToNRGBA64() *image.NRGBA64 {
+	out := image.NewNRGBA64(n.Rect)
+	for y := n.Rect.Min.Y; y < n.Rect.Max.Y; y++ {
+		for x := n.Rect.Min.X; x < n.Rect.Max.X; x++ {
+			i := n.PixOffset(x, y)
+			s := n.Pix[i : i+4 : i+4]
+			out.SetNRGBA64(x, y, color.NRGBA64{R: floatToUint16(s[0]), G: floatToUint16(s[1]), B: floatToUint16(s[2]), A: floatToUint16(s[3])})
+		}
+	}
+
+	return out
+}
+
+// floatToUint16 converts a 0 to 1 value to a 16 bit value,
+// clipping any values outside of the range.
+func floatToUint16(v float32) uint16 {
+	return toUint16(float64(v))
+}
+
+// floatMatrixTransform is the same as matrixTransform,
+// but the float values are not clipped.
+func floatMatrixTransform(xyz, rgb [3][3]float64) func(color.Color) color.Color {
+
+	return func(input color.Color) color.Color {
+		in := nrgbaf32Model(input).(*CNRGBAF32)
+		r, g, b := float64(in.R), float64(in.G), float64(in.B)
+		X := r*xyz[0][0] + g*xyz[0][1] + b*xyz[0][2]
+		Y := r*xyz[1][0] + g*xyz[1][1] + b*xyz[1][2]
+		Z := r*xyz[2][0] + g*xyz[2][1] + b*xyz[2][2]
+
+		return &CNRGBAF32{R: float32(X*rgb[0][0] + Y*rgb[0][1] + Z*rgb[0][2]),
+			G: float32(X*rgb[1][0] + Y*rgb[1][1] + Z*rgb[1][2]),
+			B: float32(X*rgb[2][0] + Y*rgb[2][1] + Z*rgb[2][2]), A: in.A}
+	}
+}
+
+// drawFloat is DrawMask for float destinations, the values
+// are composited as floats and never clipped.
+func drawFloat(dst *NRGBAF32, r image.Rectangle, src image.Image, sp image.Point, mask image.Image, mp image.Point, over bool) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		sy := sp.Y + y - r.Min.Y
+		my := mp.Y + y - r.Min.Y
+		for x := r.Min.X; x < r.Max.X; x++ {
+			sx := sp.X + x - r.Min.X
+			mx := mp.X + x - r.Min.X
+
+			ma := float32(1)
+			if mask != nil {
+				_, _, _, m := mask.At(mx, my).RGBA()
+				ma = float32(m) / maxAlpha
+			}
+
+			if ma == 0 {
+				if !over {
+					dst.Set(x, y, &CNRGBAF32{})
+				}
+				continue
+			}
+
+			s := toFloatChannels(src.At(sx, sy), dst.ColourSpace)
+
+			var out CNRGBAF32
+			switch {
+			case !over || s.A == 1 && ma == 1:
+				out = CNRGBAF32{R: s.R, G: s.G, B: s.B, A: s.A * ma}
+			default:
+				d := dst.NRGBAF32At(x, y)
+				sa := s.A * ma
+				out.A = sa + d.A*(1-sa)
+				if out.A > 0 {
+					out.R = (s.R*sa + d.R*d.A*(1-sa)) / out.A
+					out.G = (s.G*sa + d.G*d.A*(1-sa)) / out.A
+					out.B = (s.B*sa + d.B*d.A*(1-sa)) / out.A
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			p := dst.Pix[i : i+4 : i+4]
+			p[0], p[1], p[2], p[3] = out.R, out.G, out.B, out.A
+		}
+	}
+}
+
+// toFloatChannels returns the non alpha multiplied float
+// values of a colour, transformed to the target colour space.
+func toFloatChannels(c color.Color, target ColorSpace) CNRGBAF32 {
+	// convert to float first so the transform is not clipped
+	f := nrgbaf32Model(c).(*CNRGBAF32)
+	if _, ok := c.(Color); ok && (target != ColorSpace{}) {
+		f = nrgbaf32Model(transform(f.ColorSpace, target, f)).(*CNRGBAF32)
+	}
+
+	return *f
+}
@@ -0,0 +1,69 @@
+package colour
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFloatImage(t *testing.T) {
+
+	base := NewNRGBAF32(ColorSpace{}, image.Rect(0, 0, 4, 4))
+	superWhite := &CNRGBAF32{R: 2.5, G: -0.25, B: 0.123456, A: 1}
+	Draw(base, base.Bounds(), &image.Uniform{superWhite}, image.Point{}, draw.Src)
+
+	// half transparent grey over the super white
+	Draw(base, image.Rect(2, 2, 4, 4), &image.Uniform{&CNRGBAF32{R: 0.5, G: 0.5, B: 0.5, A: 0.5}}, image.Point{}, draw.Over)
+
+	Convey("Checking float images keep values outside of 0 to 1", t, func() {
+		Convey("drawing a super white colour and then a half transparent grey over part of it", func() {
+			Convey("the float values are kept and are only clipped when converted to 16 bit", func() {
+				So(base.NRGBAF32At(0, 0), ShouldResemble, *superWhite)
+				over := base.NRGBAF32At(3, 3)
+				So(over.R, ShouldAlmostEqual, 1.5, 0.0001)
+				So(over.G, ShouldAlmostEqual, 0.125, 0.0001)
+				So(over.A, ShouldEqual, 1)
+				So(base.ToNRGBA64().NRGBA64At(0, 0), ShouldResemble, color.NRGBA64{R: 0xffff, G: 0, B: 0x1f9b, A: 0xffff})
+			})
+		})
+	})
+
+	// rec2020 red is outside of the rec709 gamut
+	space709 := NewNRGBAF32(ColorSpace{ColorSpace: "rec709"}, image.Rect(0, 0, 4, 4))
+	space709.Set(0, 0, &CNRGBAF32{R: 1, A: 1, ColorSpace: ColorSpace{ColorSpace: "rec2020"}})
+	space709.Set(1, 0, &CNRGBA64{R: 0xffff, A: 0xffff, ColorSpace: ColorSpace{ColorSpace: "rec2020"}})
+
+	clipped := NewNRGBA64(ColorSpace{ColorSpace: "rec709"}, image.Rect(0, 0, 4, 4))
+	clipped.Set(0, 0, &CNRGBA64{R: 0xffff, A: 0xffff, ColorSpace: ColorSpace{ColorSpace: "rec2020"}})
+
+	Convey("Checking colour space transforms to float images are not clipped", t, func() {
+		Convey("setting rec2020 red on a rec709 float image", func() {
+			Convey("the out of gamut values are kept, and match the clipped 16 bit values when clipped", func() {
+				c := space709.NRGBAF32At(0, 0)
+				So(c.R, ShouldBeGreaterThan, 1)
+				So(c.G, ShouldBeLessThan, 0)
+				So(c.B, ShouldBeLessThan, 0)
+				So(space709.NRGBAF32At(1, 0), ShouldResemble, c)
+				So(space709.ToNRGBA64().NRGBA64At(0, 0), ShouldResemble, clipped.BaseImage().NRGBA64At(0, 0))
+			})
+		})
+	})
+
+	blend := NewNRGBAF32(ColorSpace{}, image.Rect(0, 0, 4, 4))
+	Draw(blend, blend.Bounds(), &image.Uniform{&CNRGBAF32{R: 0.75, G: 0.75, B: 0.75, A: 1}}, image.Point{}, draw.Src)
+	DrawMaskBlend(blend, blend.Bounds(), &image.Uniform{&CNRGBAF32{R: 0.75, G: 2, B: 0, A: 1}}, image.Point{}, nil, image.Point{}, BlendAdd, 1)
+
+	Convey("Checking blend modes are not clipped on float images", t, func() {
+		Convey("adding 0.75 to 0.75 and 2", func() {
+			Convey("the result is 1.5 and 2.75", func() {
+				c := blend.NRGBAF32At(0, 0)
+				So(c.R, ShouldAlmostEqual, 1.5, 0.0001)
+				So(c.G, ShouldAlmostEqual, 2.75, 0.0001)
+				So(c.B, ShouldAlmostEqual, 0.75, 0.0001)
+			})
+		})
+	})
+}
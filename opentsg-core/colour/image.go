@@ -132,8 +132,11 @@ func PngEncode(w io.Writer, m image.Image) error {
 	// cut out the NRGB64 wrapper as png
 	// doesn't know how to handle it correctly
 	// and it changes the expected values when alpha is not 0xffff
-	if mid, ok := m.(*NRGBA64); ok {
+	switch mid := m.(type) {
+	case *NRGBA64:
 		m = mid.BaseImg
+	case *NRGBAF32:
+		m = mid.ToNRGBA64()
 	}
 
 	return png.Encode(w, m)
@@ -147,8 +150,11 @@ func TiffEncode(w io.Writer, m image.Image, opt *tiff.Options) error {
 	// cut out the NRGB64 wrapper as tiff
 	// doesn't know how to handle it correctly
 	// and it changes the expected values when alpha is not 0xffff
-	if mid, ok := m.(*NRGBA64); ok {
+	switch mid := m.(type) {
+	case *NRGBA64:
 		m = mid.BaseImg
+	case *NRGBAF32:
+		m = mid.ToNRGBA64()
 	}
 
 	return tiff.Encode(w, m, opt)
@@ -44,6 +44,13 @@ func transform(input, output ColorSpace, inputColor color.Color) color.Color {
 		return inputColor
 	}
 
+	// float colours are transformed without clipping
+	if _, ok := inputColor.(*CNRGBAF32); ok {
+		if _, custom := library[input][output]; !custom {
+			return floatMatrixTransform(rGBToXYZ[input.ColorSpace], xYZtoRGB[output.ColorSpace])(inputColor)
+		}
+	}
+
 	// else get transformation
 	tf := getTransform(input, output)
 	// apply transformation
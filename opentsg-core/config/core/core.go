@@ -12,6 +12,7 @@ import (
 	"github.com/mrmxf/opentsg-modules/opentsg-core/colour"
 	"github.com/mrmxf/opentsg-modules/opentsg-core/config/validator"
 	"github.com/mrmxf/opentsg-modules/opentsg-core/credentials"
+	"github.com/mrmxf/opentsg-modules/opentsg-core/middleware"
 )
 
 ////////////////
@@ -31,6 +32,7 @@ const (
 	factoryDir      testKey = "the directory of the main widget factory and everything is relative to"
 	credentialsAuth testKey = "the holder of all the auth information provided by the user for accessing http sources"
 	poskey          testKey = "the key that holds the frame position"
+	secretsKey      testKey = "the key that holds the interpolated secrets"
 )
 
 // then the rest is additions to the alias
@@ -40,7 +42,13 @@ type factory struct {
 	Args     []arguments                 `json:"args" yaml:"args"`
 	Create   []map[string]map[string]any `json:"create" yaml:"create"`
 	Generate []generate                  `json:"generate" yaml:"generate"`
-	// ADD a middleawre section here, may be difficult to keep tabs on
+	// Sweep creates a frame for every combination of
+	// its parameters, it is only used in the input factory.
+	Sweep *sweep `json:"sweep,omitempty" yaml:"sweep,omitempty"`
+
+	// frameTokens are the extra default metadata of
+	// each frame, such as the sweep names
+	frameTokens map[int]map[string]string
 }
 
 type arguments struct {
@@ -53,12 +61,21 @@ type factoryarr struct {
 	Name string `json:"name,omitempty" yaml:"name,omitempty"`
 
 	Args []string `json:"args" yaml:"args"`
+	// When is the conditions for the include to be used on a frame,
+	// if the conditions are not met then creates targeting it are skipped.
+	When *middleware.When `json:"when,omitempty" yaml:"when,omitempty"`
+	// SHA256 is the hex hash the included file must have,
+	// the file is not used if it does not match.
+	SHA256 string `json:"sha256,omitempty" yaml:"sha256,omitempty"`
 }
 
 type generate struct {
 	Name   []map[string]string            `json:"name" yaml:"name"` // map[string]any add the error handling later
 	Range  []string                       `json:"range" yaml:"range"`
 	Action map[string]map[string][]string `json:"action" yaml:"action"` // target(s)  data  updates
+	// Table creates a frame for every row of a data table,
+	// it is only used in the input factory.
+	Table *table `json:"table,omitempty" yaml:"table,omitempty"`
 }
 
 //go:embed jsonschema/includeschema.json
@@ -77,6 +94,25 @@ type base struct {
 	generatedFrameWidgets map[string]widgetContents
 	metadataParams        map[string][]string
 	metadataBucket        map[string]map[string]any
+	// includeConditions are the when conditions of the includes
+	includeConditions map[string]middleware.When
+	// sources are the files of each alias, with the
+	// input factory as "". They are used for linting.
+	sources map[string]source
+	// secrets are the interpolated values
+	// to be redacted from any metadata
+	secrets []string
+	// importOpts are the search paths and filesystem
+	// that the files are found with
+	importOpts ImportOptions
+	// pins are the hashes of the PinLockFile, by the url of the file
+	pins map[string]string
+}
+
+// source is the location and contents of a file
+type source struct {
+	file string
+	data []byte
 }
 
 type widgetContents struct {
@@ -0,0 +1,370 @@
+package core
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BundleLockFile is the name of the lock file in every bundle
+const BundleLockFile = "opentsg.lock.json"
+
+// bundleAssetKeys are the widget properties that are files
+// used when the widget is run, such as images, fonts and TSIGs.
+var bundleAssetKeys = []string{"baseImage", "font", "geometry", "image"}
+
+// BundleLock is the lock file of a bundle,
+// it records where every file in the bundle came from.
+type BundleLock struct {
+	// Factory is the input factory of the bundle
+	Factory string       `json:"factory"`
+	Files   []BundleFile `json:"files"`
+}
+
+// BundleFile is a file that was vendored into a bundle
+type BundleFile struct {
+	// URI is the URI as it was written
+	URI string `json:"uri"`
+	// Source is where the file was found, local files
+	// are relative to the directory of the input factory.
+	Source string `json:"source"`
+	// Path is the name of the file in the bundle
+	Path string `json:"path"`
+	// SHA256 is the hash of the file as it was found,
+	// before any URIs were rewritten.
+	SHA256 string `json:"sha256"`
+}
+
+// bundler holds the files of a bundle as they are vendored
+type bundler struct {
+	holder base
+	// dir is the directory of the input factory,
+	// assets are found relative to it.
+	dir   string
+	files map[string][]byte
+	lock  BundleLock
+}
+
+// Bundle resolves the factory tree of the input file and vendors every file it uses
+// into the out directory, so it can be run without network access. The includes, tables and
+// widget files of "baseImage", "font", "geometry" and "image" properties are
+// vendored, with their URIs rewritten to the files in the bundle.
+// If out ends in ".zip" then the bundle is written as a zip archive.
+//
+// Values that can not be found, such as the names of embedded fonts,
+// or that have mustache tags or interpolations are not changed.
+func Bundle(inputFile, profile, out string, httpKeys ...string) (BundleLock, error) {
+	// check the tree is valid before bundling
+	cont, _, err := FileImport(inputFile, profile, false, httpKeys...)
+	if err != nil {
+		return BundleLock{}, err
+	}
+
+	holder := cont.Value(frameHolders).(base)
+	root := holder.sources[""]
+	b := bundler{holder: holder, dir: filepath.Dir(root.file), files: map[string][]byte{}}
+
+	// the factory is read again so the interpolations are not bundled
+	rootData, err := os.ReadFile(root.file)
+	if err != nil {
+		return BundleLock{}, fmt.Errorf("0064 %v", err)
+	}
+
+	bundled, err := b.factory(rootData, root.file, b.dir, "", []string{b.dir})
+	if err != nil {
+		return BundleLock{}, err
+	}
+
+	b.lock.Factory = filepath.Base(root.file)
+	b.files[b.lock.Factory] = bundled
+	b.lock.Files = append(b.lock.Files, BundleFile{URI: b.lock.Factory, Source: b.lock.Factory,
+		Path: b.lock.Factory, SHA256: sha256Hex(rootData)})
+	slices.SortFunc(b.lock.Files, func(a, c BundleFile) int {
+		return strings.Compare(a.Path+a.URI+a.Source, c.Path+c.URI+c.Source)
+	})
+	b.lock.Files = slices.Compact(b.lock.Files)
+
+	lock, err := json.MarshalIndent(b.lock, "", "    ")
+	if err != nil {
+		return BundleLock{}, fmt.Errorf("0064 error writing the lock file: %v", err)
+	}
+	b.files[BundleLockFile] = lock
+
+	if strings.HasSuffix(out, ".zip") {
+		err = b.writeZip(out)
+	} else {
+		err = b.writeDir(out)
+	}
+
+	return b.lock, err
+}
+
+// factory vendors the includes and assets of a factory,
+// returning the factory with the URIs rewritten. The includes
+// are searched for in the same way as factoryInit.
+func (b *bundler) factory(factoryBytes []byte, file, mainPath, parent string, factoryPaths []string) ([]byte, error) {
+	var jsonFactory factory
+	var contents map[string]any
+	if err := yaml.Unmarshal(factoryBytes, &jsonFactory); err != nil {
+		return nil, fmt.Errorf("0064 error parsing %s: %v", file, err)
+	}
+	if err := yaml.Unmarshal(factoryBytes, &contents); err != nil {
+		return nil, fmt.Errorf("0064 error parsing %s: %v", file, err)
+	}
+
+	changed := false
+	includes, _ := contents["include"].([]any)
+	for i, f := range jsonFactory.Include {
+		fileBytes, path, location, err := fileSearch(b.holder.authBody, f.URI, mainPath, factoryPaths, b.holder.importOpts)
+		if err != nil {
+			return nil, fmt.Errorf("0064 error finding the include %s of %s: %v", f.URI, file, err)
+		}
+
+		alias := parent + f.Name
+		var bundled []byte
+		if _, ok := b.holder.importedFactories[alias]; ok {
+			parents := factoryPaths
+			if !slices.Contains(parents, path) {
+				parents = append(parents, path)
+			}
+			bundled, err = b.factory(fileBytes, location, path, alias+".", parents)
+		} else {
+			bundled, err = b.widget(fileBytes, location)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if include, ok := includes[i].(map[string]any); ok {
+			include["uri"] = b.add(f.URI, location, fileBytes, bundled)
+			// the pin is of the file in the bundle
+			if f.SHA256 != "" {
+				include["sha256"] = sha256Hex(bundled)
+			}
+			changed = true
+		}
+	}
+
+	// only the tables of the input factory are used
+	generates, _ := contents["generate"].([]any)
+	for i, gen := range jsonFactory.Generate {
+		if parent != "" || gen.Table == nil || i >= len(generates) {
+			continue
+		}
+
+		tableBytes, _, location, err := fileSearch(b.holder.authBody, gen.Table.URI, filepath.Dir(file), []string{filepath.Dir(file)}, b.holder.importOpts)
+		if err != nil {
+			return nil, fmt.Errorf("0064 error finding the table %s: %v", gen.Table.URI, err)
+		}
+
+		genMap, _ := generates[i].(map[string]any)
+		if tab, ok := genMap["table"].(map[string]any); ok {
+			tab["uri"] = b.add(gen.Table.URI, location, tableBytes, tableBytes)
+			changed = true
+		}
+	}
+
+	for key, val := range contents {
+		if key == "include" || key == "generate" {
+			continue
+		}
+
+		assetChange, err := walkAssets(val, b.asset)
+		if err != nil {
+			return nil, err
+		}
+		changed = changed || assetChange
+	}
+
+	if !changed {
+		return factoryBytes, nil
+	}
+
+	return bundleMarshal(contents)
+}
+
+// widget vendors the assets of a widget, returning
+// the widget with the asset URIs rewritten.
+func (b *bundler) widget(widgetBytes []byte, file string) ([]byte, error) {
+	var contents map[string]any
+	if err := yaml.Unmarshal(widgetBytes, &contents); err != nil {
+		return nil, fmt.Errorf("0064 error parsing %s: %v", file, err)
+	}
+
+	changed, err := walkAssets(contents, b.asset)
+	if err != nil || !changed {
+		return widgetBytes, err
+	}
+
+	return bundleMarshal(contents)
+}
+
+// walkAssets calls update on every asset property of a value, rewriting
+// them in place with the result. It returns true if any were rewritten.
+func walkAssets(value any, update func(uri string) (string, error)) (bool, error) {
+	changed := false
+
+	switch v := value.(type) {
+	case map[string]any:
+		for key, val := range v {
+			if uri, ok := val.(string); ok && slices.Contains(bundleAssetKeys, key) {
+				newURI, err := update(uri)
+				if err != nil {
+					return false, err
+				}
+
+				if newURI != uri {
+					v[key] = newURI
+					changed = true
+				}
+
+				continue
+			}
+
+			valChange, err := walkAssets(val, update)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || valChange
+		}
+	case []any:
+		for _, val := range v {
+			valChange, err := walkAssets(val, update)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || valChange
+		}
+	}
+
+	return changed, nil
+}
+
+// asset vendors an asset file and returns its name in the bundle.
+// Assets are searched relative to the input factory, like when
+// they are run. Local values that can not be found are returned as they are.
+func (b *bundler) asset(uri string) (string, error) {
+	if uri == "" || strings.Contains(uri, "{{") || strings.Contains(uri, "${") {
+		return uri, nil
+	}
+
+	data, _, location, err := fileSearch(b.holder.authBody, uri, b.dir, []string{b.dir}, b.holder.importOpts)
+	if err != nil {
+		if strings.Contains(uri, "://") {
+			return "", fmt.Errorf("0064 error fetching %s: %v", uri, err)
+		}
+
+		return uri, nil
+	}
+
+	return b.add(uri, location, data, data), nil
+}
+
+// add adds a file to the bundle and the lock file, returning its name in the bundle.
+// The name is the name of the file and the hash of its bundled contents,
+// so files with the same name from different places do not overwrite each other.
+func (b *bundler) add(uri, location string, original, bundled []byte) string {
+	name := filepath.Base(location)
+	if u, err := url.Parse(location); err == nil && u.Scheme != "" && u.Host != "" {
+		name = path.Base(u.Path)
+	} else if rel, err := filepath.Rel(b.dir, location); err == nil {
+		location = filepath.ToSlash(rel)
+	}
+
+	if name == "." || name == "/" {
+		name = "file"
+	}
+
+	ext := path.Ext(name)
+	name = fmt.Sprintf("%s-%s%s", strings.TrimSuffix(name, ext), sha256Hex(bundled)[:12], ext)
+
+	b.files[name] = bundled
+	b.lock.Files = append(b.lock.Files, BundleFile{URI: uri, Source: location, Path: name, SHA256: sha256Hex(original)})
+
+	return name
+}
+
+// sha256Hex returns the sha256 of the data in hex
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// bundleMarshal writes a rewritten file as indented json
+func bundleMarshal(contents map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(contents); err != nil {
+		return nil, fmt.Errorf("0064 error writing a bundled file: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// sortedFiles returns the names of the bundle files in order
+func (b *bundler) sortedFiles() []string {
+	names := make([]string, 0, len(b.files))
+	for name := range b.files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// writeDir writes the bundle files to a directory
+func (b *bundler) writeDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("0064 error making the bundle directory: %v", err)
+	}
+
+	for _, name := range b.sortedFiles() {
+		if err := os.WriteFile(filepath.Join(dir, name), b.files[name], 0644); err != nil {
+			return fmt.Errorf("0064 error writing %s to the bundle: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// writeZip writes the bundle files to a zip archive
+func (b *bundler) writeZip(out string) error {
+	archive, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("0064 error making the bundle archive: %v", err)
+	}
+	defer archive.Close()
+
+	zw := zip.NewWriter(archive)
+	for _, name := range b.sortedFiles() {
+		w, err := zw.Create(name)
+		if err != nil {
+			return fmt.Errorf("0064 error writing %s to the bundle: %v", name, err)
+		}
+
+		if _, err := w.Write(b.files[name]); err != nil {
+			return fmt.Errorf("0064 error writing %s to the bundle: %v", name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("0064 error writing the bundle archive: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v3"
+)
+
+func TestBundle(t *testing.T) {
+
+	out := t.TempDir()
+	lock, err := Bundle("./testdata/bundle/bundle.json", "", out)
+
+	logo, _ := os.ReadFile("./testdata/apitest.png")
+	logoSum := sha256.Sum256(logo)
+
+	uris := map[string]BundleFile{}
+	for _, f := range lock.Files {
+		uris[f.URI] = f
+	}
+
+	Convey("Checking a factory tree is bundled into a directory", t, func() {
+		Convey("using a factory with nested includes, a table and an image", func() {
+			Convey("every file is vendored and recorded in the lock file with its original uri and hash", func() {
+				So(err, ShouldBeNil)
+				So(lock.Factory, ShouldEqual, "bundle.json")
+				So(len(lock.Files), ShouldEqual, 6)
+				So(uris["../apitest.png"].Source, ShouldEqual, "../apitest.png")
+				So(uris["../apitest.png"].SHA256, ShouldEqual, hex.EncodeToString(logoSum[:]))
+				So(uris["factories/frame.json"].Source, ShouldEqual, "factories/frame.json")
+				So(uris["rows.csv"].Path, ShouldStartWith, "rows-")
+
+				for _, f := range lock.Files {
+					So(bundleFileExists(filepath.Join(out, f.Path)), ShouldBeTrue)
+				}
+				So(bundleFileExists(filepath.Join(out, BundleLockFile)), ShouldBeTrue)
+			})
+		})
+	})
+
+	// the bundle is run from a different folder
+	moved := filepath.Join(t.TempDir(), "moved")
+	os.Rename(out, moved)
+	original, originalFrames, _ := FileImport("./testdata/bundle/bundle.json", "", false)
+	bundled, bundledFrames, bundleErr := FileImport(filepath.Join(moved, "bundle.json"), "", false)
+
+	for i := 0; i < originalFrames; i++ {
+		want, wantErrs := FrameWidgetsGeneratorHandle(original, i)
+		got, gotErrs := FrameWidgetsGeneratorHandle(bundled, i)
+
+		wantWidgets := bundleWidgets(want.Value(baseKey).(map[string]WidgetContents))
+		gotWidgets := bundleWidgets(got.Value(baseKey).(map[string]WidgetContents))
+
+		Convey("Checking a bundle makes the same widgets as the original factory", t, func() {
+			Convey(fmt.Sprintf("using frame %v of the bundle after it has been moved", i), func() {
+				Convey("the widgets match, with the image found in the bundle", func() {
+					So(bundleErr, ShouldBeNil)
+					So(bundledFrames, ShouldEqual, originalFrames)
+					So(wantErrs, ShouldBeEmpty)
+					So(gotErrs, ShouldBeEmpty)
+					So(gotWidgets["frame.logo"]["image"], ShouldEqual, uris["../apitest.png"].Path)
+					So(bundleFileExists(filepath.Join(moved, gotWidgets["frame.logo"]["image"].(string))), ShouldBeTrue)
+					delete(gotWidgets["frame.logo"], "image")
+					delete(wantWidgets["frame.logo"], "image")
+					So(gotWidgets, ShouldResemble, wantWidgets)
+				})
+			})
+		})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/fonts/web.ttf" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("font bytes"))
+	}))
+	defer server.Close()
+
+	webDir := t.TempDir()
+	writeBundleFactory(webDir, server.URL+"/fonts/web.ttf")
+	zipOut := filepath.Join(t.TempDir(), "web.zip")
+	webLock, webErr := Bundle(filepath.Join(webDir, "web.json"), "", zipOut)
+
+	var names []string
+	archive, zipErr := zip.OpenReader(zipOut)
+	if zipErr == nil {
+		for _, f := range archive.File {
+			names = append(names, f.Name)
+		}
+		archive.Close()
+	}
+
+	fontPath := ""
+	for _, f := range webLock.Files {
+		if f.URI == server.URL+"/fonts/web.ttf" {
+			fontPath = f.Path
+		}
+	}
+
+	Convey("Checking remote assets are bundled into an archive", t, func() {
+		Convey("using a widget with a font from a http server", func() {
+			Convey("the font is vendored with the name of the url path", func() {
+				So(webErr, ShouldBeNil)
+				So(zipErr, ShouldBeNil)
+				So(fontPath, ShouldStartWith, "web-")
+				So(names, ShouldContain, fontPath)
+				So(names, ShouldContain, BundleLockFile)
+			})
+		})
+	})
+
+	missingDir := t.TempDir()
+	writeBundleFactory(missingDir, server.URL+"/fonts/missing.ttf")
+	_, missingErr := Bundle(filepath.Join(missingDir, "web.json"), "", t.TempDir())
+
+	Convey("Checking remote assets that can not be fetched stop the bundle", t, func() {
+		Convey("using a widget with a font that is not on the http server", func() {
+			Convey("an error is returned", func() {
+				So(missingErr, ShouldNotBeNil)
+				So(missingErr.Error(), ShouldStartWith, "0064 error fetching "+server.URL+"/fonts/missing.ttf")
+			})
+		})
+	})
+}
+
+// bundleWidgets decodes the widgets of a frame
+func bundleWidgets(widgets map[string]WidgetContents) map[string]map[string]any {
+	decoded := map[string]map[string]any{}
+	for alias, w := range widgets {
+		contents := map[string]any{}
+		yaml.Unmarshal(w.Data, &contents)
+		decoded[alias] = contents
+	}
+
+	return decoded
+}
+
+// writeBundleFactory writes a factory with a widget
+// that uses the font to the directory
+func writeBundleFactory(dir, font string) {
+	factory, _ := json.Marshal(map[string]any{
+		"include": []any{map[string]any{"uri": "text.json", "name": "text", "args": []string{}}},
+		"create":  []any{map[string]any{"text": map[string]any{}}},
+	})
+	widget, _ := json.Marshal(map[string]any{"props": map[string]any{"type": "test.text"}, "font": font})
+
+	os.WriteFile(filepath.Join(dir, "web.json"), factory, 0644)
+	os.WriteFile(filepath.Join(dir, "text.json"), widget, 0644)
+}
+
+// bundleFileExists checks a bundled file was written
+func bundleFileExists(file string) bool {
+	_, err := os.Stat(file)
+
+	return err == nil
+}
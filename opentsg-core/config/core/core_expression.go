@@ -0,0 +1,767 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+Expressions are mustache tags that are more than a metadata
+name, such as {{framenumber * 2 % 100}}. They are evaluated
+before the rest of the string is mustached.
+
+There are no loops or assignments, so every expression finishes,
+and only the functions in exprFuncs can be called.
+*/
+
+// maxExpressionLength is the longest expression that is evaluated
+const maxExpressionLength = 1024
+
+// maxExpressionDepth is the deepest nesting of an expression
+const maxExpressionDepth = 64
+
+var (
+	// expressionTag finds the mustache tags
+	expressionTag = regexp.MustCompile(`\{\{([^{}]*)\}\}`)
+	// mustacheTag are the sections, comments and other
+	// mustache tags, which are left for mustache
+	mustacheTag = regexp.MustCompile(`^\s*[#^/!>&=]`)
+	// expressionSymbol are the symbols only found in expressions
+	expressionSymbol = regexp.MustCompile(`[-+*/%<>=!?()'"]`)
+)
+
+// isExpression returns if the tag contents are an expression,
+// tags without any operators or brackets are metadata names.
+// Tags that are the name of a metadata value, such as {{my-key}},
+// are metadata names even if they have operators.
+func isExpression(tag string, metadata map[string]any) bool {
+	if mustacheTag.MatchString(tag) || !expressionSymbol.MatchString(tag) {
+		return false
+	}
+
+	_, isName := metadataValue(strings.TrimSpace(tag), metadata)
+
+	return !isName
+}
+
+// wholeExpression returns the typed value of the input when it
+// is a single expression, so numbers stay numbers in the widgets.
+func wholeExpression(input, location string, metadata map[string]any) (any, bool, error) {
+	trimmed := strings.TrimSpace(input)
+	match := expressionTag.FindStringSubmatchIndex(trimmed)
+	if match == nil || match[0] != 0 || match[1] != len(trimmed) || !isExpression(trimmed[match[2]:match[3]], metadata) {
+		return nil, false, nil
+	}
+
+	val, err := evaluate(trimmed[match[2]:match[3]], metadata)
+	if err != nil {
+		return nil, true, fmt.Errorf("0059 %v in %s at %s", err, input, location)
+	}
+
+	return typed(val), true, nil
+}
+
+// expandExpressions replaces every expression in the input
+// with its value as a string.
+func expandExpressions(input, location string, metadata map[string]any) (string, error) {
+	var exprErr error
+	out := expressionTag.ReplaceAllStringFunc(input, func(tag string) string {
+		contents := tag[2 : len(tag)-2]
+		if exprErr != nil || !isExpression(contents, metadata) {
+			return tag
+		}
+
+		val, err := evaluate(contents, metadata)
+		if err != nil {
+			exprErr = fmt.Errorf("0059 %v in %s at %s", err, input, location)
+			return tag
+		}
+
+		return toString(val)
+	})
+
+	return out, exprErr
+}
+
+// evaluate parses and runs an expression
+func evaluate(expr string, metadata map[string]any) (any, error) {
+	if len(expr) > maxExpressionLength {
+		return nil, fmt.Errorf("the expression is longer than %v characters", maxExpressionLength)
+	}
+
+	toks, err := tokenise(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := exprParser{tokens: toks, metadata: metadata}
+	val, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind != tokEnd {
+		return nil, fmt.Errorf("unexpected \"%s\" in the expression %s", p.peek().text, strings.TrimSpace(expr))
+	}
+
+	return val, nil
+}
+
+type tokenKind int
+
+const (
+	tokEnd tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+}
+
+// operators are the symbols of the expressions,
+// longest first so they are matched first
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "+", "-", "*", "/", "%", "<", ">", "!", "?", ":", "(", ")", ","}
+
+// tokenise splits the expression into tokens
+func tokenise(expr string) ([]token, error) {
+	var toks []token
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			num, err := strconv.ParseFloat(string(runes[start:i]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %s", string(runes[start:i]))
+			}
+			toks = append(toks, token{kind: tokNumber, text: string(runes[start:i]), num: num})
+		case r == '"' || r == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			for i < len(runes) && runes[i] != r {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string %s", string(runes[start:]))
+			}
+			i++
+			toks = append(toks, token{kind: tokString, text: sb.String()})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			toks = append(toks, token{kind: tokIdent, text: string(runes[start:i])})
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(string(runes[i:]), o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unknown character %q", r)
+			}
+			i += len([]rune(op))
+			toks = append(toks, token{kind: tokOp, text: op})
+		}
+	}
+
+	return append(toks, token{kind: tokEnd}), nil
+}
+
+// exprParser is a recursive descent parser, that
+// evaluates the expression as it is parsed.
+type exprParser struct {
+	tokens   []token
+	pos      int
+	depth    int
+	metadata map[string]any
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEnd {
+		p.pos++
+	}
+
+	return t
+}
+
+// accept moves on if the next token is one of the operators
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind == tokOp {
+		for _, o := range ops {
+			if t.text == o {
+				p.pos++
+				return o, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func (p *exprParser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		return fmt.Errorf("expected \"%s\"", op)
+	}
+
+	return nil
+}
+
+// ternary is cond ? a : b
+func (p *exprParser) ternary() (any, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxExpressionDepth {
+		return nil, fmt.Errorf("the expression is nested more than %v times", maxExpressionDepth)
+	}
+
+	cond, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := p.accept("?"); !ok {
+		return cond, nil
+	}
+
+	a, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	b, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+
+	if truthy(cond) {
+		return a, nil
+	}
+
+	return b, nil
+}
+
+func (p *exprParser) or() (any, error) {
+	left, err := p.and()
+	for err == nil {
+		if _, ok := p.accept("||"); !ok {
+			break
+		}
+		var right any
+		right, err = p.and()
+		left = truthy(left) || truthy(right)
+	}
+
+	return left, err
+}
+
+func (p *exprParser) and() (any, error) {
+	left, err := p.comparison()
+	for err == nil {
+		if _, ok := p.accept("&&"); !ok {
+			break
+		}
+		var right any
+		right, err = p.comparison()
+		left = truthy(left) && truthy(right)
+	}
+
+	return left, err
+}
+
+func (p *exprParser) comparison() (any, error) {
+	left, err := p.additive()
+	for err == nil {
+		op, ok := p.accept("==", "!=", "<", "<=", ">", ">=")
+		if !ok {
+			break
+		}
+		var right any
+		right, err = p.additive()
+		if err == nil {
+			left, err = compare(op, left, right)
+		}
+	}
+
+	return left, err
+}
+
+func (p *exprParser) additive() (any, error) {
+	left, err := p.multiplicative()
+	for err == nil {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			break
+		}
+		var right any
+		right, err = p.multiplicative()
+		if err != nil {
+			break
+		}
+
+		// strings that are not numbers are joined
+		ln, lerr := toNumber(left)
+		rn, rerr := toNumber(right)
+		switch {
+		case op == "+" && (lerr != nil || rerr != nil):
+			_, lStr := left.(string)
+			_, rStr := right.(string)
+			if !lStr && !rStr {
+				return nil, fmt.Errorf("can not add %v and %v", left, right)
+			}
+			left = toString(left) + toString(right)
+		case lerr != nil:
+			err = lerr
+		case rerr != nil:
+			err = rerr
+		case op == "+":
+			left = ln + rn
+		default:
+			left = ln - rn
+		}
+	}
+
+	return left, err
+}
+
+func (p *exprParser) multiplicative() (any, error) {
+	left, err := p.unary()
+	for err == nil {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			break
+		}
+		var right any
+		right, err = p.unary()
+		if err != nil {
+			break
+		}
+
+		var ln, rn float64
+		if ln, err = toNumber(left); err != nil {
+			break
+		}
+		if rn, err = toNumber(right); err != nil {
+			break
+		}
+
+		switch op {
+		case "*":
+			left = ln * rn
+		case "/":
+			if rn == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			left = ln / rn
+		default:
+			if rn == 0 {
+				return nil, fmt.Errorf("modulo by zero")
+			}
+			left = math.Mod(ln, rn)
+		}
+	}
+
+	return left, err
+}
+
+func (p *exprParser) unary() (any, error) {
+	if op, ok := p.accept("-", "!"); ok {
+		p.depth++
+		defer func() { p.depth-- }()
+		if p.depth > maxExpressionDepth {
+			return nil, fmt.Errorf("the expression is nested more than %v times", maxExpressionDepth)
+		}
+
+		val, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if op == "!" {
+			return !truthy(val), nil
+		}
+
+		n, err := toNumber(val)
+
+		return -n, err
+	}
+
+	return p.primary()
+}
+
+func (p *exprParser) primary() (any, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return t.num, nil
+	case tokString:
+		return t.text, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+
+		// function call
+		if _, ok := p.accept("("); ok {
+			return p.call(t.text)
+		}
+
+		return lookup(t.text, p.metadata)
+	case tokOp:
+		if t.text == "(" {
+			val, err := p.ternary()
+			if err != nil {
+				return nil, err
+			}
+
+			return val, p.expect(")")
+		}
+	}
+
+	if t.kind == tokEnd {
+		return nil, fmt.Errorf("unexpected end of the expression")
+	}
+
+	return nil, fmt.Errorf("unexpected \"%s\"", t.text)
+}
+
+// call runs the function with the arguments in the brackets
+func (p *exprParser) call(name string) (any, error) {
+	fn, ok := exprFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+
+	var args []any
+	if _, closed := p.accept(")"); !closed {
+		for {
+			arg, err := p.ternary()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+
+			if _, ok := p.accept(","); !ok {
+				break
+			}
+		}
+
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+
+	val, err := fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	return val, nil
+}
+
+// exprFuncs are the functions available to expressions
+var exprFuncs = map[string]func(args []any) (any, error){
+	"min": func(args []any) (any, error) {
+		return numberFold(args, math.Min)
+	},
+	"max": func(args []any) (any, error) {
+		return numberFold(args, math.Max)
+	},
+	"abs":   singleNumber(math.Abs),
+	"floor": singleNumber(math.Floor),
+	"ceil":  singleNumber(math.Ceil),
+	"round": singleNumber(math.Round),
+	"int":   singleNumber(math.Trunc),
+	"float": singleNumber(func(f float64) float64 { return f }),
+	"string": func(args []any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument got %v", len(args))
+		}
+
+		return toString(args[0]), nil
+	},
+	// pad zero pads a number to the width
+	"pad": func(args []any) (any, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("expected 2 arguments got %v", len(args))
+		}
+		num, err := toNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+		width, err := toNumber(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if width < 0 || width > 64 {
+			return nil, fmt.Errorf("the width %v is not between 0 and 64", width)
+		}
+
+		return fmt.Sprintf("%0*d", int(width), int64(num)), nil
+	},
+	"format": exprFormat,
+}
+
+// numberFold applies the function to every argument
+func numberFold(args []any, fn func(a, b float64) float64) (any, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("expected at least 1 argument")
+	}
+
+	out, err := toNumber(args[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range args[1:] {
+		n, err := toNumber(a)
+		if err != nil {
+			return nil, err
+		}
+		out = fn(out, n)
+	}
+
+	return out, nil
+}
+
+// singleNumber makes a function of one number
+func singleNumber(fn func(float64) float64) func(args []any) (any, error) {
+	return func(args []any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument got %v", len(args))
+		}
+		n, err := toNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return fn(n), nil
+	}
+}
+
+// formatVerb finds the printf verbs, with any flags, width and precision
+var formatVerb = regexp.MustCompile(`%[-+# 0]*\d*(\.\d+)?[a-zA-Z%]`)
+
+// exprFormat is printf, where the arguments are converted to
+// the type of their verb.
+func exprFormat(args []any) (any, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("expected a format string")
+	}
+
+	format, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("the format %v is not a string", args[0])
+	}
+
+	var vals []any
+	argPos := 1
+	for _, verb := range formatVerb.FindAllString(format, -1) {
+		v := verb[len(verb)-1]
+		if v == '%' {
+			continue
+		}
+		if argPos >= len(args) {
+			return nil, fmt.Errorf("not enough arguments for %s", format)
+		}
+
+		arg := args[argPos]
+		argPos++
+		switch v {
+		case 'd', 'x', 'X', 'o', 'b', 'c':
+			n, err := toNumber(arg)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, int64(n))
+		case 'f', 'F', 'e', 'E', 'g', 'G':
+			n, err := toNumber(arg)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, n)
+		case 's', 'q', 'v':
+			vals = append(vals, toString(arg))
+		case 't':
+			vals = append(vals, truthy(arg))
+		default:
+			return nil, fmt.Errorf("the verb %s is not supported", verb)
+		}
+	}
+
+	if argPos != len(args) {
+		return nil, fmt.Errorf("too many arguments for %s", format)
+	}
+
+	return fmt.Sprintf(format, vals...), nil
+}
+
+// metadataValue finds the metadata value of a dotpath name
+func metadataValue(name string, metadata map[string]any) (any, bool) {
+	var current any = metadata
+	for _, key := range strings.Split(name, ".") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// lookup finds the number, string or boolean metadata value of a dotpath name
+func lookup(name string, metadata map[string]any) (any, error) {
+	current, ok := metadataValue(name, metadata)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a metadata value", name)
+	}
+
+	switch v := current.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float32:
+		return float64(v), nil
+	case float64, string, bool:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("%s is not a number, string or boolean", name)
+	}
+}
+
+// toNumber converts a value to a number, strings
+// such as "0004" are numbers.
+func toNumber(v any) (float64, error) {
+	switch val := v.(type) {
+	case float64:
+		return val, nil
+	case bool:
+		if val {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil {
+			return 0, fmt.Errorf("\"%s\" is not a number", val)
+		}
+		return n, nil
+	}
+
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+// toString formats a value, whole numbers
+// are written without a decimal point.
+func toString(v any) string {
+	switch val := typed(v).(type) {
+	case string:
+		return val
+	case int:
+		return strconv.Itoa(val)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// typed returns whole numbers as ints
+func typed(v any) any {
+	if f, ok := v.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int(f)
+	}
+
+	return v
+}
+
+// truthy is false for false, 0 and ""
+func truthy(v any) bool {
+	switch val := v.(type) {
+	case bool:
+		return val
+	case float64:
+		return val != 0
+	case string:
+		return val != ""
+	}
+
+	return v != nil
+}
+
+// compare compares numbers when both values are
+// numbers, otherwise they are compared as strings.
+func compare(op string, left, right any) (bool, error) {
+	ln, lerr := toNumber(left)
+	rn, rerr := toNumber(right)
+	if lerr == nil && rerr == nil {
+		switch op {
+		case "==":
+			return ln == rn, nil
+		case "!=":
+			return ln != rn, nil
+		case "<":
+			return ln < rn, nil
+		case "<=":
+			return ln <= rn, nil
+		case ">":
+			return ln > rn, nil
+		default:
+			return ln >= rn, nil
+		}
+	}
+
+	ls, rs := toString(left), toString(right)
+	switch op {
+	case "==":
+		return ls == rs, nil
+	case "!=":
+		return ls != rs, nil
+	case "<":
+		return ls < rs, nil
+	case "<=":
+		return ls <= rs, nil
+	case ">":
+		return ls > rs, nil
+	default:
+		return ls >= rs, nil
+	}
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v3"
+)
+
+func TestExpressions(t *testing.T) {
+
+	metadata := map[string]any{"framenumber": "0007", "offset": 3, "title": "ramp", "nested": map[string]any{"w": 1920.0}}
+
+	expressions := []string{"{{framenumber * 2 % 100}}", "{{ -framenumber + offset }}", "{{min(framenumber, offset, 5)}}",
+		"{{max(1, 2.5)}}", "{{pad(framenumber, 6)}}", "{{format('%s %05.1f %x', title, offset, 255)}}",
+		"{{framenumber > 5 ? \"late\" : \"early\"}}", "{{title != 'ramp' || !(offset == 3)}}",
+		"{{nested.w / 2}}", "{{title + '-' + framenumber}}", "{{round(framenumber / 2)}}", "{{(offset + 1) * 2}}",
+	}
+	results := []any{14, -4, 3, 2.5, "000007", "ramp 003.0 ff", "late", false, 960, "ramp-0007", 4, 8}
+
+	for i, expr := range expressions {
+		got, isExpr, err := wholeExpression(expr, "test", metadata)
+
+		Convey("Checking expressions are evaluated to typed values", t, func() {
+			Convey(fmt.Sprintf("using the expression %s", expr), func() {
+				Convey(fmt.Sprintf("a value of %v is returned", results[i]), func() {
+					So(err, ShouldBeNil)
+					So(isExpr, ShouldBeTrue)
+					So(got, ShouldResemble, results[i])
+				})
+			})
+		})
+	}
+
+	mixed, mixedErr := expandExpressions("frame-{{framenumber + 1}}-{{title}}", "test", metadata)
+	_, plain, _ := wholeExpression("{{framenumber}}", "test", metadata)
+
+	Convey("Checking expressions inside strings are written as strings", t, func() {
+		Convey("using an expression and a metadata name in one string", func() {
+			Convey("the expression is replaced and the metadata name is left for mustache", func() {
+				So(mixedErr, ShouldBeNil)
+				So(mixed, ShouldEqual, "frame-8-{{title}}")
+				So(plain, ShouldBeFalse)
+			})
+		})
+	})
+
+	keyMetadata := map[string]any{"my-key": "hyphen", "a/b": "slash", "my": 1, "key": 2}
+	_, keyExpr, keyErr := wholeExpression("{{my-key}}", "test", keyMetadata)
+	keyOut, keyOutErr := mustacheErrorWrap("{{my-key}}-{{ a/b }}-{{my - key}}", "test", keyMetadata)
+
+	Convey("Checking metadata names with operators are not expressions", t, func() {
+		Convey("using the metadata names my-key and a/b, and the expression my - key", func() {
+			Convey("the metadata names are used by mustache and the expression is evaluated", func() {
+				So(keyErr, ShouldBeNil)
+				So(keyExpr, ShouldBeFalse)
+				So(keyOutErr, ShouldBeNil)
+				So(keyOut, ShouldEqual, "hyphen-slash--1")
+			})
+		})
+	})
+
+	badExpressions := []string{"{{framenumber / 0}}", "{{missing + 1}}", "{{title * 2}}", "{{exec('rm')}}", "{{(1 + 2}}", "{{format('%d')}}"}
+	badErrors := []string{"0059 division by zero in {{framenumber / 0}} at test",
+		"0059 missing is not a metadata value in {{missing + 1}} at test",
+		"0059 \"ramp\" is not a number in {{title * 2}} at test",
+		"0059 unknown function exec in {{exec('rm')}} at test",
+		"0059 expected \")\" in {{(1 + 2}} at test",
+		"0059 format: not enough arguments for %d in {{format('%d')}} at test",
+	}
+
+	for i, expr := range badExpressions {
+		_, _, err := wholeExpression(expr, "test", metadata)
+
+		Convey("Checking invalid expressions return errors", t, func() {
+			Convey(fmt.Sprintf("using the expression %s", expr), func() {
+				Convey(fmt.Sprintf("an error of %s is returned", badErrors[i]), func() {
+					So(err, ShouldResemble, fmt.Errorf("%s", badErrors[i]))
+				})
+			})
+		})
+	}
+
+	c, frames, importErr := FileImport("./testdata/expression/expression.json", "", false)
+	expected := []map[string]any{
+		{"x": 0, "scale": 0.25, "large": false, "label": "frame 000010 of motion", "name": "motion-000", "size": "small"},
+		{"x": 2, "scale": 0.25, "large": true, "label": "frame 000016 of motion", "name": "motion-001", "size": "small"},
+		{"x": 1, "scale": 0.5, "large": false, "label": "frame 000012 of motion", "name": "motion-002", "size": "big"},
+	}
+
+	for i := 0; i < frames; i++ {
+		n, errs := FrameWidgetsGeneratorHandle(c, i)
+		widget := map[string]any{}
+		if len(errs) == 0 {
+			yaml.Unmarshal(n.Value(baseKey).(map[string]WidgetContents)["box"].Data, &widget)
+			delete(widget, "props")
+		}
+
+		Convey("Checking expressions are applied to widgets", t, func() {
+			Convey(fmt.Sprintf("using frame %v of a factory with expressions of the frame number and metadata", i), func() {
+				Convey("the widget has the evaluated values, with numbers and booleans kept as their types", func() {
+					So(importErr, ShouldBeNil)
+					So(errs, ShouldBeEmpty)
+					So(widget, ShouldResemble, expected[i])
+				})
+			})
+		})
+	}
+
+	badC, _, _ := FileImport("./testdata/expression/bad.json", "", false)
+	_, badErrs := FrameWidgetsGeneratorHandle(badC, 0)
+
+	Convey("Checking expression errors are returned for widgets", t, func() {
+		Convey("using a widget that subtracts from a string", func() {
+			Convey("an error with the widget is returned", func() {
+				So(badErrs, ShouldResemble, []error{fmt.Errorf("0059 \"motion\" is not a number in {{framenumber / (title - 1)}} at box")})
+			})
+		})
+	})
+}
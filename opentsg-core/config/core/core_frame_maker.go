@@ -49,6 +49,8 @@ func FrameWidgetsGeneratorHandle(c context.Context, framePos int) (context.Conte
 		return nil, []error{fmt.Errorf("0DEV context not configured, please ensure the context from FileImport is used")}
 	}
 
+	maps.Copy(defaultMetadata, all.frameTokens[framePos])
+
 	mainBase, ok := c.Value(frameHolders).(base)
 	if !ok {
 		return nil, []error{fmt.Errorf("0DEV context not configured, please ensure the context from FileImport is used")}
@@ -56,10 +58,11 @@ func FrameWidgetsGeneratorHandle(c context.Context, framePos int) (context.Conte
 
 	// create a clean map for each frame to prevent overwrite errors. Line holder is only to be read from
 	bases := base{importedFactories: make(map[string]factory),
-		importedWidgets: make(map[string]json.RawMessage),
-		jsonFileLines:   mainBase.jsonFileLines,
-		metadataParams:  mainBase.metadataParams,
-		metadataBucket:  make(map[string]map[string]any)}
+		importedWidgets:   make(map[string]json.RawMessage),
+		jsonFileLines:     mainBase.jsonFileLines,
+		metadataParams:    mainBase.metadataParams,
+		metadataBucket:    make(map[string]map[string]any),
+		includeConditions: mainBase.includeConditions}
 	for k, v := range mainBase.importedFactories {
 		bases.importedFactories[k] = v
 	}
@@ -125,11 +128,23 @@ func FrameWidgetsGeneratorHandle(c context.Context, framePos int) (context.Conte
 			updatedWidget, err := objectMustacheUpdater(widget, metadata, k, "", defaultMetadata)
 			if err != nil {
 				allError = append(allError, err)
-			} else {
-				updatedByte, _ := yaml.Marshal(updatedWidget)
-				wc.Data = updatedByte
-				bases.generatedFrameWidgets[k] = wc
+
+				continue
 			}
+
+			// resolve any keyframes to their value on this frame
+			animated, err := animate(updatedWidget, framePos, k)
+			if err != nil {
+				// the keyframes would fail the widget schema as well
+				allError = append(allError, err)
+				delete(bases.generatedFrameWidgets, k)
+
+				continue
+			}
+
+			updatedByte, _ := yaml.Marshal(animated)
+			wc.Data = updatedByte
+			bases.generatedFrameWidgets[k] = wc
 		}
 	}
 
@@ -209,6 +224,8 @@ func FrameWidgetsGeneratorHandle(c context.Context, framePos int) (context.Conte
 	frameContext = context.WithValue(frameContext, credentialsAuth, mainBase.authBody)
 	// add the frame position
 	frameContext = context.WithValue(frameContext, poskey, framePos)
+	// secrets are redacted from the metadata
+	frameContext = context.WithValue(frameContext, secretsKey, mainBase.secrets)
 
 	// if debug {
 	// tree(bases.generatedFrameWidgets)
@@ -229,6 +246,25 @@ type WidgetEssentials struct {
 	ColourSpace    colour.ColorSpace      `json:"colorSpace,omitempty" yaml:"colorSpace,omitempty"`
 	Loc            gridgen.Location       `json:"location,omitempty" yaml:"location,omitempty"`
 	TSIGProperties gridgen.TSIGProperties `json:"TSIG,omitempty" yaml:"TSIG,omitempty"`
+	// Blend is the mode the widget is composited to the canvas with,
+	// the default is "over"
+	Blend colour.BlendMode `json:"blend,omitempty" yaml:"blend,omitempty"`
+	// Opacity is the overall opacity of the widget from 0 to 1,
+	// when it is not set the widget is fully opaque
+	Opacity *float64 `json:"opacity,omitempty" yaml:"opacity,omitempty"`
+	// Transform is the rotation, flips and scaling applied
+	// to the widget before it is added to the canvas
+	Transform gridgen.Transform `json:"transform,omitempty" yaml:"transform,omitempty"`
+}
+
+// GetOpacity returns the opacity of the widget,
+// defaulting to 1 if no opacity was declared.
+func (w WidgetEssentials) GetOpacity() float64 {
+	if w.Opacity == nil {
+		return 1
+	}
+
+	return *w.Opacity
 }
 
 // createWidgets loops through the create functions of all the factories and generates
@@ -262,6 +298,19 @@ func (b *base) createWidgets(createTargets map[string]map[string]any, defaultMet
 		}
 		dotPath := parent + runKey
 
+		// skip the update if its conditions are not met for this frame
+		createUpdate, met, err := b.conditionsMet(createUpdate, dotPath, parent, defaultMetadata)
+		if err != nil {
+			genErrs = append(genErrs, err)
+			creatCount++
+
+			continue
+		} else if !met {
+			creatCount++
+
+			continue
+		}
+
 		// is it targeting a factory?
 		childFactory, ok := b.importedFactories[dotPath]
 
@@ -571,6 +620,11 @@ func objectMustacheUpdater(updates, metadata map[string]any, path, ext string, d
 func typeExtractAndUpdate(value any, location string, metadata map[string]any) (any, error) {
 	switch val := value.(type) {
 	case string:
+		// a single expression keeps its type
+		if typedVal, ok, err := wholeExpression(val, location, metadata); ok {
+			return typedVal, err
+		}
+
 		// update the target widget with the metadata here. The metadata is self contained per child
 		update, err := mustacheErrorWrap(val, location, metadata)
 
@@ -1197,6 +1251,12 @@ func tree(bases map[string]widgetContents) {
 }*/
 
 func mustacheErrorWrap(input, location string, metadata map[string]any) (string, error) {
+	// evaluate any expressions before the metadata names
+	input, err := expandExpressions(input, location, metadata)
+	if err != nil {
+		return input, err
+	}
+
 	// ensure we don't allow missing varaibles
 	mustache.AllowMissingVariables = false
 	sUp, err := mustache.Render(input, metadata)
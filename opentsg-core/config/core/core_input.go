@@ -3,31 +3,96 @@ package core
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"slices"
+	"strings"
 	"sync"
 
 	"github.com/mrmxf/opentsg-modules/opentsg-core/config/validator"
 	"github.com/mrmxf/opentsg-modules/opentsg-core/credentials"
 	"github.com/mrmxf/opentsg-modules/opentsg-core/gridgen"
+	"github.com/mrmxf/opentsg-modules/opentsg-core/middleware"
 	"gopkg.in/yaml.v3"
 )
 
+// EnvSearchPath is the environment variable of the extra folders that files are
+// searched for in, separated by the os path list separator e.g. /mnt/a:/mnt/b
+const EnvSearchPath = "OPENTSG_PATH"
+
+// ImportOptions are the options for importing a factory
+type ImportOptions struct {
+	// SearchPaths are the folders that files are searched for in, in order,
+	// after the folders of the factories and before the OPENTSG_PATH folders.
+	SearchPaths []string
+	// FS is the filesystem that local files are read from instead of the disk,
+	// such as an embed.FS. The input file, search paths and every relative include
+	// and asset are paths in FS.
+	FS fs.FS
+}
+
 // File import reads a factory json file and extracts all the included files and factories recursively.
 // It returns a context holding them, the number of frames to be run and any errors encountered.
 func FileImport(inputFile, profile string, debug bool, httpKeys ...string) (context.Context, int, error) {
+	return FileImportWith(inputFile, profile, debug, ImportOptions{}, httpKeys...)
+}
+
+// FileImportWith is FileImport with import options.
+func FileImportWith(inputFile, profile string, debug bool, opts ImportOptions, httpKeys ...string) (context.Context, int, error) {
+	var inputBytes []byte
+	var err error
+	if opts.FS != nil {
+		inputFile = credentials.FSPath(".", inputFile)
+		inputBytes, err = fs.ReadFile(opts.FS, inputFile)
+	} else {
+		inputFile, _ = filepath.Abs(inputFile)
+		inputBytes, err = os.ReadFile(inputFile)
+	}
+
+	if err != nil {
+		return context.Background(), 0, fmt.Errorf("0001 %v", err)
+	}
+
+	return importFactory(inputFile, inputBytes, profile, opts, httpKeys...)
+}
+
+// BytesImport is FileImport for a factory that is not a file. The name is the
+// virtual path of the factory, the includes are found relative to its folder,
+// on the disk or in the FS of the options.
+func BytesImport(factory []byte, name, profile string, debug bool, opts ImportOptions, httpKeys ...string) (context.Context, int, error) {
+	if opts.FS != nil {
+		name = credentials.FSPath(".", name)
+	} else {
+		name, _ = filepath.Abs(name)
+	}
+
+	return importFactory(name, factory, profile, opts, httpKeys...)
+}
+
+// importFactory extracts the included files and factories of the
+// input factory, where the input file is the location of the factory.
+func importFactory(inputFile string, inputBytes []byte, profile string, opts ImportOptions, httpKeys ...string) (context.Context, int, error) {
 	cont := context.Background()
 	authDecoder, err := credentials.AuthInit(profile, httpKeys...)
 	if err != nil {
 		return cont, 0, fmt.Errorf("0000 %v", err)
 	}
-	inputFile, _ = filepath.Abs(inputFile)
-	inputBytes, err := os.ReadFile(inputFile)
+
+	baseDir, location := filepath.Dir(inputFile), resolveLocal(inputFile)
+	if opts.FS != nil {
+		baseDir, location = path.Dir(inputFile), inputFile
+		// assets are found relative to the input factory
+		authDecoder.SetFS(opts.FS, baseDir)
+	}
+
+	inputBytes, secrets, err := interpolateFile(inputBytes, inputFile, opts.FS)
 	if err != nil {
-		return cont, 0, fmt.Errorf("0001 %v", err)
+		return cont, 0, err
 	}
 
 	data := make(validator.JSONLines)
@@ -47,22 +112,51 @@ func FileImport(inputFile, profile string, debug bool, httpKeys ...string) (cont
 	if err != nil {
 		return cont, 0, fmt.Errorf("0002 %v when opening %s", err, inputFile)
 	}
+
+	// every row of a data table is an extra frame
+	tableFrames, err := tableCreates(authDecoder, inputFactory.Generate, inputFile, opts)
+	if err != nil {
+		return cont, 0, err
+	}
+	inputFactory.Create = append(inputFactory.Create, tableFrames...)
+
+	// every combination of the sweep is an extra frame
+	sweepFrames, sweepTokens, err := inputFactory.Sweep.creates(inputFile)
+	if err != nil {
+		return cont, 0, err
+	}
+	inputFactory.frameTokens = make(map[int]map[string]string)
+	for i, tokens := range sweepTokens {
+		inputFactory.frameTokens[len(inputFactory.Create)+i] = tokens
+	}
+	inputFactory.Create = append(inputFactory.Create, sweepFrames...)
+
 	if len(inputFactory.Create) == 0 {
 		return cont, 0, fmt.Errorf("0003 No frames declared in %s", inputFile)
 	}
 
+	// the includes of remote factories are pinned in the lock file
+	pins, err := readPinLock(baseDir, opts.FS)
+	if err != nil {
+		return cont, 0, err
+	}
+
 	// set up the cont with frame useful contets
 	frameCont := context.Background()
-	credentials.InitDecoder(&frameCont, profile, httpKeys...)
+	credentials.AddDecoder(&frameCont, authDecoder)
 	frameCont = gridgen.InitAliasBox(frameCont)
 
 	holder := base{importedFactories: make(map[string]factory), importedWidgets: make(map[string]json.RawMessage),
 		jsonFileLines: data, authBody: authDecoder, metadataParams: map[string][]string{},
-		frameBase: frameCont,
+		includeConditions: map[string]middleware.When{},
+		sources:           map[string]source{"": {file: inputFile, data: inputBytes}},
+		secrets:           secrets,
+		importOpts:        opts,
+		pins:              pins,
+		frameBase:         frameCont,
 	}
 
-	baseDir := filepath.Dir(inputFile)
-	err = holder.factoryInit(inputFactory, baseDir, "", []string{baseDir}, []int{})
+	err = holder.factoryInit(inputFactory, inputBytes, location, baseDir, "", []string{baseDir}, nil)
 	if err != nil {
 		return cont, 0, err
 	}
@@ -74,25 +168,67 @@ func FileImport(inputFile, profile string, debug bool, httpKeys ...string) (cont
 	cont = context.WithValue(cont, updates, inputFactory)
 	cont = context.WithValue(cont, frameHolders, holder)
 	// add the working directory everything is relative to
-	cont = context.WithValue(cont, factoryDir, filepath.Dir(inputFile))
+	cont = context.WithValue(cont, factoryDir, baseDir)
+	// the secrets to redact from any metadata
+	cont = context.WithValue(cont, secretsKey, holder.secrets)
 
 	return cont, len(inputFactory.Create), nil
 }
 
+// includeLink is an include of a file, that is
+// part of the chain of includes being initialised.
+type includeLink struct {
+	// file is the resolved location of the file
+	// that declares the include
+	file string
+	line int
+	uri  string
+}
+
 // Make a map of all the factories and their information
-// so that are all open at once and there is no reopening of files and changing of data
-func (b *base) factoryInit(jsonFactory factory, mainPath, parent string, factoryPaths []string, positions []int) error {
+// so that are all open at once and there is no reopening of files and changing of data.
+//
+// file is the resolved location of the factory, and chain is the includes
+// that led to it, which are used to find include cycles.
+func (b *base) factoryInit(jsonFactory factory, factoryBytes []byte, file, mainPath, parent string, factoryPaths []string, chain []includeLink) error {
 
-	if len(positions) > 30 {
-		return fmt.Errorf("0004 recursive set initialisation file detected, the maximum dotpath depth of 30 has been reached")
-	}
+	lines := includeLines(factoryBytes)
 
 	for i, f := range jsonFactory.Include {
 
 		// can we find the file
-		fileBytes, path, err := FileSearch(b.authBody, f.URI, mainPath, factoryPaths)
+		fileBytes, path, location, err := fileSearch(b.authBody, f.URI, mainPath, factoryPaths, b.importOpts)
 		fPath := filepath.Join(path, f.URI)
 		if err == nil {
+			// check the file is the one that was pinned
+			if f.SHA256 != "" {
+				if err := credentials.Verify(f.URI, fileBytes, f.SHA256); err != nil {
+					return fmt.Errorf("0067 %v, included by %s", err, file)
+				}
+			} else if pin, ok := b.pins[location]; ok {
+				if err := credentials.Verify(location, fileBytes, pin); err != nil {
+					return fmt.Errorf("0067 %v, pinned in %s, included by %s", err, PinLockFile, file)
+				}
+			}
+
+			var secrets []string
+			fileBytes, secrets, err = interpolateFile(fileBytes, location, b.importOpts.FS)
+			if err != nil {
+				return err
+			}
+			b.secrets = append(b.secrets, secrets...)
+
+			link := includeLink{file: file, uri: f.URI}
+			if i < len(lines) {
+				link.line = lines[i]
+			}
+			links := append(slices.Clip(chain), link)
+
+			// a file that includes itself further up the
+			// chain would be included forever
+			if location == file || slices.ContainsFunc(chain, func(l includeLink) bool { return l.file == location }) {
+				return fmt.Errorf("0004 include cycle detected, %s", cycleString(links))
+			}
 
 			// check if the bytes have children by being a json factory
 			var newF factory
@@ -139,7 +275,7 @@ func (b *base) factoryInit(jsonFactory factory, mainPath, parent string, factory
 				parents = append(parents, path)
 			}
 
-			err = b.factoryInit(newF, path, parent+f.Name+".", parents, append(positions, i))
+			err = b.factoryInit(newF, fileBytes, location, path, parent+f.Name+".", parents, links)
 			if err != nil { // return the error up the chain
 				return err
 			}
@@ -150,69 +286,188 @@ func (b *base) factoryInit(jsonFactory factory, mainPath, parent string, factory
 		}
 
 		b.metadataParams[parent+f.Name] = f.Args
+		b.sources[parent+f.Name] = source{file: fPath, data: fileBytes}
+		if f.When != nil {
+			b.includeConditions[parent+f.Name] = *f.When
+		}
+	}
+
+	return nil
+}
+
+// includeLines returns the line number of each include
+// of a factory, in the order they are declared.
+func includeLines(factoryBytes []byte) []int {
+	var node yaml.Node
+	if yaml.Unmarshal(factoryBytes, &node) != nil || len(node.Content) == 0 {
+		return nil
+	}
+
+	fact := node.Content[0]
+	for i := 0; i+1 < len(fact.Content); i += 2 {
+		if fact.Content[i].Value != "include" {
+			continue
+		}
+
+		lines := make([]int, len(fact.Content[i+1].Content))
+		for j, inc := range fact.Content[i+1].Content {
+			lines[j] = inc.Line
+		}
+
+		return lines
 	}
 
 	return nil
 }
 
+// cycleString gives the chain of includes as file:line includes uri
+func cycleString(chain []includeLink) string {
+	steps := make([]string, len(chain))
+	for i, l := range chain {
+		steps[i] = fmt.Sprintf("%s:%v includes %s", l.file, l.line, l.uri)
+	}
+
+	return strings.Join(steps, " -> ")
+}
+
+// resolveLocal returns the absolute path of a local
+// file, with any symbolic links resolved.
+func resolveLocal(path string) string {
+	path, _ = filepath.Abs(path)
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+
+	return path
+}
+
 // FileSearch searches for a factory file. Checking http sources, then http sources appended to the parent path.
 // Then it searches local files, before appending the file path onto the parent paths.
-func FileSearch(authBody credentials.Decoder, uri, mainPath string, parentPaths []string) (fileBytes []byte, folderFilePath string, fileErr error) {
-	fileBytes, fileErr = authBody.Decode(uri)
+func FileSearch(authBody credentials.Decoder, uri, mainPath string, parentPaths []string, searchPaths ...string) (fileBytes []byte, folderFilePath string, fileErr error) {
+	fileBytes, folderFilePath, _, fileErr = fileSearch(authBody, uri, mainPath, parentPaths, ImportOptions{SearchPaths: searchPaths})
+
+	return
+}
 
-	// generate the input path per run to stop overwriting errors
+// fileSearch is FileSearch that also returns the resolved location
+// of the file, so that the same file can be identified when it is
+// found with different URIs.
+//
+// If the file is not found, then the error lists every location that was tried.
+func fileSearch(authBody credentials.Decoder, uri, mainPath string, parentPaths []string, opts ImportOptions) (fileBytes []byte, folderFilePath, location string, fileErr error) {
+	if opts.FS != nil {
+		return fsSearch(authBody, uri, mainPath, parentPaths, opts)
+	}
+
+	var tried []string
 
+	fileBytes, fileErr = authBody.Decode(uri)
 	if fileErr == nil {
 
-		return fileBytes, uri, nil
+		return fileBytes, uri, uri, nil
 	}
+	tried = append(tried, decodeAttempt(uri, fileErr))
 
 	inputPath, _ := url.JoinPath(mainPath, uri)
-	// inputPath = filepath.Clean(filepath.Join(inputPath, f.URI))
 	fileBytes, fileErr = authBody.Decode(inputPath)
 	if fileErr == nil {
-		return fileBytes, mainPath, nil
+		return fileBytes, mainPath, inputPath, nil
+	}
+	tried = append(tried, decodeAttempt(inputPath, fileErr))
+
+	// the parent folders are searched first, then the
+	// search paths, the working directory and OPENTSG_HOME
+	roots := slices.Clone(parentPaths)
+	roots = append(roots, opts.SearchPaths...)
+	roots = append(roots, envSearchPaths()...)
+	roots = append(roots, "")
+	if TSGHome := os.Getenv("OPENTSG_HOME"); TSGHome != "" {
+		roots = append(roots, TSGHome)
 	}
 
-	for _, path := range parentPaths {
-
-		// Check relative to the mainjson
-		inputPath, _ = filepath.Abs(filepath.Join(path, uri))
-		// inputPath = filepath.Clean(filepath.Join(inputPath, f.URI))
+	for _, root := range roots {
+		inputPath, _ = filepath.Abs(filepath.Join(root, uri))
 		fileBytes, fileErr = os.ReadFile(inputPath)
+		if fileErr == nil {
+			return fileBytes, filepath.Dir(inputPath), resolveLocal(inputPath), nil
+		}
+		tried = append(tried, searchAttempt(inputPath, fileErr))
+	}
+
+	return nil, "", "", fmt.Errorf("0068 unable to find %s, tried %s", uri, strings.Join(tried, ", "))
+}
 
-		destFolder := filepath.Dir(inputPath)
+// fsSearch is fileSearch for the files of a fs.FS, only urls are
+// searched for outside of the filesystem. Local files are searched for
+// in the parent folders then the search paths, there are no
+// environment folders in the filesystem.
+func fsSearch(authBody credentials.Decoder, uri, mainPath string, parentPaths []string, opts ImportOptions) ([]byte, string, string, error) {
+	var tried []string
 
-		if fileErr == nil {
-			return fileBytes, destFolder, nil
+	if strings.Contains(uri, "://") {
+		fileBytes, err := authBody.Decode(uri)
+		if err == nil {
+			return fileBytes, uri, uri, nil
 		}
+		tried = append(tried, decodeAttempt(uri, err))
 	}
 
-	// check relative to the location of the executable
-	inputPath, _ = filepath.Abs(uri)
-	// inputPath = filepath.Clean(filepath.Join(inputPath, f.URI))
-	fileBytes, fileErr = os.ReadFile(inputPath)
-	destFolder := filepath.Dir(inputPath)
+	// a factory from a url has urls for its includes
+	if strings.Contains(mainPath, "://") {
+		inputPath, _ := url.JoinPath(mainPath, uri)
+		fileBytes, err := authBody.Decode(inputPath)
+		if err == nil {
+			return fileBytes, mainPath, inputPath, nil
+		}
+		tried = append(tried, decodeAttempt(inputPath, err))
+	}
 
-	if fileErr == nil {
-		return fileBytes, destFolder, nil
+	roots := slices.Clone(parentPaths)
+	roots = append(roots, opts.SearchPaths...)
+	for _, root := range roots {
+		if strings.Contains(root, "://") {
+			continue
+		}
+
+		inputPath := credentials.FSPath(root, uri)
+		fileBytes, err := fs.ReadFile(opts.FS, inputPath)
+		if err == nil {
+			return fileBytes, path.Dir(inputPath), inputPath, nil
+		}
+		tried = append(tried, searchAttempt(inputPath, err))
 	}
 
-	// finally check for OPENTSG_HOME
-	TSGHome := os.Getenv("OPENTSG_HOME")
-	if TSGHome != "" {
-		// check for it
-		inputPath, _ = filepath.Abs(filepath.Join(TSGHome, uri))
-		// inputPath = filepath.Clean(filepath.Join(inputPath, f.URI))
-		fileBytes, fileErr = os.ReadFile(inputPath)
+	return nil, "", "", fmt.Errorf("0068 unable to find %s, tried %s", uri, strings.Join(tried, ", "))
+}
 
-		destFolder := filepath.Dir(inputPath)
+// searchAttempt gives a location that was searched and why the file was not found there
+func searchAttempt(location string, err error) string {
+	reason := err.Error()
+	if errors.Is(err, fs.ErrNotExist) {
+		reason = "not found"
+	}
 
-		if fileErr == nil {
-			return fileBytes, destFolder, nil
+	return fmt.Sprintf("%s (%s)", location, reason)
+}
+
+// decodeAttempt is searchAttempt for a location that was searched for as a url
+func decodeAttempt(location string, err error) string {
+	if !strings.Contains(location, "://") {
+		// local paths are not urls
+		return fmt.Sprintf("%s (not a url)", location)
+	}
+
+	return searchAttempt(location, err)
+}
+
+// envSearchPaths returns the folders of the OPENTSG_PATH environment variable
+func envSearchPaths() []string {
+	var paths []string
+	for _, path := range filepath.SplitList(os.Getenv(EnvSearchPath)) {
+		if path != "" {
+			paths = append(paths, path)
 		}
 	}
 
-	// add searched locations
-	return fileBytes, "", fileErr
+	return paths
 }
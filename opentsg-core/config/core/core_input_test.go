@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/mrmxf/opentsg-modules/opentsg-core/credentials"
 	. "github.com/smartystreets/goconvey/convey"
@@ -37,7 +40,8 @@ func TestFileRead(t *testing.T) {
 	badFileErr := []string{fmt.Sprintf("0001 open %s%stestdata%sfake.json: no such file or directory", location, sep, sep),
 		fmt.Sprintf("0028 yaml: invalid leading UTF-8 octet for extracting the yaml bytes from %s%stestdata%sapitest.png", location, sep, sep),
 		fmt.Sprintf("0001 read %s: is a directory", location), "0006 the alias robocorner is repeated, every alias is required to be unique",
-		"0004 recursive set initialisation file detected, the maximum dotpath depth of 30 has been reached",
+		fmt.Sprintf("0004 include cycle detected, %s%stestdata%sframe_generate%serrors%ssequence_recurse.json:3 includes frame_recurse.json -> %s%stestdata%sframe_generate%serrors%sframe_recurse.json:4 includes frame_recurse.json",
+			location, sep, sep, sep, sep, location, sep, sep, sep, sep),
 	}
 
 	for i := range badFile {
@@ -53,6 +57,53 @@ func TestFileRead(t *testing.T) {
 	}
 }
 
+func TestIncludeCycles(t *testing.T) {
+	errFolder := fmt.Sprintf("%s%stestdata%serrors%s", location, sep, sep, sep)
+
+	_, _, cycleErr := FileImport("./testdata/errors/cycle_root.json", "", false)
+	expected := fmt.Sprintf("0004 include cycle detected, %scycle_root.json:3 includes cycle_a.json -> %scycle_a.json:3 includes cycle/cycle_b.json -> %scycle%scycle_b.json:4 includes ../cycle_a.json",
+		errFolder, errFolder, errFolder, sep)
+
+	Convey("Checking include cycles are found", t, func() {
+		Convey("using a factory that includes a file that includes the first factory with a different uri", func() {
+			Convey("the chain of includes that form the cycle is returned, with the line of each include", func() {
+				So(cycleErr, ShouldNotBeNil)
+				So(cycleErr.Error(), ShouldEqual, expected)
+			})
+		})
+	})
+
+	// make a tree deeper than any limit, with
+	// the same widget included at every level
+	dir := t.TempDir()
+	depth := 50
+	os.WriteFile(filepath.Join(dir, "fill.json"), []byte(`{"props": {"type": "builtin.fill"}}`), 0644)
+	for i := 0; i < depth; i++ {
+		include := fmt.Sprintf(`{"uri": "level%v.json", "name": "level%v"}, `, i+1, i+1)
+		if i == depth-1 {
+			include = ""
+		}
+
+		factory := fmt.Sprintf(`{"include": [%s{"uri": "fill.json", "name": "fill"}]}`, include)
+		if i == 0 {
+			factory = fmt.Sprintf(`{"include": [%s{"uri": "fill.json", "name": "fill"}], "create": [{"fill": {}}]}`, include)
+		}
+
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("level%v.json", i)), []byte(factory), 0644)
+	}
+
+	_, frames, deepErr := FileImport(filepath.Join(dir, "level0.json"), "", false)
+
+	Convey("Checking deep include trees are not rejected", t, func() {
+		Convey(fmt.Sprintf("using a factory with includes nested %v levels deep, that reuse the same widget", depth), func() {
+			Convey("no error is returned", func() {
+				So(deepErr, ShouldBeNil)
+				So(frames, ShouldEqual, 1)
+			})
+		})
+	})
+}
+
 func TestBadJson(t *testing.T) {
 	testFolderLocation := fmt.Sprintf("%stestdata%serrors%s", sep, sep, sep)
 
@@ -249,6 +300,60 @@ func TestSearchOrder(t *testing.T) {
 	})
 
 	os.Setenv("OPENTSG_HOME", holder)
+
+	searchDir, envDir := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(searchDir, "search.json"), []byte(`{"from": "search"}`), 0644)
+	os.WriteFile(filepath.Join(envDir, "search.json"), []byte(`{"from": "env"}`), 0644)
+	os.WriteFile(filepath.Join(envDir, "env.json"), []byte(`{"from": "env"}`), 0644)
+	emptyDir := filepath.Join(t.TempDir(), "empty")
+	t.Setenv(EnvSearchPath, emptyDir+string(os.PathListSeparator)+envDir)
+	t.Setenv("OPENTSG_HOME", "")
+
+	resSearch, _, errSearch := FileSearch(mockCredentials, "search.json", "", parentFolders, searchDir)
+	resSearchEnv, _, errSearchEnv := FileSearch(mockCredentials, "env.json", "", parentFolders, searchDir)
+
+	Convey("Checking the search paths are searched in order", t, func() {
+		Convey("Looking for files in a search path and the OPENTSG_PATH folders", func() {
+			Convey("The file is found in the first folder it is in", func() {
+				So(errSearch, ShouldBeNil)
+				So(string(resSearch), ShouldEqual, `{"from": "search"}`)
+				So(errSearchEnv, ShouldBeNil)
+				So(string(resSearchEnv), ShouldEqual, `{"from": "env"}`)
+			})
+		})
+	})
+
+	_, _, errMissing := FileSearch(mockCredentials, "missing.json", "", []string{"./testdata/searchpath/"}, searchDir)
+	wd, _ := os.Getwd()
+	tried := []string{"missing.json (not a url)", "missing.json (not a url)",
+		filepath.Join(wd, "testdata", "searchpath", "missing.json") + " (not found)",
+		filepath.Join(searchDir, "missing.json") + " (not found)",
+		filepath.Join(emptyDir, "missing.json") + " (not found)",
+		filepath.Join(envDir, "missing.json") + " (not found)",
+		filepath.Join(wd, "missing.json") + " (not found)"}
+
+	Convey("Checking files that are not found list every location that was tried", t, func() {
+		Convey("Looking for missing.json", func() {
+			Convey("An error with every location in the search order is returned", func() {
+				So(errMissing, ShouldResemble, fmt.Errorf("0068 unable to find missing.json, tried %s", strings.Join(tried, ", ")))
+			})
+		})
+	})
+
+	dirRoot := t.TempDir()
+	dirPath := filepath.Join(dirRoot, "folder.json")
+	os.Mkdir(dirPath, 0755)
+	_, readErr := os.ReadFile(dirPath)
+	_, _, errDir := FileSearch(mockCredentials, "folder.json", "", []string{dirRoot}, searchDir)
+
+	Convey("Checking local files that can not be read give the reason they were not read", t, func() {
+		Convey("Looking for folder.json, which is a directory", func() {
+			Convey(fmt.Sprintf("The error lists the directory with the reason %q", readErr), func() {
+				So(errDir, ShouldNotBeNil)
+				So(errDir.Error(), ShouldContainSubstring, fmt.Sprintf("folder.json (not a url), %s (%v)", dirPath, readErr))
+			})
+		})
+	})
 }
 
 func TestMetadataUpdate(t *testing.T) {
@@ -306,3 +411,52 @@ func TestMetadataUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestImportFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"patterns/main.json": {Data: []byte(`{"include": [{"uri": "frames/frame.json", "name": "frame", "args": []}],
+			"create": [{"frame": {}, "frame.box": {"text": ["${file:token.txt}"]}}]}`)},
+		"patterns/token.txt":         {Data: []byte("fs token\n")},
+		"patterns/frames/frame.json": {Data: []byte(`{"include": [{"uri": "box.json", "name": "box", "args": []}], "create": [{"box": {}}]}`)},
+		"patterns/frames/box.json":   {Data: []byte(`{"props": {"type": "test.box"}, "image": "logo.png"}`)},
+		"patterns/logo.png":          {Data: []byte("logo bytes")},
+	}
+
+	c, frames, err := FileImportWith("patterns/main.json", "", false, ImportOptions{FS: fsys})
+	widgets := map[string]map[string]any{}
+	var logo []byte
+	var logoErr error
+	if err == nil {
+		frame, _ := FrameWidgetsGeneratorHandle(c, 0)
+		widgets = bundleWidgets(frame.Value(baseKey).(map[string]WidgetContents))
+		logo, logoErr = GetWebBytes(&frame, "logo.png")
+	}
+
+	Convey("Checking factories are imported from a fs.FS", t, func() {
+		Convey("using a map filesystem with nested includes, a file interpolation and an image", func() {
+			Convey("every file is found in the filesystem, including the assets of the widgets", func() {
+				So(err, ShouldBeNil)
+				So(frames, ShouldEqual, 1)
+				So(widgets["frame.box"], ShouldResemble, map[string]any{"image": "logo.png", "text": []any{"fs token"}})
+				So(logoErr, ShouldBeNil)
+				So(string(logo), ShouldEqual, "logo bytes")
+			})
+		})
+	})
+
+	virtual := []byte(`{"include": [{"uri": "frames/frame.json", "name": "frame", "args": []}], "create": [{"frame": {}}]}`)
+	_, virtualFrames, virtualErr := BytesImport(virtual, "patterns/virtual.json", "", false, ImportOptions{FS: fsys})
+
+	missing := []byte(`{"include": [{"uri": "missing.json", "name": "missing", "args": []}], "create": [{"missing": {}}]}`)
+	_, _, missingErr := BytesImport(missing, "patterns/virtual.json", "", false, ImportOptions{FS: fsys, SearchPaths: []string{"shared"}})
+
+	Convey("Checking factories are imported from bytes with a virtual root", t, func() {
+		Convey("using a factory in memory, with a virtual path in the map filesystem", func() {
+			Convey("the includes are found relative to the virtual path and missing files list where they were searched for", func() {
+				So(virtualErr, ShouldBeNil)
+				So(virtualFrames, ShouldEqual, 1)
+				So(missingErr, ShouldResemble, fmt.Errorf("0068 unable to find missing.json, tried patterns/missing.json (not found), shared/missing.json (not found)"))
+			})
+		})
+	})
+}
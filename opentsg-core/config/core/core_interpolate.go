@@ -0,0 +1,191 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mrmxf/opentsg-modules/opentsg-core/credentials"
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces secrets in any metadata that is written
+const Redacted = "[REDACTED]"
+
+// interpolationReg finds ${...} interpolations, and the $${ escapes
+var interpolationReg = regexp.MustCompile(`\$\$\{|\$\{([^}]*)\}`)
+
+// envNameReg is the valid names of environment variables
+var envNameReg = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// interpolateFile replaces the ${ENV_VAR}, ${secret:ENV_VAR} and ${file:path} interpolations
+// of a file, with the environment variables and file contents. Any interpolation
+// can have a default with ${ENV_VAR:-default}, which is used if the value is not set or empty.
+// The values are escaped so they can be used in json strings.
+//
+// It returns the values of the secret and file interpolations, so they can be redacted.
+// Files are read from fsys if it is not nil.
+//
+// Remote files, such as urls, can not use interpolations, as they could read
+// any local file or environment variable and draw it into the frames.
+func interpolateFile(data []byte, file string, fsys fs.FS) ([]byte, []string, error) {
+	if !bytes.Contains(data, []byte("${")) {
+		return data, nil, nil
+	}
+
+	var secrets []string
+	var interErr error
+	out := interpolationReg.ReplaceAllFunc(data, func(match []byte) []byte {
+		if interErr != nil {
+			return match
+		}
+
+		if string(match) == "$${" {
+			return []byte("${")
+		}
+
+		inner := string(match[2 : len(match)-1])
+		if strings.Contains(file, "://") {
+			interErr = fmt.Errorf("the interpolation ${%s} can not be used in a remote file", inner)
+
+			return match
+		}
+
+		ref, def, hasDefault := strings.Cut(inner, ":-")
+
+		value, secret, err := interpolationValue(ref, file, fsys)
+		switch {
+		case err != nil && hasDefault, err == nil && value == "" && hasDefault:
+			value, secret = def, false
+		case err != nil:
+			interErr = err
+
+			return match
+		}
+
+		if secret && value != "" {
+			secrets = append(secrets, value)
+		}
+
+		return jsonEscape(value)
+	})
+
+	if interErr != nil {
+		return nil, nil, fmt.Errorf("0065 %v in %s", interErr, file)
+	}
+
+	return out, secrets, nil
+}
+
+// interpolationValue gets the value of an interpolation and whether it is a secret
+func interpolationValue(ref, file string, fsys fs.FS) (string, bool, error) {
+	source, name, found := strings.Cut(ref, ":")
+	if !found {
+		source, name = "env", ref
+	}
+
+	switch source {
+	case "env", "secret":
+		if !envNameReg.MatchString(name) {
+			return "", false, fmt.Errorf("invalid environment variable name ${%s}", ref)
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", false, fmt.Errorf("the environment variable %s is not set", name)
+		}
+
+		return value, source == "secret", nil
+	case "file":
+		path := name
+		// files are relative to the factory that uses them
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(file), path)
+		}
+
+		var value []byte
+		var err error
+		if fsys != nil {
+			value, err = fs.ReadFile(fsys, credentials.FSPath(filepath.Dir(file), name))
+		} else {
+			value, err = os.ReadFile(path)
+		}
+
+		if err != nil {
+			return "", false, fmt.Errorf("error reading ${%s}: %v", ref, err)
+		}
+
+		return strings.TrimRight(string(value), "\r\n"), true, nil
+	default:
+		return "", false, fmt.Errorf("invalid interpolation ${%s}", ref)
+	}
+}
+
+// jsonEscape escapes a value to be used inside a json string
+func jsonEscape(value string) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(value)
+
+	// remove the quotes and new line
+	escaped := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+
+	return escaped[1 : len(escaped)-1]
+}
+
+// Redact returns a copy of the value, where any secrets that
+// were interpolated into the factories are replaced with [REDACTED].
+// The copy is made of the yaml form of the value, so structs become maps.
+func Redact(c context.Context, value any) any {
+	secrets, _ := c.Value(secretsKey).([]string)
+	if len(secrets) == 0 {
+		return value
+	}
+
+	raw, err := yaml.Marshal(value)
+	if err != nil {
+		return nil
+	}
+
+	var redacted any
+	if err := yaml.Unmarshal(raw, &redacted); err != nil {
+		return nil
+	}
+
+	// replace the longest secrets first, in
+	// case a secret contains another secret
+	secrets = slices.Clone(secrets)
+	slices.SortFunc(secrets, func(a, b string) int { return len(b) - len(a) })
+
+	return redactValue(redacted, secrets)
+}
+
+// redactValue replaces the secrets in every string of the value
+func redactValue(value any, secrets []string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, val := range v {
+			v[key] = redactValue(val, secrets)
+		}
+	case []any:
+		for i, val := range v {
+			v[i] = redactValue(val, secrets)
+		}
+	case string:
+		for _, secret := range secrets {
+			v = strings.ReplaceAll(v, secret, Redacted)
+		}
+
+		return v
+	}
+
+	return value
+}
@@ -0,0 +1,117 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v3"
+)
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("TSG_ROOT", "/mnt/assets")
+	t.Setenv("TSG_EMPTY", "")
+	t.Setenv("TSG_QUOTE", `say "hi"`)
+	t.Setenv("TSG_TOKEN", "abc123")
+
+	inputs := []string{`{"uri": "${TSG_ROOT}/logo.png"}`, `{"uri": "${TSG_UNSET:-./assets}"}`,
+		`{"uri": "${TSG_EMPTY:-./assets}"}`, `{"label": "${TSG_QUOTE}"}`,
+		`{"token": "${secret:TSG_TOKEN}"}`, `{"label": "$${TSG_ROOT}"}`, `{"token": "${file:missing.txt:-none}"}`}
+	expected := []string{`{"uri": "/mnt/assets/logo.png"}`, `{"uri": "./assets"}`,
+		`{"uri": "./assets"}`, `{"label": "say \"hi\""}`,
+		`{"token": "abc123"}`, `{"label": "${TSG_ROOT}"}`, `{"token": "none"}`}
+	expectedSecrets := [][]string{nil, nil, nil, nil, {"abc123"}, nil, nil}
+
+	for i, input := range inputs {
+		got, secrets, err := interpolateFile([]byte(input), "test.json", nil)
+
+		Convey("Checking environment variables are interpolated into files", t, func() {
+			Convey(fmt.Sprintf("using %s as the input", input), func() {
+				Convey(fmt.Sprintf("%s is returned", expected[i]), func() {
+					So(err, ShouldBeNil)
+					So(string(got), ShouldEqual, expected[i])
+					So(secrets, ShouldResemble, expectedSecrets[i])
+				})
+			})
+		})
+	}
+
+	badInputs := []string{`"${TSG_UNSET}"`, `"${TSG-ROOT}"`, `"${vault:TSG_ROOT}"`}
+	badErrors := []string{"0065 the environment variable TSG_UNSET is not set in test.json",
+		"0065 invalid environment variable name ${TSG-ROOT} in test.json",
+		"0065 invalid interpolation ${vault:TSG_ROOT} in test.json"}
+
+	for i, input := range badInputs {
+		_, _, err := interpolateFile([]byte(input), "test.json", nil)
+
+		Convey("Checking invalid interpolations return errors", t, func() {
+			Convey(fmt.Sprintf("using %s as the input", input), func() {
+				Convey(fmt.Sprintf("an error of %s is returned", badErrors[i]), func() {
+					So(err, ShouldResemble, fmt.Errorf("%s", badErrors[i]))
+				})
+			})
+		})
+	}
+
+	t.Setenv("TSG_ASSET_ROOT", "/site/a")
+	t.Setenv("TSG_PASSWORD", "hunter2")
+
+	c, _, importErr := FileImport("./testdata/interpolate/interpolate.json", "", false)
+	frame, errs := FrameWidgetsGeneratorHandle(c, 0)
+	widget := map[string]any{}
+	redacted := map[string]any{}
+	if len(errs) == 0 {
+		box := frame.Value(baseKey).(map[string]WidgetContents)["box"]
+		yaml.Unmarshal(box.Data, &widget)
+		redacted = Redact(frame, widget).(map[string]any)
+	}
+
+	Convey("Checking factories are interpolated when they are imported", t, func() {
+		Convey("using a factory with an environment variable include and a widget with secrets", func() {
+			Convey("the widget has the values, which are redacted from its metadata", func() {
+				So(importErr, ShouldBeNil)
+				So(errs, ShouldBeEmpty)
+				So(widget, ShouldResemble, map[string]any{"image": "/site/a/logo.png", "password": "hunter2",
+					"site": "studio", "token": "file-token", "label": "${NOT_INTERPOLATED}"})
+				So(redacted, ShouldResemble, map[string]any{"image": "/site/a/logo.png", "password": Redacted,
+					"site": "studio", "token": Redacted, "label": "${NOT_INTERPOLATED}"})
+			})
+		})
+	})
+
+	_, _, missingErr := FileImport("./testdata/interpolate/missing.json", "", false)
+	missingPath, _ := filepath.Abs("./testdata/interpolate/missing.json")
+
+	Convey("Checking factories with unset variables are not imported", t, func() {
+		Convey("using a factory with a variable that is not set and has no default", func() {
+			Convey("an error is returned", func() {
+				So(missingErr, ShouldResemble, fmt.Errorf("0065 the environment variable TSG_MISSING_VARIABLE is not set in %s", missingPath))
+			})
+		})
+	})
+
+	secretDir := t.TempDir()
+	secretFile := filepath.Join(secretDir, "secret.txt")
+	os.WriteFile(secretFile, []byte("TOPSECRET"), 0644)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"props": {"type": "test.box"}, "label": "${file:` + secretFile + `}"}`))
+	}))
+	defer server.Close()
+
+	remoteFactory := filepath.Join(t.TempDir(), "remote.json")
+	os.WriteFile(remoteFactory, []byte(`{"include": [{"uri": "`+server.URL+`/widget.json", "name": "box"}], "create": [{"box": {}}]}`), 0644)
+	_, _, remoteErr := FileImport(remoteFactory, "", false)
+
+	Convey("Checking remote files are not interpolated", t, func() {
+		Convey("using a factory that includes a widget from a http server, that reads a local file", func() {
+			Convey("an error is returned and the file is not read", func() {
+				So(remoteErr, ShouldResemble, fmt.Errorf("0065 the interpolation ${file:%s} can not be used in a remote file in %s", secretFile, server.URL+"/widget.json"))
+			})
+		})
+	})
+}
@@ -0,0 +1,320 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// keyframesKey is the key of a property that is
+// animated with keyframes
+const keyframesKey = "keyframes"
+
+// keyframe is the value of a widget property at a frame
+type keyframe struct {
+	Frame int `json:"frame" yaml:"frame"`
+	Value any `json:"value" yaml:"value"`
+	// Interpolation is how the value changes
+	// between this keyframe and the next.
+	Interpolation string `json:"interpolation,omitempty" yaml:"interpolation,omitempty"`
+}
+
+// animate searches through a widget and replaces any keyframe
+// properties with their value at the frame.
+func animate(value any, frame int, location string) (any, error) {
+	switch val := value.(type) {
+	case map[string]any:
+		if raw, ok := val[keyframesKey]; ok && len(val) == 1 {
+			return resolveKeyframes(raw, frame, location)
+		}
+
+		animated := make(map[string]any, len(val))
+		for k, v := range val {
+			var err error
+			animated[k], err = animate(v, frame, location+"."+k)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return animated, nil
+	case []any:
+		animated := make([]any, len(val))
+		for i, v := range val {
+			var err error
+			animated[i], err = animate(v, frame, fmt.Sprintf("%s[%v]", location, i))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return animated, nil
+	default:
+		return value, nil
+	}
+}
+
+// resolveKeyframes returns the value of the keyframes at the frame. The first
+// and last values are held before and after the keyframes.
+func resolveKeyframes(raw any, frame int, location string) (any, error) {
+	var frames []keyframe
+	frameBytes, _ := yaml.Marshal(raw)
+	dec := yaml.NewDecoder(bytes.NewReader(frameBytes))
+	dec.KnownFields(true)
+	if err := dec.Decode(&frames); err != nil {
+		return nil, fmt.Errorf("0062 invalid keyframes at %s: %v", location, err)
+	}
+
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("0062 invalid keyframes at %s: no keyframes were given", location)
+	}
+
+	// check every keyframe so errors are found on every frame
+	easings := make([]func(float64) float64, len(frames))
+	for i, kf := range frames {
+		if i > 0 && kf.Frame <= frames[i-1].Frame {
+			return nil, fmt.Errorf("0062 invalid keyframes at %s: frame %v is not after frame %v", location, kf.Frame, frames[i-1].Frame)
+		}
+
+		ease, err := easing(kf.Interpolation)
+		if err != nil {
+			return nil, fmt.Errorf("0062 invalid keyframes at %s: %v", location, err)
+		}
+		easings[i] = ease
+	}
+
+	if frame <= frames[0].Frame {
+		return frames[0].Value, nil
+	}
+
+	for i, kf := range frames[:len(frames)-1] {
+		next := frames[i+1]
+		if frame >= next.Frame {
+			continue
+		}
+
+		progress := easings[i](float64(frame-kf.Frame) / float64(next.Frame-kf.Frame))
+		// stepped values do not need to be interpolated
+		if progress == 0 {
+			return kf.Value, nil
+		}
+
+		value, err := interpolate(kf.Value, next.Value, progress)
+		if err != nil {
+			return nil, fmt.Errorf("0062 invalid keyframes at %s: %v between frames %v and %v", location, err, kf.Frame, next.Frame)
+		}
+
+		return value, nil
+	}
+
+	return frames[len(frames)-1].Value, nil
+}
+
+// bezierReg matches cubic-bezier(x1, y1, x2, y2)
+var bezierReg = regexp.MustCompile(`^cubic-bezier\(([^,]+),([^,]+),([^,]+),([^,)]+)\)$`)
+
+// easing returns the function that maps the linear progress
+// between two keyframes to the interpolation mode.
+func easing(mode string) (func(float64) float64, error) {
+	switch mode {
+	case "", "linear":
+		return func(t float64) float64 { return t }, nil
+	case "step":
+		return func(float64) float64 { return 0 }, nil
+	case "ease":
+		return cubicBezier(0.25, 0.1, 0.25, 1), nil
+	case "ease-in":
+		return cubicBezier(0.42, 0, 1, 1), nil
+	case "ease-out":
+		return cubicBezier(0, 0, 0.58, 1), nil
+	case "ease-in-out":
+		return cubicBezier(0.42, 0, 0.58, 1), nil
+	}
+
+	match := bezierReg.FindStringSubmatch(strings.ReplaceAll(mode, " ", ""))
+	if match == nil {
+		return nil, fmt.Errorf("unknown interpolation \"%s\", only step, linear, ease, ease-in, ease-out, ease-in-out and cubic-bezier(x1,y1,x2,y2) are available", mode)
+	}
+
+	var points [4]float64
+	for i, m := range match[1:] {
+		var err error
+		points[i], err = strconv.ParseFloat(m, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a number in %s", m, mode)
+		}
+	}
+
+	if points[0] < 0 || points[0] > 1 || points[2] < 0 || points[2] > 1 {
+		return nil, fmt.Errorf("the x values of %s must be between 0 and 1", mode)
+	}
+
+	return cubicBezier(points[0], points[1], points[2], points[3]), nil
+}
+
+// cubicBezier returns the css style cubic bezier timing function,
+// with the curve starting at 0,0 and ending at 1,1.
+func cubicBezier(x1, y1, x2, y2 float64) func(float64) float64 {
+	curve := func(s, p1, p2 float64) float64 {
+		return 3*(1-s)*(1-s)*s*p1 + 3*(1-s)*s*s*p2 + s*s*s
+	}
+
+	return func(t float64) float64 {
+		// the x values are always increasing, so the
+		// curve position of t is found by bisection
+		low, high := 0.0, 1.0
+		for range 64 {
+			mid := (low + high) / 2
+			if curve(mid, x1, x2) < t {
+				low = mid
+			} else {
+				high = mid
+			}
+		}
+
+		return curve((low+high)/2, y1, y2)
+	}
+}
+
+// numberReg finds the numbers in a string
+var numberReg = regexp.MustCompile(`-?\d+(\.\d+)?`)
+
+// interpolate finds the value between start and end at the progress. Numbers,
+// hex colours, strings with numbers in them, such as rgb12 colours, and arrays
+// of these are interpolated.
+// Integers in strings stay as integers, by rounding the interpolated value.
+func interpolate(start, end any, progress float64) (any, error) {
+	switch s := start.(type) {
+	case int, float64:
+		a, _ := keyframeNumber(s)
+		b, ok := keyframeNumber(end)
+		if !ok {
+			return nil, fmt.Errorf("%v and %v are not both numbers", start, end)
+		}
+
+		// whole numbers are kept as integers
+		return typed(a + (b-a)*progress), nil
+	case string:
+		e, ok := end.(string)
+		if ok && hexColourReg.MatchString(s) && hexColourReg.MatchString(e) {
+			return interpolateHex(s, e, progress)
+		}
+
+		// the digits of hex colours are not decimal numbers
+		if hexReg.MatchString(s) || (ok && hexReg.MatchString(e)) {
+			return nil, fmt.Errorf("\"%v\" and \"%v\" are not both hex colours, use a step interpolation", start, end)
+		}
+
+		if !ok || numberReg.ReplaceAllString(s, "") != numberReg.ReplaceAllString(e, "") {
+			return nil, fmt.Errorf("\"%v\" and \"%v\" do not have the same format", start, end)
+		}
+
+		startNums := numberReg.FindAllString(s, -1)
+		endNums := numberReg.FindAllString(e, -1)
+		if len(startNums) != len(endNums) {
+			return nil, fmt.Errorf("\"%v\" and \"%v\" do not have the same format", start, end)
+		}
+
+		i := 0
+		return numberReg.ReplaceAllStringFunc(s, func(string) string {
+			a, _ := strconv.ParseFloat(startNums[i], 64)
+			b, _ := strconv.ParseFloat(endNums[i], 64)
+			v := a + (b-a)*progress
+			isInt := !strings.Contains(startNums[i], ".") && !strings.Contains(endNums[i], ".")
+			i++
+
+			if isInt {
+				return strconv.Itoa(int(math.Round(v)))
+			}
+
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}), nil
+	case []any:
+		e, ok := end.([]any)
+		if !ok || len(s) != len(e) {
+			return nil, fmt.Errorf("%v and %v are not arrays of the same length", start, end)
+		}
+
+		values := make([]any, len(s))
+		for i := range s {
+			var err error
+			values[i], err = interpolate(s[i], e[i], progress)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return values, nil
+	default:
+		return nil, fmt.Errorf("%v can not be interpolated, use a step interpolation", start)
+	}
+}
+
+var (
+	// hexColourReg matches the #rgb, #rgba, #rrggbb and #rrggbbaa colours
+	hexColourReg = regexp.MustCompile(`^#([0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+	// hexReg finds hex colours in a string
+	hexReg = regexp.MustCompile(`#[0-9a-fA-F]{3,8}\b`)
+)
+
+// interpolateHex interpolates each channel of two hex colours, keeping the
+// zero padding. When one colour is in the short form, e.g. #f00, both colours
+// are interpolated in the long form, e.g. #ff0000.
+func interpolateHex(start, end string, progress float64) (string, error) {
+	a, b := start[1:], end[1:]
+	channels := 3
+	if len(a) == 4 || len(a) == 8 {
+		channels = 4
+	}
+
+	if len(b) != channels && len(b) != channels*2 {
+		return "", fmt.Errorf("\"%v\" and \"%v\" do not have the same channels", start, end)
+	}
+
+	width := max(len(a), len(b)) / channels
+	hexChannels := func(hex string) []float64 {
+		digits := len(hex) / channels
+		values := make([]float64, channels)
+		for i := range values {
+			v, _ := strconv.ParseUint(hex[i*digits:(i+1)*digits], 16, 8)
+			// #f is the same as #ff
+			if digits < width {
+				v *= 17
+			}
+			values[i] = float64(v)
+		}
+
+		return values
+	}
+
+	format := "%0*x"
+	if strings.ContainsAny(start, "ABCDEF") {
+		format = "%0*X"
+	}
+
+	startChannels, endChannels := hexChannels(a), hexChannels(b)
+	colour := "#"
+	for i := range startChannels {
+		v := startChannels[i] + (endChannels[i]-startChannels[i])*progress
+		colour += fmt.Sprintf(format, width, int(math.Round(v)))
+	}
+
+	return colour, nil
+}
+
+// keyframeNumber returns the float value of an int or float64
+func keyframeNumber(v any) (float64, bool) {
+	switch num := v.(type) {
+	case int:
+		return float64(num), true
+	case float64:
+		return num, true
+	}
+
+	return 0, false
+}
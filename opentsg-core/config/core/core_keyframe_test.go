@@ -0,0 +1,132 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v3"
+)
+
+func TestKeyframes(t *testing.T) {
+
+	keyframes := []any{
+		[]any{map[string]any{"frame": 0, "value": 0}, map[string]any{"frame": 10, "value": 100}},
+		[]any{map[string]any{"frame": 0, "value": 0.0, "interpolation": "ease"}, map[string]any{"frame": 10, "value": 1.0}},
+		[]any{map[string]any{"frame": 0, "value": "a", "interpolation": "step"}, map[string]any{"frame": 5, "value": "b"}},
+		[]any{map[string]any{"frame": 0, "value": []any{0, 0.5}}, map[string]any{"frame": 10, "value": []any{10, 1.5}}},
+		[]any{map[string]any{"frame": 0, "value": 0.0, "interpolation": "cubic-bezier(0, 0, 1, 1)"}, map[string]any{"frame": 10, "value": 1.0}},
+		[]any{map[string]any{"frame": 0, "value": "rgb12(0,0,0)"}, map[string]any{"frame": 10, "value": "rgb12(4095,100,1)"}},
+		[]any{map[string]any{"frame": 0, "value": "#ff0000"}, map[string]any{"frame": 10, "value": "#0000ff"}},
+		[]any{map[string]any{"frame": 0, "value": "#000010"}, map[string]any{"frame": 10, "value": "#000020"}},
+		[]any{map[string]any{"frame": 0, "value": "#F00"}, map[string]any{"frame": 10, "value": "#0000FF"}},
+	}
+	results := [][]any{
+		{0, 20, 50, 100, 100},
+		{0, 0.2952443342678225, 0.8024033877399112, 1, 1},
+		{"a", "a", "b", "b", "b"},
+		{[]any{0, 0.5}, []any{2, 0.7}, []any{5, 1}, []any{10, 1.5}, []any{10, 1.5}},
+		{0, 0.2, 0.5, 1, 1},
+		{"rgb12(0,0,0)", "rgb12(819,20,0)", "rgb12(2048,50,1)", "rgb12(4095,100,1)", "rgb12(4095,100,1)"},
+		{"#ff0000", "#cc0033", "#800080", "#0000ff", "#0000ff"},
+		{"#000010", "#000013", "#000018", "#000020", "#000020"},
+		{"#F00", "#CC0033", "#800080", "#0000FF", "#0000FF"},
+	}
+
+	for i, kf := range keyframes {
+		var got []any
+		var err error
+		for _, frame := range []int{0, 2, 5, 10, 12} {
+			var value any
+			value, err = resolveKeyframes(kf, frame, "test")
+			got = append(got, value)
+		}
+
+		Convey("Checking keyframes are interpolated for each frame", t, func() {
+			Convey(fmt.Sprintf("using the keyframes %v on frames 0, 2, 5, 10 and 12", kf), func() {
+				Convey(fmt.Sprintf("the values %v are returned", results[i]), func() {
+					So(err, ShouldBeNil)
+					for j := range got {
+						if f, ok := got[j].(float64); ok {
+							So(f, ShouldAlmostEqual, results[i][j], 0.000001)
+						} else {
+							So(got[j], ShouldResemble, results[i][j])
+						}
+					}
+				})
+			})
+		})
+	}
+
+	badKeyframes := []any{
+		[]any{map[string]any{"frame": 5, "value": 0}, map[string]any{"frame": 5, "value": 1}},
+		[]any{map[string]any{"frame": 0, "value": true}, map[string]any{"frame": 10, "value": false}},
+		[]any{map[string]any{"frame": 0, "value": "rgb(0,0)"}, map[string]any{"frame": 10, "value": "rgb(1,1,1)"}},
+		[]any{map[string]any{"frame": 0, "value": 0, "interpolation": "cubic-bezier(2, 0, 1, 1)"}, map[string]any{"frame": 10, "value": 1}},
+		[]any{map[string]any{"frame": 0, "val": 0}},
+		[]any{map[string]any{"frame": 0, "value": "#f00"}, map[string]any{"frame": 10, "value": "#ff000080"}},
+		[]any{map[string]any{"frame": 0, "value": "fill #f00"}, map[string]any{"frame": 10, "value": "fill #00f"}},
+	}
+	badErrors := []string{"0062 invalid keyframes at test: frame 5 is not after frame 5",
+		"0062 invalid keyframes at test: true can not be interpolated, use a step interpolation between frames 0 and 10",
+		"0062 invalid keyframes at test: \"rgb(0,0)\" and \"rgb(1,1,1)\" do not have the same format between frames 0 and 10",
+		"0062 invalid keyframes at test: the x values of cubic-bezier(2, 0, 1, 1) must be between 0 and 1",
+		"0062 invalid keyframes at test: yaml: unmarshal errors:\n  line 2: field val not found in type core.keyframe",
+		"0062 invalid keyframes at test: \"#f00\" and \"#ff000080\" do not have the same channels between frames 0 and 10",
+		"0062 invalid keyframes at test: \"fill #f00\" and \"fill #00f\" are not both hex colours, use a step interpolation between frames 0 and 10",
+	}
+
+	for i, kf := range badKeyframes {
+		_, err := resolveKeyframes(kf, 5, "test")
+
+		Convey("Checking invalid keyframes return errors", t, func() {
+			Convey(fmt.Sprintf("using the keyframes %v", kf), func() {
+				Convey(fmt.Sprintf("an error of %s is returned", badErrors[i]), func() {
+					So(err, ShouldResemble, fmt.Errorf("%s", badErrors[i]))
+				})
+			})
+		})
+	}
+
+	c, frames, importErr := FileImport("./testdata/keyframe/keyframe.json", "", false)
+	expected := []map[string]any{
+		{"x": 0.0, "colour": "rgb12(0,0,4095)", "angle": 0},
+		{"x": 25.0, "colour": "rgb12(0,0,4095)", "angle": 0},
+		{"x": 50.0, "colour": "rgb12(4095,0,0)", "angle": 28.38211313152855},
+		{"x": 75.0, "colour": "rgb12(4095,0,0)", "angle": 90},
+		{"x": 100.0, "colour": "rgb12(4095,0,0)", "angle": "0004"},
+	}
+
+	for i := 0; i < frames; i++ {
+		n, errs := FrameWidgetsGeneratorHandle(c, i)
+		got := map[string]any{}
+		if len(errs) == 0 {
+			wc := n.Value(baseKey).(map[string]WidgetContents)["moving.bar"]
+			widget := map[string]any{}
+			yaml.Unmarshal(wc.Data, &widget)
+			got = map[string]any{"x": wc.Loc.Box.X, "colour": widget["colour"], "angle": widget["angle"]}
+		}
+
+		Convey("Checking keyframes are resolved for widgets", t, func() {
+			Convey(fmt.Sprintf("using frame %v of a widget with keyframes in its properties and create update", i), func() {
+				Convey("the widget has the value of the keyframes for that frame", func() {
+					So(importErr, ShouldBeNil)
+					So(errs, ShouldBeEmpty)
+					So(got, ShouldResemble, expected[i])
+				})
+			})
+		})
+	}
+
+	badC, _, _ := FileImport("./testdata/keyframe/bad.json", "", false)
+	_, badErrs := FrameWidgetsGeneratorHandle(badC, 0)
+
+	Convey("Checking keyframe errors are returned for widgets", t, func() {
+		Convey("using a widget with an unknown interpolation", func() {
+			Convey("an error with the widget is returned", func() {
+				So(badErrs, ShouldHaveLength, 1)
+				So(badErrs[0].Error(), ShouldStartWith, "0062 invalid keyframes at moving.bar.angle: unknown interpolation \"bounce\"")
+			})
+		})
+	})
+}
@@ -0,0 +1,500 @@
+package core
+
+import (
+	"fmt"
+	"image"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mrmxf/opentsg-modules/opentsg-core/colour"
+	"github.com/mrmxf/opentsg-modules/opentsg-core/config/validator"
+	"github.com/mrmxf/opentsg-modules/opentsg-core/middleware"
+	"gopkg.in/yaml.v3"
+)
+
+// The lint rules
+const (
+	// LintUnusedArg is an include arg that is never given a value
+	LintUnusedArg = "unused-arg"
+	// LintUnusedMetadata is metadata given to an include that is never used
+	LintUnusedMetadata = "unused-metadata"
+	// LintUnreferencedInclude is an include that no create targets
+	LintUnreferencedInclude = "unreferenced-include"
+	// LintUnknownAlias is a useAlias of a grid alias that is not declared before it is used
+	LintUnknownAlias = "unknown-alias"
+	// LintUnregisteredType is a widget without a type, or a type with no handler
+	LintUnregisteredType = "unregistered-type"
+	// LintCoveredWidget is a widget whose area is fully covered by an opaque widget that runs after it
+	LintCoveredWidget = "covered-widget"
+	// LintFrameError is an error generating the widgets of a frame
+	LintFrameError = "frame-error"
+)
+
+// LintIssue is a problem found in a factory tree
+type LintIssue struct {
+	// Rule is the lint rule that found the issue
+	Rule string
+	// Alias is the dot path of the include with the issue,
+	// it is empty for the input factory
+	Alias string
+	// File and Line are where the issue is, the line is empty if it
+	// could not be found. Values found on several lines are comma separated.
+	File, Line string
+	Message    string
+}
+
+// String returns the issue in the form file:line: message (rule)
+func (l LintIssue) String() string {
+	position := l.File
+	if l.Line != "" {
+		position += ":" + l.Line
+	}
+
+	return fmt.Sprintf("%s: %s (%s)", position, l.Message, l.Rule)
+}
+
+// LintOptions are the settings for linting a factory
+type LintOptions struct {
+	// WidgetTypes are the widget types that have handlers,
+	// the types are not checked if it is empty.
+	WidgetTypes []string
+	// SearchPaths are the folders that files are searched for in,
+	// after the folders of the factories.
+	SearchPaths []string
+}
+
+// linter holds the factory tree being linted
+type linter struct {
+	root   factory
+	holder base
+	// lines are the JSONLines of each file
+	lines  map[string]validator.JSONLines
+	issues []LintIssue
+	// found prevents repeated issues from different frames
+	found map[string]bool
+}
+
+// lintUpdate is a create update and the alias it targets
+type lintUpdate struct {
+	target string
+	update map[string]any
+	// parent is the factory alias that declares the update
+	parent string
+	index  int
+	key    string
+}
+
+// arrayReg matches the array positions of a create key e.g. [0:3]
+var arrayReg = regexp.MustCompile(`\[[^\]]*\]`)
+
+// Lint reads a factory tree and reports any problems with the files,
+// such as unused args and includes, and undeclared grid aliases.
+// Every frame is generated to check the widgets that are made.
+func Lint(inputFile, profile string, options LintOptions, httpKeys ...string) ([]LintIssue, error) {
+	c, frames, err := FileImportWith(inputFile, profile, false, ImportOptions{SearchPaths: options.SearchPaths}, httpKeys...)
+	if err != nil {
+		return nil, err
+	}
+
+	l := linter{root: c.Value(updates).(factory), holder: c.Value(frameHolders).(base),
+		lines: make(map[string]validator.JSONLines), found: make(map[string]bool)}
+
+	creates := l.updates()
+	l.lintIncludes(creates)
+	l.lintArgs(creates)
+
+	for i := 0; i < frames; i++ {
+		frame, errs := FrameWidgetsGeneratorHandle(c, i)
+		for _, err := range errs {
+			l.add(LintIssue{Rule: LintFrameError, File: l.holder.sources[""].file, Message: fmt.Sprintf("frame %v: %v", i, err)}, err.Error())
+		}
+
+		if frame != nil {
+			l.lintFrame(GetFrameWidgetsHandle(frame), i, options)
+		}
+	}
+
+	// order the issues by their position
+	slices.SortStableFunc(l.issues, func(a, b LintIssue) int {
+		if a.File != b.File {
+			return strings.Compare(a.File, b.File)
+		}
+
+		return firstLine(a.Line) - firstLine(b.Line)
+	})
+
+	return l.issues, nil
+}
+
+// firstLine returns the first line number of a comma
+// separated list of lines, or 0 if there is no line.
+func firstLine(lines string) int {
+	line, _ := strconv.Atoi(strings.Split(lines, ",")[0])
+
+	return line
+}
+
+// add adds an issue if it has not already been found, issues
+// are the same if their rule, alias, position and detail match.
+// This stops the same issue being reported for every frame.
+func (l *linter) add(issue LintIssue, detail string) {
+	key := strings.Join([]string{issue.Rule, issue.Alias, issue.File, issue.Line, detail}, "\x00")
+	if l.found[key] {
+		return
+	}
+	l.found[key] = true
+	l.issues = append(l.issues, issue)
+}
+
+// position finds the line of a key and value in the file of an alias
+func (l *linter) position(alias, dotPath string, value any) (file, line string) {
+	src := l.holder.sources[alias]
+	lines, ok := l.lines[src.file]
+	if !ok {
+		lines = make(validator.JSONLines)
+		// a file that can not be read has no lines
+		_ = validator.Liner(src.data, src.file, "widget", lines)
+		l.lines[src.file] = lines
+	}
+
+	file, line = lines.Position(dotPath, value)
+	if file == "" {
+		return src.file, ""
+	}
+
+	return file, line
+}
+
+// factoryOf returns the factory of an alias, with the input factory as ""
+func (l *linter) factoryOf(alias string) (factory, bool) {
+	if alias == "" {
+		return l.root, true
+	}
+	f, ok := l.holder.importedFactories[alias]
+
+	return f, ok
+}
+
+// parentOf returns the alias of the factory that includes the alias
+func parentOf(alias string) string {
+	if i := strings.LastIndex(alias, "."); i != -1 {
+		return alias[:i]
+	}
+
+	return ""
+}
+
+// childPath joins a factory alias and the key of one of its creates
+func childPath(parent, key string) string {
+	key = arrayReg.ReplaceAllString(key, "")
+	if parent == "" {
+		return key
+	}
+
+	return parent + "." + key
+}
+
+// updates returns every create update in the factory tree
+func (l *linter) updates() []lintUpdate {
+	var updates []lintUpdate
+	aliases := append([]string{""}, slices.Sorted(maps.Keys(l.holder.importedFactories))...)
+	for _, alias := range aliases {
+		f, _ := l.factoryOf(alias)
+		for i, create := range f.Create {
+			for _, key := range slices.Sorted(maps.Keys(create)) {
+				updates = append(updates, lintUpdate{target: childPath(alias, key), update: create[key], parent: alias, index: i, key: key})
+			}
+		}
+	}
+
+	return updates
+}
+
+// includes returns every include alias, with the alias of its factory
+// and the position of the include in that factory.
+func (l *linter) includes(fn func(alias, parent string, index int, inc factoryarr)) {
+	aliases := append([]string{""}, slices.Sorted(maps.Keys(l.holder.importedFactories))...)
+	for _, parent := range aliases {
+		f, _ := l.factoryOf(parent)
+		for i, inc := range f.Include {
+			fn(childPath(parent, inc.Name), parent, i, inc)
+		}
+	}
+}
+
+// generateTargets returns the aliases targeted by generate actions
+func (l *linter) generateTargets() map[string]bool {
+	targets := make(map[string]bool)
+	aliases := append([]string{""}, slices.Collect(maps.Keys(l.holder.importedFactories))...)
+	for _, alias := range aliases {
+		f, _ := l.factoryOf(alias)
+		for _, gen := range f.Generate {
+			for target := range gen.Action {
+				targets[childPath(alias, target)] = true
+			}
+		}
+	}
+
+	return targets
+}
+
+// lintIncludes finds includes that are never targeted by a create,
+// or by a generate action.
+func (l *linter) lintIncludes(creates []lintUpdate) {
+	referenced := map[string]bool{"": true}
+	mark := func(target string) {
+		for target != "" {
+			referenced[target] = true
+			target = parentOf(target)
+		}
+	}
+
+	for _, c := range creates {
+		mark(c.target)
+	}
+
+	for target := range l.generateTargets() {
+		mark(target)
+	}
+
+	l.includes(func(alias, parent string, index int, inc factoryarr) {
+		// only report the first include of an unused branch
+		if referenced[alias] || !referenced[parent] {
+			return
+		}
+
+		file, line := l.position(parent, fmt.Sprintf("include.%v.name", index), inc.Name)
+		l.add(LintIssue{Rule: LintUnreferencedInclude, Alias: alias, File: file, Line: line,
+			Message: fmt.Sprintf("the include %s is never used by a create", alias)}, "")
+	})
+}
+
+// lintArgs finds include args that are never given values, and
+// metadata that is given to an include and never used.
+func (l *linter) lintArgs(creates []lintUpdate) {
+	// the keys given to each alias
+	supplied := make(map[string]map[string]bool)
+	for _, c := range creates {
+		if supplied[c.target] == nil {
+			supplied[c.target] = make(map[string]bool)
+		}
+		for k := range c.update {
+			supplied[c.target][k] = true
+		}
+	}
+
+	// generated data can supply any value
+	generated := l.generateTargets()
+
+	// metadata keys in when conditions are used
+	whenKeys := make(map[string]bool)
+	l.includes(func(_, _ string, _ int, inc factoryarr) {
+		if inc.When != nil {
+			collectWhenKeys(*inc.When, whenKeys)
+		}
+	})
+	for _, c := range creates {
+		if raw, ok := c.update[whenKey]; ok {
+			if when, err := decodeWhen(raw); err == nil {
+				collectWhenKeys(when, whenKeys)
+			}
+		}
+	}
+
+	var isSupplied func(alias, arg string) bool
+	isSupplied = func(alias, arg string) bool {
+		if supplied[alias][arg] || generated[alias] {
+			return true
+		}
+
+		// parents pass on their metadata if it is one of their args,
+		// the input factory has no metadata to pass on
+		parent := parentOf(alias)
+		if parent == "" {
+			return false
+		}
+
+		return slices.Contains(l.holder.metadataParams[parent], arg) && isSupplied(parent, arg)
+	}
+
+	l.includes(func(alias, parent string, index int, inc factoryarr) {
+		for j, arg := range inc.Args {
+			if isSupplied(alias, arg) {
+				continue
+			}
+
+			file, line := l.position(parent, fmt.Sprintf("include.%v.args.%v", index, j), arg)
+			l.add(LintIssue{Rule: LintUnusedArg, Alias: alias, File: file, Line: line,
+				Message: fmt.Sprintf("the arg %s of %s is never given a value", arg, alias)}, arg)
+		}
+	})
+
+	for _, c := range creates {
+		args := l.holder.metadataParams[c.target]
+		for _, k := range slices.Sorted(maps.Keys(c.update)) {
+			if !stringMatcher(k, args) || whenKeys[k] || l.metadataUsed(c.target, k, creates) {
+				continue
+			}
+
+			file, line := l.position(c.parent, fmt.Sprintf("create.%v.%s.%s", c.index, c.key, k), c.update[k])
+			l.add(LintIssue{Rule: LintUnusedMetadata, Alias: c.target, File: file, Line: line,
+				Message: fmt.Sprintf("the metadata %s given to %s is never used", k, c.target)}, k)
+		}
+	}
+}
+
+// metadataUsed checks if a metadata key is in a mustache tag of the alias,
+// or any of its children that have the key as an arg.
+func (l *linter) metadataUsed(alias, key string, creates []lintUpdate) bool {
+	tag := regexp.MustCompile(`\{\{[^}]*\b` + regexp.QuoteMeta(key) + `\b[^}]*\}\}`)
+	if tag.Match(l.holder.sources[alias].data) {
+		return true
+	}
+
+	for _, c := range creates {
+		if c.target == alias || strings.HasPrefix(c.target, alias+".") {
+			updateBytes, _ := yaml.Marshal(c.update)
+			if tag.Match(updateBytes) {
+				return true
+			}
+		}
+	}
+
+	f, ok := l.holder.importedFactories[alias]
+	if !ok {
+		return false
+	}
+
+	for _, inc := range f.Include {
+		child := alias + "." + inc.Name
+		if slices.Contains(inc.Args, key) && l.metadataUsed(child, key, creates) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// collectWhenKeys adds the metadata keys of when conditions to keys
+func collectWhenKeys(when middleware.When, keys map[string]bool) {
+	for k := range when.Metadata {
+		keys[k] = true
+	}
+	for _, alt := range when.AnyOf {
+		collectWhenKeys(alt, keys)
+	}
+}
+
+// lintFrame checks the widgets generated for a frame
+func (l *linter) lintFrame(widgets map[string]WidgetContents, frame int, options LintOptions) {
+	names := slices.Sorted(maps.Keys(widgets))
+
+	// grid aliases have to be declared before they are used
+	aliases := make(map[string]int)
+	for _, name := range names {
+		wc := widgets[name]
+		if a := wc.Loc.Alias; a != "" {
+			if prev, ok := aliases[a]; !ok || wc.Pos < prev {
+				aliases[a] = wc.Pos
+			}
+		}
+	}
+
+	for _, name := range names {
+		wc := widgets[name]
+
+		if use := wc.Loc.Box.UseAlias; use != "" {
+			pos, ok := aliases[use]
+			if !ok || pos >= wc.Pos {
+				file, line := l.position(name, "props.location.box.useAlias", use)
+				l.add(LintIssue{Rule: LintUnknownAlias, Alias: name, File: file, Line: line,
+					Message: fmt.Sprintf("the grid alias %s used by %s is not declared before it, first found on frame %v", use, name, frame)}, use)
+			}
+		}
+
+		switch {
+		case wc.WType == "":
+			l.add(LintIssue{Rule: LintUnregisteredType, Alias: name, File: l.holder.sources[name].file,
+				Message: fmt.Sprintf("%s has no type so it is never run", name)}, "")
+		case len(options.WidgetTypes) > 0 && !slices.Contains(options.WidgetTypes, wc.WType):
+			file, line := l.position(name, "props.type", wc.WType)
+			l.add(LintIssue{Rule: LintUnregisteredType, Alias: name, File: file, Line: line,
+				Message: fmt.Sprintf("%s has the type %s, which has no handler", name, wc.WType)}, wc.WType)
+		}
+	}
+
+	l.lintCovered(widgets, names, frame)
+}
+
+// lintCanvas is the canvas widget fields that set the size of the grid
+type lintCanvas struct {
+	FrameSize struct {
+		W int `yaml:"w"`
+		H int `yaml:"h"`
+	} `yaml:"frameSize"`
+	GridRows    int `yaml:"gridRows"`
+	GridColumns int `yaml:"gridColumns"`
+}
+
+// lintCovered finds the widgets whose area is fully covered by an
+// opaque widget that runs after them, so they are never seen.
+// Only widgets with x and y coordinates are checked, as grid aliases and keys
+// are not known until the frame is drawn.
+func (l *linter) lintCovered(widgets map[string]WidgetContents, names []string, frame int) {
+	var canvas lintCanvas
+	found := false
+	for _, name := range names {
+		if widgets[name].WType == "builtin.canvas" {
+			found = yaml.Unmarshal(widgets[name].Data, &canvas) == nil
+			break
+		}
+	}
+
+	if !found || canvas.FrameSize.W == 0 || canvas.FrameSize.H == 0 {
+		return
+	}
+
+	// the canvas defaults to a single grid square
+	rows, cols := max(canvas.GridRows, 1), max(canvas.GridColumns, 1)
+	size := image.Point{X: canvas.FrameSize.W, Y: canvas.FrameSize.H}
+
+	areas := make(map[string]image.Rectangle)
+	for _, name := range names {
+		wc := widgets[name]
+		if wc.WType == "builtin.canvas" {
+			continue
+		}
+
+		area, err := wc.Loc.Area(size, rows, cols)
+		if err != nil || area.Empty() {
+			continue
+		}
+		areas[name] = wc.Transform.TransformArea(area)
+	}
+
+	for _, name := range names {
+		area, ok := areas[name]
+		if !ok {
+			continue
+		}
+
+		for _, cover := range names {
+			over, ok := areas[cover]
+			wc := widgets[cover]
+			// only widgets that replace everything under them cover a widget
+			if !ok || wc.Pos <= widgets[name].Pos || !wc.Transform.IsIdentity() || wc.GetOpacity() < 1 ||
+				(wc.Blend != "" && wc.Blend != colour.BlendOver && wc.Blend != colour.BlendSource) || !area.In(over) {
+				continue
+			}
+
+			file, line := l.position(name, "props.location.box.x", widgets[name].Loc.Box.X)
+			l.add(LintIssue{Rule: LintCoveredWidget, Alias: name, File: file, Line: line,
+				Message: fmt.Sprintf("%s is fully covered by %s, which runs after it, first found on frame %v", name, cover, frame)}, cover)
+
+			break
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLint(t *testing.T) {
+
+	issues, err := Lint("./testdata/lint/lint.json", "", LintOptions{WidgetTypes: []string{"test.box"}})
+
+	lint, _ := filepath.Abs("./testdata/lint/lint.json")
+	user, _ := filepath.Abs("./testdata/lint/user.json")
+	odd, _ := filepath.Abs("./testdata/lint/odd.json")
+	expected := []string{
+		lint + ":3: the arg missing of frame is never given a value (unused-arg)",
+		lint + ":4: the include spare is never used by a create (unreferenced-include)",
+		lint + ":7: the metadata size given to frame is never used (unused-metadata)",
+		odd + ":3: frame.odd has the type test.unknown, which has no handler (unregistered-type)",
+		user + ":6: the grid alias bottom used by frame.user is not declared before it, first found on frame 0 (unknown-alias)",
+	}
+
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+
+	Convey("Checking a factory tree is linted", t, func() {
+		Convey("using a factory with unused args, metadata and includes, an undeclared grid alias and an unknown widget type", func() {
+			Convey(fmt.Sprintf("the issues %v are found with their lines", expected), func() {
+				So(err, ShouldBeNil)
+				So(got, ShouldResemble, expected)
+			})
+		})
+	})
+
+	covered, coveredErr := Lint("./testdata/lint/covered.json", "", LintOptions{WidgetTypes: []string{"builtin.canvas", "test.box"}})
+
+	back, _ := filepath.Abs("./testdata/lint/back.json")
+	expectedCovered := []string{
+		back + ":6: layers.back is fully covered by layers.front, which runs after it, first found on frame 0 (covered-widget)",
+	}
+
+	var gotCovered []string
+	for _, issue := range covered {
+		gotCovered = append(gotCovered, issue.String())
+	}
+
+	Convey("Checking widgets that are covered by later widgets are linted", t, func() {
+		Convey("using a widget under an opaque widget and a widget under a half transparent widget", func() {
+			Convey(fmt.Sprintf("only the widget under the opaque widget is found, %v", expectedCovered), func() {
+				So(coveredErr, ShouldBeNil)
+				So(gotCovered, ShouldResemble, expectedCovered)
+			})
+		})
+	})
+
+	clean, cleanErr := Lint("./testdata/expression/expression.json", "", LintOptions{WidgetTypes: []string{"test.box"}})
+
+	Convey("Checking a factory tree without problems is linted", t, func() {
+		Convey("using a factory that uses all of its args and includes", func() {
+			Convey("no issues are found", func() {
+				So(cleanErr, ShouldBeNil)
+				So(clean, ShouldBeEmpty)
+			})
+		})
+	})
+}
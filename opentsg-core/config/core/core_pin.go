@@ -0,0 +1,300 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/mrmxf/opentsg-modules/opentsg-core/credentials"
+	"gopkg.in/yaml.v3"
+)
+
+// PinLockFile is the name of the file that Pin writes the hashes of the
+// includes of remote factories to, in the directory of the input factory.
+const PinLockFile = "opentsg.pins.json"
+
+// PinLock is the lock file of the includes of remote factories,
+// which can not be pinned in the remote factory.
+type PinLock struct {
+	// Includes are the sha256 hashes of the included files, by their url
+	Includes map[string]string `json:"includes"`
+}
+
+// PinnedFile is a remote file that was pinned
+type PinnedFile struct {
+	// File is the local factory, widget or pin lock file the pin was written to
+	File string
+	URI  string
+	// SHA256 is the hex hash of the remote file
+	SHA256 string
+}
+
+// pinner holds the factory tree being pinned
+type pinner struct {
+	holder base
+	pinned []PinnedFile
+	// lock is the pin lock file and the hashes it holds
+	lockFile string
+	lock     PinLock
+}
+
+// Pin fills in the sha256 of every remote include and asset of the factory tree of the input file,
+// so that the files are rejected if they change. Includes are given a "sha256" and the
+// "baseImage", "font", "geometry" and "image" properties are given a #sha256= url fragment.
+// The local files that are pinned are rewritten, remote factories can not be
+// rewritten so the hashes of their includes are written to the PinLockFile
+// next to the input file.
+//
+// Files that are already pinned are checked, and an error is returned if they do not match.
+func Pin(inputFile, profile string, httpKeys ...string) ([]PinnedFile, error) {
+	// check the tree is valid before pinning
+	cont, _, err := FileImport(inputFile, profile, false, httpKeys...)
+	if err != nil {
+		return nil, err
+	}
+
+	holder := cont.Value(frameHolders).(base)
+	root := holder.sources[""]
+	dir := filepath.Dir(root.file)
+	p := pinner{holder: holder, lockFile: filepath.Join(dir, PinLockFile),
+		lock: PinLock{Includes: maps.Clone(holder.pins)}}
+	if p.lock.Includes == nil {
+		p.lock.Includes = make(map[string]string)
+	}
+
+	// the factory is read again so the interpolations are not written
+	rootData, err := os.ReadFile(root.file)
+	if err != nil {
+		return nil, fmt.Errorf("0067 %v", err)
+	}
+
+	if _, err := p.factory(rootData, root.file, dir, "", []string{dir}); err != nil {
+		return nil, err
+	}
+
+	// only write the lock if there are new hashes
+	if len(p.lock.Includes) != len(holder.pins) {
+		lock, err := json.MarshalIndent(p.lock, "", "    ")
+		if err != nil {
+			return nil, fmt.Errorf("0067 error writing %s: %v", p.lockFile, err)
+		}
+
+		if err := os.WriteFile(p.lockFile, lock, 0644); err != nil {
+			return nil, fmt.Errorf("0067 error writing %s: %v", p.lockFile, err)
+		}
+	}
+
+	return p.pinned, nil
+}
+
+// readPinLock reads the hashes of the PinLockFile in dir, from
+// fsys if it is not nil. There are no hashes if there is no lock file.
+func readPinLock(dir string, fsys fs.FS) (map[string]string, error) {
+	var lockBytes []byte
+	var err error
+	if fsys != nil {
+		lockFile := credentials.FSPath(dir, PinLockFile)
+		lockBytes, err = fs.ReadFile(fsys, lockFile)
+	} else {
+		lockBytes, err = os.ReadFile(filepath.Join(dir, PinLockFile))
+	}
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("0067 error reading the pin lock: %v", err)
+	}
+
+	var lock PinLock
+	if err := json.Unmarshal(lockBytes, &lock); err != nil {
+		return nil, fmt.Errorf("0067 error reading the pin lock: %v", err)
+	}
+
+	return lock.Includes, nil
+}
+
+// factory pins the includes and assets of a local factory, writing
+// the factory if it changed. The pinned bytes of the factory are returned.
+func (p *pinner) factory(factoryBytes []byte, file, mainPath, parent string, factoryPaths []string) ([]byte, error) {
+	var jsonFactory factory
+	var contents map[string]any
+	if err := yaml.Unmarshal(factoryBytes, &jsonFactory); err != nil {
+		return nil, fmt.Errorf("0067 error parsing %s: %v", file, err)
+	}
+	if err := yaml.Unmarshal(factoryBytes, &contents); err != nil {
+		return nil, fmt.Errorf("0067 error parsing %s: %v", file, err)
+	}
+
+	changed := false
+	includes, _ := contents["include"].([]any)
+	for i, f := range jsonFactory.Include {
+		fileBytes, path, location, err := fileSearch(p.holder.authBody, f.URI, mainPath, factoryPaths, p.holder.importOpts)
+		if err != nil {
+			return nil, fmt.Errorf("0067 error finding the include %s of %s: %v", f.URI, file, err)
+		}
+
+		alias := parent + f.Name
+		_, isFactory := p.holder.importedFactories[alias]
+		parents := factoryPaths
+		if !slices.Contains(parents, path) {
+			parents = append(parents, path)
+		}
+
+		remote := strings.Contains(location, "://")
+		// local files are pinned first, as
+		// it changes the contents of the file
+		if !remote {
+			if isFactory {
+				fileBytes, err = p.factory(fileBytes, location, path, alias+".", parents)
+			} else {
+				fileBytes, err = p.widget(fileBytes, location)
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		// the includes of remote factories are pinned in the lock file
+		if isFactory {
+			if err := p.remoteFactory(fileBytes, location, path, alias+".", parents); err != nil {
+				return nil, err
+			}
+		}
+
+		include, ok := includes[i].(map[string]any)
+		if !ok || f.SHA256 != "" {
+			// pinned files have been checked by FileImport
+			continue
+		}
+
+		include["sha256"] = sha256Hex(fileBytes)
+		p.pinned = append(p.pinned, PinnedFile{File: file, URI: f.URI, SHA256: include["sha256"].(string)})
+		changed = true
+	}
+
+	for key, val := range contents {
+		if key == "include" || key == "generate" {
+			continue
+		}
+
+		assetChange, err := walkAssets(val, p.asset(file))
+		if err != nil {
+			return nil, err
+		}
+		changed = changed || assetChange
+	}
+
+	if !changed {
+		return factoryBytes, nil
+	}
+
+	return writePinned(file, contents)
+}
+
+// remoteFactory adds the hashes of the includes of a remote factory
+// to the pin lock, as remote factories can not be rewritten.
+func (p *pinner) remoteFactory(factoryBytes []byte, file, mainPath, parent string, factoryPaths []string) error {
+	var jsonFactory factory
+	if err := yaml.Unmarshal(factoryBytes, &jsonFactory); err != nil {
+		return fmt.Errorf("0067 error parsing %s: %v", file, err)
+	}
+
+	for _, f := range jsonFactory.Include {
+		fileBytes, path, location, err := fileSearch(p.holder.authBody, f.URI, mainPath, factoryPaths, p.holder.importOpts)
+		if err != nil {
+			return fmt.Errorf("0067 error finding the include %s of %s: %v", f.URI, file, err)
+		}
+
+		alias := parent + f.Name
+		if _, ok := p.holder.importedFactories[alias]; ok {
+			parents := factoryPaths
+			if !slices.Contains(parents, path) {
+				parents = append(parents, path)
+			}
+			if err := p.remoteFactory(fileBytes, location, path, alias+".", parents); err != nil {
+				return err
+			}
+		}
+
+		// pinned files have been checked by FileImport
+		_, locked := p.lock.Includes[location]
+		if f.SHA256 != "" || locked || !strings.Contains(location, "://") {
+			continue
+		}
+
+		p.lock.Includes[location] = sha256Hex(fileBytes)
+		p.pinned = append(p.pinned, PinnedFile{File: p.lockFile, URI: location, SHA256: p.lock.Includes[location]})
+	}
+
+	return nil
+}
+
+// widget pins the assets of a local widget, writing the widget if it changed.
+func (p *pinner) widget(widgetBytes []byte, file string) ([]byte, error) {
+	var contents map[string]any
+	if err := yaml.Unmarshal(widgetBytes, &contents); err != nil {
+		return nil, fmt.Errorf("0067 error parsing %s: %v", file, err)
+	}
+
+	changed, err := walkAssets(contents, p.asset(file))
+	if err != nil || !changed {
+		return widgetBytes, err
+	}
+
+	return writePinned(file, contents)
+}
+
+// asset returns a function that pins remote assets with a sha256 url fragment.
+// Pinned assets are checked when they are fetched.
+func (p *pinner) asset(file string) func(uri string) (string, error) {
+	return func(uri string) (string, error) {
+		if !strings.Contains(uri, "://") || strings.Contains(uri, "{{") || strings.Contains(uri, "${") {
+			return uri, nil
+		}
+
+		data, err := p.holder.authBody.Decode(uri)
+		if err != nil {
+			return "", fmt.Errorf("0067 error fetching %s: %v", uri, err)
+		}
+
+		if _, pin := credentials.SplitPin(uri); pin != "" {
+			return uri, nil
+		}
+
+		sum := sha256Hex(data)
+		p.pinned = append(p.pinned, PinnedFile{File: file, URI: uri, SHA256: sum})
+
+		return uri + credentials.PinFragment + sum, nil
+	}
+}
+
+// writePinned writes a pinned file, yaml files are kept as yaml
+func writePinned(file string, contents map[string]any) ([]byte, error) {
+	var out []byte
+	var err error
+	if ext := filepath.Ext(file); ext == ".yaml" || ext == ".yml" {
+		out, err = yaml.Marshal(contents)
+	} else {
+		out, err = bundleMarshal(contents)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("0067 error writing %s: %v", file, err)
+	}
+
+	if err := os.WriteFile(file, out, 0644); err != nil {
+		return nil, fmt.Errorf("0067 error writing %s: %v", file, err)
+	}
+
+	return out, nil
+}
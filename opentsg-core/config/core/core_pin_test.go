@@ -0,0 +1,126 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrmxf/opentsg-modules/opentsg-core/credentials"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPin(t *testing.T) {
+	remoteWidget := `{"props": {"type": "test.remote"}, "text": ["remote"]}`
+	libraryWidget := `{"props": {"type": "test.library"}, "text": ["library"]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/widgets/remote.json":
+			w.Write([]byte(remoteWidget))
+		case "/library/frame.json":
+			w.Write([]byte(`{"include": [{"uri": "http://` + r.Host + `/library/box.json", "name": "box"}], "create": [{"box": {}}]}`))
+		case "/library/box.json":
+			w.Write([]byte(libraryWidget))
+		case "/fonts/web.ttf":
+			w.Write([]byte("font bytes"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	factoryJSON, _ := json.Marshal(map[string]any{
+		"include": []any{map[string]any{"uri": "text.json", "name": "text", "args": []string{}},
+			map[string]any{"uri": server.URL + "/widgets/remote.json", "name": "remote", "args": []string{}}},
+		"create": []any{map[string]any{"text": map[string]any{}, "remote": map[string]any{}}},
+	})
+	widget, _ := json.Marshal(map[string]any{"props": map[string]any{"type": "test.text"}, "font": server.URL + "/fonts/web.ttf"})
+	os.WriteFile(filepath.Join(dir, "pin.json"), factoryJSON, 0644)
+	os.WriteFile(filepath.Join(dir, "text.json"), widget, 0644)
+
+	pinned, err := Pin(filepath.Join(dir, "pin.json"), "")
+
+	var pinnedFactory factory
+	var pinnedWidget map[string]any
+	factoryBytes, _ := os.ReadFile(filepath.Join(dir, "pin.json"))
+	widgetBytes, _ := os.ReadFile(filepath.Join(dir, "text.json"))
+	json.Unmarshal(factoryBytes, &pinnedFactory)
+	json.Unmarshal(widgetBytes, &pinnedWidget)
+
+	_, _, importErr := FileImport(filepath.Join(dir, "pin.json"), "", false)
+	repinned, repinErr := Pin(filepath.Join(dir, "pin.json"), "")
+
+	Convey("Checking a factory tree is pinned", t, func() {
+		Convey("using a factory with a remote widget include and a local widget with a remote font", func() {
+			Convey("the include has a sha256 and the font has a sha256 fragment, which are valid when imported", func() {
+				So(err, ShouldBeNil)
+				So(len(pinned), ShouldEqual, 2)
+				So(pinnedFactory.Include[1].SHA256, ShouldEqual, sha256Hex([]byte(remoteWidget)))
+				So(pinnedFactory.Include[0].SHA256, ShouldBeEmpty)
+				So(pinnedWidget["font"], ShouldEqual, server.URL+"/fonts/web.ttf"+credentials.PinFragment+sha256Hex([]byte("font bytes")))
+				So(importErr, ShouldBeNil)
+				So(repinErr, ShouldBeNil)
+				So(repinned, ShouldBeEmpty)
+			})
+		})
+	})
+
+	// the remote file changes after it was pinned
+	remoteWidget = `{"props": {"type": "test.remote"}, "text": ["changed"]}`
+	_, _, changedErr := FileImport(filepath.Join(dir, "pin.json"), "", false)
+	_, pinErr := Pin(filepath.Join(dir, "pin.json"), "")
+	expected := fmt.Errorf("0067 integrity check failed for %s, expected a sha256 of %s and got %s, included by %s",
+		server.URL+"/widgets/remote.json", pinnedFactory.Include[1].SHA256, sha256Hex([]byte(remoteWidget)), filepath.Join(dir, "pin.json"))
+
+	Convey("Checking pinned files that have changed are rejected", t, func() {
+		Convey("using a remote include that has changed since it was pinned", func() {
+			Convey("an error is returned when the factory is imported or pinned", func() {
+				So(changedErr, ShouldResemble, expected)
+				So(pinErr, ShouldResemble, expected)
+			})
+		})
+	})
+
+	libDir := t.TempDir()
+	libFactory, _ := json.Marshal(map[string]any{
+		"include": []any{map[string]any{"uri": server.URL + "/library/frame.json", "name": "library"}},
+		"create":  []any{map[string]any{"library": map[string]any{}}},
+	})
+	os.WriteFile(filepath.Join(libDir, "library.json"), libFactory, 0644)
+
+	libPinned, libErr := Pin(filepath.Join(libDir, "library.json"), "")
+	var lock PinLock
+	lockBytes, _ := os.ReadFile(filepath.Join(libDir, PinLockFile))
+	json.Unmarshal(lockBytes, &lock)
+	_, _, libImportErr := FileImport(filepath.Join(libDir, "library.json"), "", false)
+
+	Convey("Checking the includes of remote factories are pinned", t, func() {
+		Convey("using a factory that includes a remote factory with a remote widget include", func() {
+			Convey("the remote factory is pinned in the factory and its include is pinned in the lock file", func() {
+				So(libErr, ShouldBeNil)
+				So(len(libPinned), ShouldEqual, 2)
+				So(lock.Includes, ShouldResemble, map[string]string{server.URL + "/library/box.json": sha256Hex([]byte(libraryWidget))})
+				So(libImportErr, ShouldBeNil)
+			})
+		})
+	})
+
+	// a sub file of the library changes after it was pinned
+	libraryWidget = `{"props": {"type": "test.library"}, "text": ["changed"]}`
+	_, _, libChangedErr := FileImport(filepath.Join(libDir, "library.json"), "", false)
+	libExpected := fmt.Errorf("0067 integrity check failed for %s, expected a sha256 of %s and got %s, pinned in %s, included by %s",
+		server.URL+"/library/box.json", lock.Includes[server.URL+"/library/box.json"], sha256Hex([]byte(libraryWidget)),
+		PinLockFile, server.URL+"/library/frame.json")
+
+	Convey("Checking the includes of remote factories that have changed are rejected", t, func() {
+		Convey("using a remote factory include that has changed since it was pinned", func() {
+			Convey("an error is returned when the factory is imported", func() {
+				So(libChangedErr, ShouldResemble, libExpected)
+			})
+		})
+	})
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// sweep expands lists of parameters into frames,
+// with a frame for each combination of the parameters.
+type sweep struct {
+	// Params are the named lists of values, the order
+	// they are declared is the order they are swept.
+	Params []sweepParam `json:"params" yaml:"params"`
+	// Mode is "product" for every combination of the values, or
+	// "zip" for the values at the same position of every list.
+	// The default is "product".
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	// Targets are the create aliases the parameters are set on,
+	// these are used as metadata if they match the include args.
+	Targets []string `json:"targets" yaml:"targets"`
+	// Base is the create update each combination is added to
+	Base map[string]map[string]any `json:"base,omitempty" yaml:"base,omitempty"`
+}
+
+// sweepParam is a named list of values
+type sweepParam struct {
+	Name   string `json:"name" yaml:"name"`
+	Values []any  `json:"values" yaml:"values"`
+}
+
+// sweepNameReg finds the characters that are not
+// used in the sweep name, so it can be used in file names.
+var sweepNameReg = regexp.MustCompile(`[^\w.-]+`)
+
+// creates generates the create update for every combination of the sweep,
+// and the sweepname and sweepindex metadata of each combination.
+func (s *sweep) creates(factoryPath string) ([]map[string]map[string]any, []map[string]string, error) {
+	if s == nil {
+		return nil, nil, nil
+	}
+
+	if len(s.Params) == 0 {
+		return nil, nil, fmt.Errorf("0063 the sweep in %s has no params", factoryPath)
+	}
+
+	if len(s.Targets) == 0 {
+		return nil, nil, fmt.Errorf("0063 the sweep in %s has no targets", factoryPath)
+	}
+
+	for _, p := range s.Params {
+		if p.Name == "" || len(p.Values) == 0 {
+			return nil, nil, fmt.Errorf("0063 every sweep param requires a name and at least one value in %s", factoryPath)
+		}
+	}
+
+	var combinations [][]any
+	switch s.Mode {
+	case "", "product":
+		combinations = [][]any{{}}
+		// the first param changes the slowest
+		for _, p := range s.Params {
+			next := make([][]any, 0, len(combinations)*len(p.Values))
+			for _, comb := range combinations {
+				for _, v := range p.Values {
+					next = append(next, append(comb[:len(comb):len(comb)], v))
+				}
+			}
+			combinations = next
+		}
+	case "zip":
+		length := len(s.Params[0].Values)
+		for _, p := range s.Params {
+			if len(p.Values) != length {
+				return nil, nil, fmt.Errorf("0063 the zipped sweep params in %s are not the same length, %s has %v values and %s has %v", factoryPath,
+					s.Params[0].Name, length, p.Name, len(p.Values))
+			}
+		}
+
+		for i := range length {
+			comb := make([]any, len(s.Params))
+			for j, p := range s.Params {
+				comb[j] = p.Values[i]
+			}
+			combinations = append(combinations, comb)
+		}
+	default:
+		return nil, nil, fmt.Errorf("0063 unknown sweep mode \"%s\" in %s, only product and zip are available", s.Mode, factoryPath)
+	}
+
+	creates := make([]map[string]map[string]any, len(combinations))
+	tokens := make([]map[string]string, len(combinations))
+	for i, comb := range combinations {
+		// copy the base so every combination starts the same
+		create, err := copyBase(s.Base)
+		if err != nil {
+			return nil, nil, fmt.Errorf("0063 error copying the base of the sweep in %s: %v", factoryPath, err)
+		}
+
+		names := make([]string, len(comb))
+		for _, target := range s.Targets {
+			update, ok := create[target]
+			if !ok {
+				update = make(map[string]any)
+				create[target] = update
+			}
+
+			for j, p := range s.Params {
+				update[p.Name] = comb[j]
+			}
+		}
+
+		for j, v := range comb {
+			names[j] = strings.Trim(sweepNameReg.ReplaceAllString(fmt.Sprint(v), "-"), "-")
+		}
+
+		creates[i] = create
+		tokens[i] = map[string]string{"sweepname": strings.Join(names, "_"), "sweepindex": intToLength(i, 4)}
+	}
+
+	return creates, tokens, nil
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSweep(t *testing.T) {
+
+	sweeps := []string{"./testdata/sweep/sweep.json", "./testdata/sweep/zip.json"}
+	expected := [][]map[string]any{
+		{
+			{"label": "none-8", "file": "first.png"},
+			{"label": "rec709-10", "file": "out-rec709_10-0000.png", "size": "large"},
+			{"label": "rec709-12", "file": "out-rec709_12-0001.png", "size": "large"},
+			{"label": "rec2020-10", "file": "out-rec2020_10-0002.png", "size": "large"},
+			{"label": "rec2020-12", "file": "out-rec2020_12-0003.png", "size": "large"},
+		},
+		{
+			{"label": "rec709-10", "file": "out-rec709_10-0000.png"},
+			{"label": "p3 d65-12", "file": "out-p3-d65_12-0001.png"},
+		},
+	}
+
+	for i, sw := range sweeps {
+		c, frames, importErr := FileImport(sw, "", false)
+
+		Convey("Checking sweeps create a frame for each combination", t, func() {
+			Convey(fmt.Sprintf("using %s as the input factory", sw), func() {
+				Convey(fmt.Sprintf("%v frames are created", len(expected[i])), func() {
+					So(importErr, ShouldBeNil)
+					So(frames, ShouldEqual, len(expected[i]))
+				})
+			})
+		})
+
+		for j := 0; j < frames; j++ {
+			n, errs := FrameWidgetsGeneratorHandle(c, j)
+			widget := map[string]any{}
+			if len(errs) == 0 {
+				yaml.Unmarshal(n.Value(baseKey).(map[string]WidgetContents)["frame.box"].Data, &widget)
+				delete(widget, "props")
+			}
+
+			Convey("Checking the sweep parameters are used as metadata", t, func() {
+				Convey(fmt.Sprintf("using frame %v of %s", j, sw), func() {
+					Convey("the widget has the parameters and sweep names of the frame", func() {
+						So(errs, ShouldBeEmpty)
+						So(widget, ShouldResemble, expected[i][j])
+					})
+				})
+			})
+		}
+	}
+
+	badZip, _ := filepath.Abs("./testdata/sweep/badzip.json")
+	_, _, badErr := FileImport(badZip, "", false)
+
+	Convey("Checking zipped sweeps require lists of the same length", t, func() {
+		Convey("using a zipped sweep of 2 and 3 values", func() {
+			Convey("an error is returned", func() {
+				So(badErr, ShouldResemble, fmt.Errorf("0063 the zipped sweep params in %s are not the same length, colorSpace has 2 values and bitDepth has 3", badZip))
+			})
+		})
+	})
+}
@@ -0,0 +1,285 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mrmxf/opentsg-modules/opentsg-core/credentials"
+	"gopkg.in/yaml.v3"
+)
+
+// table is a data table file, where each row of
+// the table is used to create a frame.
+type table struct {
+	URI string `json:"uri" yaml:"uri"`
+	// Format is "csv", "tsv" or "jsonl", if it is not
+	// given the file extension is used.
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+	// Base is the create update each row is added to
+	Base map[string]map[string]any `json:"base,omitempty" yaml:"base,omitempty"`
+	// Columns map the column names to the create updates
+	Columns map[string]tableColumn `json:"columns" yaml:"columns"`
+	// Where filters the rows, only rows where every
+	// column matches one of the values are used.
+	Where map[string][]string `json:"where,omitempty" yaml:"where,omitempty"`
+}
+
+// tableColumn is where a column is placed in the create update
+type tableColumn struct {
+	// Alias is the create key the column updates,
+	// e.g. "frame" or "frame.canvas"
+	Alias string `json:"alias" yaml:"alias"`
+	// Path is the dotpath of the value in the update
+	Path string `json:"path" yaml:"path"`
+	// Type is what the value is converted to, of "string",
+	// "number", "integer", "boolean" or "json". If no type is
+	// given then csv values are strings and json values are
+	// left as they are.
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+}
+
+// tableFormats are the table formats and their file extensions
+var tableFormats = map[string]string{".csv": "csv", ".tsv": "tsv", ".jsonl": "jsonl", ".ndjson": "jsonl"}
+
+// tableCreates generates a create update for every row of the tables
+// in the generate section of the factory. Tables are searched for
+// relative to the factory, then in the search paths.
+func tableCreates(authBody credentials.Decoder, generates []generate, factoryPath string, opts ImportOptions) ([]map[string]map[string]any, error) {
+	var creates []map[string]map[string]any
+
+	for _, gen := range generates {
+		if gen.Table == nil {
+			continue
+		}
+
+		tab := gen.Table
+		tableBytes, _, location, err := fileSearch(authBody, tab.URI, filepath.Dir(factoryPath), []string{filepath.Dir(factoryPath)}, opts)
+		if err != nil {
+			return nil, fmt.Errorf("0058 error opening the table %s: %v", tab.URI, err)
+		}
+
+		rows, err := tab.rows(tableBytes, location)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range rows {
+			if !tab.keep(row) {
+				continue
+			}
+
+			create, err := tab.create(row, location)
+			if err != nil {
+				return nil, err
+			}
+
+			creates = append(creates, create)
+		}
+	}
+
+	return creates, nil
+}
+
+// rows extracts the rows of the table as maps of column names to values.
+// Each row has the line it was found on as the "__line" key.
+func (t *table) rows(tableBytes []byte, location string) ([]map[string]any, error) {
+	format := t.Format
+	if format == "" {
+		format = tableFormats[strings.ToLower(filepath.Ext(location))]
+	}
+
+	switch format {
+	case "csv", "tsv":
+		reader := csv.NewReader(bytes.NewReader(tableBytes))
+		if format == "tsv" {
+			reader.Comma = '\t'
+		}
+
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("0058 error reading the table %s: %v", location, err)
+		}
+
+		if len(records) == 0 {
+			return nil, fmt.Errorf("0058 the table %s has no header row", location)
+		}
+
+		header := records[0]
+		rows := make([]map[string]any, 0, len(records)-1)
+		for i, rec := range records[1:] {
+			row := map[string]any{"__line": i + 2}
+			for j, col := range header {
+				if j < len(rec) {
+					row[strings.TrimSpace(col)] = rec[j]
+				}
+			}
+			rows = append(rows, row)
+		}
+
+		return rows, nil
+	case "jsonl":
+		var rows []map[string]any
+		scanner := bufio.NewScanner(bytes.NewReader(tableBytes))
+		// allow for long lines of json
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		line := 0
+		for scanner.Scan() {
+			line++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+
+			row := map[string]any{}
+			if err := json.Unmarshal([]byte(text), &row); err != nil {
+				return nil, fmt.Errorf("0058 error reading line %v of the table %s: %v", line, location, err)
+			}
+			row["__line"] = line
+			rows = append(rows, row)
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("0058 error reading the table %s: %v", location, err)
+		}
+
+		return rows, nil
+	default:
+		return nil, fmt.Errorf("0058 unknown table format \"%s\" for %s, only csv, tsv and jsonl are available", format, location)
+	}
+}
+
+// keep returns if the row matches the where filter of the table
+func (t *table) keep(row map[string]any) bool {
+	for col, values := range t.Where {
+		val, ok := row[col]
+		if !ok || !slices.Contains(values, fmt.Sprint(val)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// copyBase deep copies the base create update of a table or sweep,
+// so the updates made from it do not share any maps.
+func copyBase(base map[string]map[string]any) (map[string]map[string]any, error) {
+	create := make(map[string]map[string]any)
+	if base == nil {
+		return create, nil
+	}
+
+	baseBytes, _ := yaml.Marshal(base)
+	if err := yaml.Unmarshal(baseBytes, &create); err != nil {
+		return nil, err
+	}
+
+	return create, nil
+}
+
+// create makes the create update of a row
+func (t *table) create(row map[string]any, location string) (map[string]map[string]any, error) {
+	// copy the base so every row starts the same
+	create, err := copyBase(t.Base)
+	if err != nil {
+		return nil, fmt.Errorf("0058 error copying the base of the table %s: %v", location, err)
+	}
+
+	// the columns are added in order so errors are consistent
+	cols := make([]string, 0, len(t.Columns))
+	for col := range t.Columns {
+		cols = append(cols, col)
+	}
+	slices.Sort(cols)
+
+	for _, col := range cols {
+		mapping := t.Columns[col]
+		raw, ok := row[col]
+		if !ok {
+			return nil, fmt.Errorf("0058 the column %s was not found on line %v of the table %s", col, row["__line"], location)
+		}
+
+		value, err := coerce(raw, mapping.Type)
+		if err != nil {
+			return nil, fmt.Errorf("0058 the column %s on line %v of the table %s %v", col, row["__line"], location, err)
+		}
+
+		update, ok := create[mapping.Alias]
+		if !ok {
+			update = make(map[string]any)
+			create[mapping.Alias] = update
+		}
+
+		if err := set(update, strings.Split(mapping.Path, "."), value, mapping.Alias); err != nil {
+			return nil, err
+		}
+	}
+
+	return create, nil
+}
+
+// coerce converts a table value to the type
+func coerce(value any, valueType string) (any, error) {
+	str, isString := value.(string)
+	if !isString {
+		str = fmt.Sprint(value)
+	}
+
+	switch valueType {
+	case "":
+		return value, nil
+	case "string":
+		return str, nil
+	case "number":
+		if !isString {
+			if f, ok := value.(float64); ok {
+				return f, nil
+			}
+		}
+
+		f, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+		if err != nil {
+			return nil, fmt.Errorf("can not be converted to a number: %v", str)
+		}
+
+		return f, nil
+	case "integer":
+		i, err := strconv.Atoi(strings.TrimSpace(str))
+		if err != nil {
+			// json numbers are floats
+			f, ferr := strconv.ParseFloat(strings.TrimSpace(str), 64)
+			if ferr != nil || f != float64(int(f)) {
+				return nil, fmt.Errorf("can not be converted to an integer: %v", str)
+			}
+			i = int(f)
+		}
+
+		return i, nil
+	case "boolean":
+		b, err := strconv.ParseBool(strings.TrimSpace(str))
+		if err != nil {
+			return nil, fmt.Errorf("can not be converted to a boolean: %v", str)
+		}
+
+		return b, nil
+	case "json":
+		if !isString {
+			return value, nil
+		}
+
+		var v any
+		if err := yaml.Unmarshal([]byte(str), &v); err != nil {
+			return nil, fmt.Errorf("can not be converted from json: %v", err)
+		}
+
+		return v, nil
+	default:
+		return nil, fmt.Errorf("has an unknown type \"%s\", only string, number, integer, boolean and json are available", valueType)
+	}
+}
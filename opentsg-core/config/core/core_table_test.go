@@ -0,0 +1,72 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTableFrames(t *testing.T) {
+
+	predictedValues := []string{"./testdata/frame_generate/results/blue.yaml", "./testdata/frame_generate/results/green.yaml"}
+
+	for _, table := range []string{"csv", "tsv", "jsonl"} {
+		inputFile := fmt.Sprintf("./testdata/table/table_%s.json", table)
+		c, frames, err := FileImport(inputFile, "", false)
+
+		Convey("Checking frames are created from the rows of data tables", t, func() {
+			Convey(fmt.Sprintf("using %s, with a %s table of three rows where one row is filtered out", inputFile, table), func() {
+				Convey("two frames are generated", func() {
+					So(err, ShouldBeNil)
+					So(frames, ShouldEqual, 2)
+				})
+			})
+		})
+
+		for i, pv := range predictedValues {
+			n, _ := FrameWidgetsGeneratorHandle(c, i)
+			expec, got := genHash(n, pv)
+
+			Convey("Checking the frames created from tables match the frames created by hand", t, func() {
+				Convey(fmt.Sprintf("using frame %v of %s", i, inputFile), func() {
+					Convey("The generated widget map as a json body matches "+pv, func() {
+						So(expec.Sum(nil), ShouldResemble, got.Sum(nil))
+					})
+				})
+			})
+		}
+	}
+
+	c, frames, err := FileImport("./testdata/table/table_types.json", "", false)
+	var creates []map[string]map[string]any
+	if err == nil {
+		creates = c.Value(updates).(factory).Create
+	}
+
+	Convey("Checking table values are converted to their types", t, func() {
+		Convey("using a table with a base update, an integer column and a string column, after a created frame", func() {
+			Convey("every row is a frame after the created frame, with the converted values added to the base", func() {
+				So(err, ShouldBeNil)
+				So(frames, ShouldEqual, 4)
+				So(creates[1], ShouldResemble, map[string]map[string]any{
+					"frame":        {"swatchType": "blue"},
+					"frame.canvas": {"frameSize": map[string]any{"w": 1920}, "metadata": map[string]any{"enabled": "yes"}},
+				})
+				So(creates[3]["frame.canvas"]["frameSize"], ShouldResemble, map[string]any{"w": 3840})
+			})
+		})
+	})
+
+	_, _, badErr := FileImport("./testdata/table/table_badtype.json", "", false)
+
+	Convey("Checking table values that can not be converted return an error", t, func() {
+		Convey("using a table with a text column that is converted to a number", func() {
+			Convey("an error with the line of the value is returned", func() {
+				So(badErr, ShouldNotBeNil)
+				So(badErr.Error(), ShouldStartWith, "0058 the column swatch on line 2 of the table ")
+				So(badErr.Error(), ShouldEndWith, "matrix.csv can not be converted to a number: blue")
+			})
+		})
+	})
+}
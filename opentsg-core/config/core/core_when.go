@@ -0,0 +1,93 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+
+	"github.com/mrmxf/opentsg-modules/opentsg-core/middleware"
+	"gopkg.in/yaml.v3"
+)
+
+// whenKey is the key of the conditions in a create update
+const whenKey = "when"
+
+// conditionsMet checks the when conditions of the include being targeted and
+// of the create update itself. The update is returned without its conditions.
+func (b *base) conditionsMet(createUpdate map[string]any, dotPath, parent string, defaultMetadata map[string]string) (map[string]any, bool, error) {
+	include, hasInclude := b.includeConditions[dotPath]
+	rawWhen, hasWhen := createUpdate[whenKey]
+	if !hasInclude && !hasWhen {
+		return createUpdate, true, nil
+	}
+
+	frame, _ := strconv.Atoi(defaultMetadata["framenumber"])
+	metadata := b.scopeMetadata(parent, defaultMetadata)
+
+	if hasInclude && !include.Met(frame, metadata) {
+		return createUpdate, false, nil
+	}
+
+	if !hasWhen {
+		return createUpdate, true, nil
+	}
+
+	// remove the conditions so they are not passed on as updates
+	update := maps.Clone(createUpdate)
+	delete(update, whenKey)
+
+	when, err := decodeWhen(rawWhen)
+	if err != nil {
+		return update, false, fmt.Errorf("0060 invalid when conditions for %s: %v", dotPath, err)
+	}
+
+	return update, when.Met(frame, metadata), nil
+}
+
+// decodeWhen converts the conditions of a create update to
+// a middleware.When, unknown fields are returned as errors.
+func decodeWhen(raw any) (middleware.When, error) {
+	var when middleware.When
+	whenBytes, err := yaml.Marshal(raw)
+	if err != nil {
+		return when, err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(whenBytes))
+	dec.KnownFields(true)
+	err = dec.Decode(&when)
+
+	return when, err
+}
+
+// scopeMetadata returns the metadata that has been set by
+// the parent factories, with the frame number.
+// Metadata that can not be resolved is left as it is.
+func (b *base) scopeMetadata(parent string, defaultMetadata map[string]string) map[string]any {
+	metadata := make(map[string]any)
+	for k, v := range defaultMetadata {
+		metadata[k] = v
+	}
+
+	if parent == "" {
+		return metadata
+	}
+
+	var path string
+	for i, p := range strings.Split(strings.TrimSuffix(parent, "."), ".") {
+		if i != 0 {
+			path += "."
+		}
+		path += p
+		// mustache the layer with the metadata of its parents
+		layer, err := objectMustacheUpdater(b.metadataBucket[path], metadata, path, "", defaultMetadata)
+		if err != nil {
+			layer = b.metadataBucket[path]
+		}
+		maps.Copy(metadata, layer)
+	}
+
+	return metadata
+}
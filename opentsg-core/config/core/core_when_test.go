@@ -0,0 +1,58 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v3"
+)
+
+func TestWhenConditions(t *testing.T) {
+
+	c, frames, importErr := FileImport("./testdata/when/when.json", "", false)
+	expected := []map[string]string{
+		{"flash": "none", "pattern.box": "none"},
+		{"pattern.box": "blue"},
+		{"flash": "none", "pattern.box": "none", "pattern.logo": "none"},
+		{"pattern.box": "blue", "pattern.logo": "none"},
+		{"flash": "last", "pattern.box": "none"},
+		{"pattern.box": "none"},
+	}
+
+	for i := 0; i < frames; i++ {
+		n, errs := FrameWidgetsGeneratorHandle(c, i)
+		labels := map[string]string{}
+		if len(errs) == 0 {
+			for name, wc := range n.Value(baseKey).(map[string]WidgetContents) {
+				widget := map[string]any{}
+				yaml.Unmarshal(wc.Data, &widget)
+				labels[name] = fmt.Sprint(widget["label"])
+			}
+		}
+
+		Convey("Checking when conditions enable includes and creates", t, func() {
+			Convey(fmt.Sprintf("using frame %v of a factory with frame and metadata conditions", i), func() {
+				Convey("only the widgets and updates that meet their conditions are used", func() {
+					So(importErr, ShouldBeNil)
+					So(frames, ShouldEqual, 6)
+					So(errs, ShouldBeEmpty)
+					So(labels, ShouldResemble, expected[i])
+				})
+			})
+		})
+	}
+
+	badC, _, _ := FileImport("./testdata/when/bad.json", "", false)
+	_, badErrs := FrameWidgetsGeneratorHandle(badC, 0)
+
+	Convey("Checking invalid when conditions return errors", t, func() {
+		Convey("using a factory with a misspelt frames condition", func() {
+			Convey("an error for the create update is returned", func() {
+				So(badErrs, ShouldHaveLength, 1)
+				So(badErrs[0].Error(), ShouldStartWith, "0060 invalid when conditions for box:")
+				So(badErrs[0].Error(), ShouldContainSubstring, "field frame not found")
+			})
+		})
+	})
+}
@@ -213,6 +213,20 @@ func yamlCleanse[T any](v any, fileName string) ([]byte, error) {
 	return clean, nil
 }
 
+// Position returns the file and line of a dot path key and its value, as
+// found by Liner. Values found in several places have their files and lines
+// comma separated. Empty strings are returned if the key and value are not found.
+func (j JSONLines) Position(dotPath string, value any) (file, line string) {
+	valBytes, err := yamlCleanse[any](value, dotPath)
+	if err != nil {
+		return "", ""
+	}
+
+	loc := j[xxhash.Sum64(append([]byte(dotPath), valBytes...))]
+
+	return loc.file, loc.position
+}
+
 // posAdder adds the file and line to the hash map
 func posAdder(file, header string, line int, xxh64 uint64, positions JSONLines) {
 	if prev, ok := positions[xxh64]; ok { // if similar return chains of where this is found for ease of debugging
@@ -306,3 +306,30 @@ var mockPlain = `{
     }
 	%s
 }`
+
+func TestPosition(t *testing.T) {
+	stripe, _ := os.ReadFile("./testdata/jsonlines/badstripe.json")
+
+	lines := make(JSONLines)
+	err := Liner(stripe, "./testdata/jsonlines/badstripe.json", "widget", lines)
+
+	keys := []string{"grid.alias", "text.textHeight", "grid", "text.textHeight"}
+	values := []any{"bottom", 50, map[string]any{"location": "a5:p8", "alias": "bottom"}, 51}
+	expected := []string{"72", "67", "70", ""}
+
+	for i, k := range keys {
+		file, line := lines.Position(k, values[i])
+
+		Convey("Checking the positions of keys can be found", t, func() {
+			Convey(fmt.Sprintf("using the key %s with a value of %v", k, values[i]), func() {
+				Convey(fmt.Sprintf("a line of \"%s\" is returned", expected[i]), func() {
+					So(err, ShouldBeNil)
+					So(line, ShouldEqual, expected[i])
+					if expected[i] != "" {
+						So(file, ShouldEqual, "./testdata/jsonlines/badstripe.json")
+					}
+				})
+			})
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package credentials
 
 import (
+	"io/fs"
 	"os"
 	"regexp"
 	"sync"
@@ -13,11 +14,18 @@ import (
 type Decoder struct {
 	mut           *sync.Mutex
 	authorisation map[string]token
+	// cache is nil if files are not cached
+	cache *Cache
+	// fsys is the filesystem that paths that are not urls
+	// are read from, relative to fsRoot
+	fsys   fs.FS
+	fsRoot string
 }
 
 // AuthInit generates a map of configuration objects for each of Github, Gitlab and AWS
 // based off the available user environments and user input.
 // This generates a decoder body which is used to extract bytes from websites.
+// The files are cached on disk if the OPENTSG_CACHE_DIR or OPENTSG_OFFLINE environment variables are set.
 func AuthInit(s3Profile string, keyparams ...string) (Decoder, error) {
 	var err error
 	auths := make(map[string]token)
@@ -28,6 +36,12 @@ func AuthInit(s3Profile string, keyparams ...string) (Decoder, error) {
 	var sm sync.Mutex
 	d := Decoder{authorisation: auths, mut: &sm}
 
+	cache, cacheErr := cacheFromEnv()
+	if cacheErr != nil {
+		return d, cacheErr
+	}
+	d.cache = cache
+
 	return d, err
 }
 
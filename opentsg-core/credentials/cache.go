@@ -0,0 +1,338 @@
+package credentials
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The environment variables that configure the cache
+const (
+	// EnvCacheDir is the directory of the cache
+	EnvCacheDir = "OPENTSG_CACHE_DIR"
+	// EnvCacheTTL is how long files are used before they are revalidated, e.g. 24h
+	EnvCacheTTL = "OPENTSG_CACHE_TTL"
+	// EnvCacheSize is the maximum size of the cache in bytes
+	EnvCacheSize = "OPENTSG_CACHE_SIZE"
+	// EnvOffline only uses the cache when it is true
+	EnvOffline = "OPENTSG_OFFLINE"
+)
+
+// Cache is an on disk cache of the remote files that are decoded.
+type Cache struct {
+	// Dir is the directory the files are cached in
+	Dir string
+	// TTL is how long a file is used for before it is revalidated,
+	// http files are revalidated with their ETag and Last-Modified headers,
+	// other files are fetched again.
+	TTL time.Duration
+	// MaxSize is the maximum size of the cached files in bytes,
+	// the least recently used files are removed first. 0 is no limit.
+	MaxSize int64
+	// Offline only returns files from the cache, a file that is
+	// not in the cache returns an error.
+	Offline bool
+}
+
+// cacheEntry is the metadata of a cached file
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+}
+
+// SetCache sets the cache the decoder uses, a nil cache turns the cache off.
+func (d *Decoder) SetCache(cache *Cache) {
+	d.cache = cache
+}
+
+// cacheFromEnv returns the cache set by the environment variables,
+// nil is returned if the cache directory and offline mode are not set.
+// Offline mode without a directory uses the user cache directory.
+func cacheFromEnv() (*Cache, error) {
+	cache := Cache{Dir: os.Getenv(EnvCacheDir)}
+
+	if offline := os.Getenv(EnvOffline); offline != "" {
+		var err error
+		cache.Offline, err = strconv.ParseBool(offline)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s of %s: %v", EnvOffline, offline, err)
+		}
+	}
+
+	if cache.Dir == "" && !cache.Offline {
+		return nil, nil
+	}
+
+	if cache.Dir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		cache.Dir = filepath.Join(userCache, "opentsg")
+	}
+
+	if ttl := os.Getenv(EnvCacheTTL); ttl != "" {
+		var err error
+		cache.TTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s of %s: %v", EnvCacheTTL, ttl, err)
+		}
+	}
+
+	if size := os.Getenv(EnvCacheSize); size != "" {
+		var err error
+		cache.MaxSize, err = strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s of %s: %v", EnvCacheSize, size, err)
+		}
+	}
+
+	return &cache, nil
+}
+
+// get returns the file of a url from the cache, fetching
+// it if it is not cached or the cached file has expired.
+// A file that can not be written to the cache is still returned,
+// only files that are not cached in offline mode are errors.
+func (c *Cache) get(url string, fetch func(string) ([]byte, error)) ([]byte, error) {
+	entry, body, cached := c.load(url)
+
+	switch {
+	case c.Offline && !cached:
+		return nil, fmt.Errorf("offline and %s is not in the cache %s", url, c.Dir)
+	case c.Offline, cached && time.Since(entry.Fetched) < c.TTL:
+		c.touch(url)
+
+		return body, nil
+	}
+
+	// other sources do not have the headers to revalidate them
+	if !isHTTP(url) {
+		body, err := fetch(url)
+		if err != nil {
+			return nil, err
+		}
+
+		c.store(cacheEntry{URL: url, Fetched: time.Now()}, body)
+
+		return body, nil
+	}
+
+	var previous *cacheEntry
+	if cached {
+		previous = &entry
+	}
+
+	newBody, newEntry, err := httpRevalidate(url, previous)
+	switch {
+	case err != nil:
+		return nil, err
+	case newBody == nil:
+		// the file has not been modified
+		entry.Fetched = time.Now()
+		c.store(entry, nil)
+
+		return body, nil
+	}
+
+	c.store(newEntry, newBody)
+
+	return newBody, nil
+}
+
+// httpRevalidate gets a http file, with the ETag and Last-Modified
+// of the cached entry. A nil body is returned if the file was not modified.
+func httpRevalidate(url string, cached *cacheEntry) ([]byte, cacheEntry, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, cacheEntry{}, err
+	}
+
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, cacheEntry{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return nil, *cached, nil
+	} else if resperr := repsonseHelper(resp); resperr != nil {
+		return nil, cacheEntry{}, resperr
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, cacheEntry{}, err
+	}
+
+	return body, cacheEntry{URL: url, ETag: resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"), Fetched: time.Now()}, nil
+}
+
+// isHTTP checks if the url is fetched with a plain http request
+func isHTTP(url string) bool {
+	return !regGitL.MatchString(url) && !regGitAPI.MatchString(url) &&
+		!regGitH.MatchString(url) && !regGitHbAPI.MatchString(url) &&
+		!regS3.MatchString(url) && !regS3AWS.MatchString(url)
+}
+
+// path returns the path of the cached file of a url,
+// the metadata is stored alongside it with a .json extension.
+func (c *Cache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:]))
+}
+
+// load returns the metadata and file of a url, and if it was cached
+func (c *Cache) load(url string) (cacheEntry, []byte, bool) {
+	var entry cacheEntry
+	meta, err := os.ReadFile(c.path(url) + ".json")
+	if err != nil || json.Unmarshal(meta, &entry) != nil || entry.URL != url {
+		return entry, nil, false
+	}
+
+	body, err := os.ReadFile(c.path(url))
+	if err != nil {
+		return entry, nil, false
+	}
+
+	return entry, body, true
+}
+
+// store writes the metadata and file of a url to the cache,
+// the file is not written if the body is nil.
+func (c *Cache) store(entry cacheEntry, body []byte) error {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return fmt.Errorf("error making the cache %s: %v", c.Dir, err)
+	}
+
+	file := c.path(entry.URL)
+	if body != nil {
+		if err := writeAtomic(file, body); err != nil {
+			return err
+		}
+	}
+
+	meta, _ := json.Marshal(entry)
+	if err := writeAtomic(file+".json", meta); err != nil {
+		return err
+	}
+
+	c.touch(entry.URL)
+
+	return c.trim(file)
+}
+
+// touch marks a file as used, so it is not
+// removed before files that have not been used
+func (c *Cache) touch(url string) {
+	now := time.Now()
+	os.Chtimes(c.path(url), now, now)
+}
+
+// trim removes the least recently used files until the cache is
+// smaller than the maximum size. The file that was just added is kept.
+func (c *Cache) trim(keep string) error {
+	if c.MaxSize <= 0 {
+		return nil
+	}
+
+	dirEntries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return fmt.Errorf("error reading the cache %s: %v", c.Dir, err)
+	}
+
+	type cachedFile struct {
+		path string
+		size int64
+		used time.Time
+	}
+
+	var files []cachedFile
+	var total int64
+	for _, de := range dirEntries {
+		if de.IsDir() || strings.HasSuffix(de.Name(), ".json") || strings.HasSuffix(de.Name(), ".tmp") {
+			continue
+		}
+
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+
+		files = append(files, cachedFile{path: filepath.Join(c.Dir, de.Name()), size: info.Size(), used: info.ModTime()})
+		total += info.Size()
+	}
+
+	slices.SortFunc(files, func(a, b cachedFile) int { return a.used.Compare(b.used) })
+
+	for _, f := range files {
+		if total <= c.MaxSize {
+			break
+		}
+
+		if f.path == keep {
+			continue
+		}
+
+		os.Remove(f.path + ".json")
+		if err := os.Remove(f.path); err != nil {
+			return fmt.Errorf("error removing %s from the cache: %v", f.path, err)
+		}
+		total -= f.size
+	}
+
+	return nil
+}
+
+// writeAtomic writes a file via a temporary file, so
+// a partly written file is never read from the cache.
+// Every writer has its own temporary file, so the render nodes
+// that share a cache do not write over each other.
+func writeAtomic(file string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error writing to the cache: %v", err)
+	}
+	// the temporary file is gone once it is renamed
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// temporary files are only readable by their owner
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing to the cache: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("error writing to the cache: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package credentials
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCache(t *testing.T) {
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/missing.json" {
+			http.NotFound(w, r)
+			return
+		}
+
+		etag := `"` + r.URL.Path + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte("file " + r.URL.Path))
+	}))
+
+	decoder, _ := AuthInit("")
+	decoder.SetCache(&Cache{Dir: t.TempDir()})
+
+	first, firstErr := decoder.Decode(server.URL + "/a.json")
+	second, secondErr := decoder.Decode(server.URL + "/a.json")
+
+	Convey("Checking http files are revalidated with the cache", t, func() {
+		Convey("using a cache with no ttl and a server that sends an ETag", func() {
+			Convey("the file is requested again and the cached file is used when it is not modified", func() {
+				So(firstErr, ShouldBeNil)
+				So(secondErr, ShouldBeNil)
+				So(string(first), ShouldEqual, "file /a.json")
+				So(second, ShouldResemble, first)
+				So(requests, ShouldEqual, 2)
+				So(notModified, ShouldEqual, 1)
+			})
+		})
+	})
+
+	dir := t.TempDir()
+	decoder.SetCache(&Cache{Dir: dir, TTL: time.Hour})
+	requests = 0
+	decoder.Decode(server.URL + "/b.json")
+	ttlBody, ttlErr := decoder.Decode(server.URL + "/b.json")
+	_, missingErr := decoder.Decode(server.URL + "/missing.json")
+
+	Convey("Checking files are not requested before their ttl has passed", t, func() {
+		Convey("using a cache with a ttl of an hour", func() {
+			Convey("the file is only requested once and errors are not cached", func() {
+				So(ttlErr, ShouldBeNil)
+				So(string(ttlBody), ShouldEqual, "file /b.json")
+				So(requests, ShouldEqual, 2)
+				So(missingErr, ShouldNotBeNil)
+			})
+		})
+	})
+
+	server.Close()
+	decoder.SetCache(&Cache{Dir: dir, Offline: true})
+	offlineBody, offlineErr := decoder.Decode(server.URL + "/b.json")
+	_, missErr := decoder.Decode(server.URL + "/c.json")
+
+	Convey("Checking offline mode only uses the cache", t, func() {
+		Convey("using a cached file and an uncached file after the server has closed", func() {
+			Convey("the cached file is returned and the uncached file returns an error", func() {
+				So(offlineErr, ShouldBeNil)
+				So(string(offlineBody), ShouldEqual, "file /b.json")
+				So(missErr, ShouldResemble, fmt.Errorf("offline and %s/c.json is not in the cache %s", server.URL, dir))
+			})
+		})
+	})
+
+	// a file in place of the directory means nothing can be cached
+	blocked := filepath.Join(t.TempDir(), "cache")
+	os.WriteFile(blocked, []byte("not a directory"), 0644)
+	decoder.SetCache(&Cache{Dir: blocked, TTL: time.Hour})
+	blockedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("uncached"))
+	}))
+	blockedBody, blockedErr := decoder.Decode(blockedServer.URL + "/a.json")
+	blockedServer.Close()
+
+	Convey("Checking files are returned when they can not be cached", t, func() {
+		Convey("using a cache directory that can not be written to", func() {
+			Convey("the fetched file is returned without an error", func() {
+				So(blockedErr, ShouldBeNil)
+				So(string(blockedBody), ShouldEqual, "uncached")
+			})
+		})
+	})
+
+	sizeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0123456789"))
+	}))
+	defer sizeServer.Close()
+
+	sizeDir := t.TempDir()
+	decoder.SetCache(&Cache{Dir: sizeDir, TTL: time.Hour, MaxSize: 25})
+	decoder.Decode(sizeServer.URL + "/1")
+	decoder.Decode(sizeServer.URL + "/2")
+	// use the first file so the second file is the oldest
+	os.Chtimes(decoder.cache.path(sizeServer.URL+"/1"), time.Now(), time.Now().Add(time.Minute))
+	decoder.Decode(sizeServer.URL + "/3")
+
+	_, _, cached1 := decoder.cache.load(sizeServer.URL + "/1")
+	_, _, cached2 := decoder.cache.load(sizeServer.URL + "/2")
+	_, _, cached3 := decoder.cache.load(sizeServer.URL + "/3")
+
+	Convey("Checking the cache is kept under its maximum size", t, func() {
+		Convey("using a cache of 25 bytes and three files of 10 bytes", func() {
+			Convey("the least recently used file is removed", func() {
+				So(cached1, ShouldBeTrue)
+				So(cached2, ShouldBeFalse)
+				So(cached3, ShouldBeTrue)
+			})
+		})
+	})
+
+	// render nodes that share a cache write the same file at once
+	sharedDir := t.TempDir()
+	sharedFile := filepath.Join(sharedDir, "shared")
+	var bodies []string
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		body := strings.Repeat(fmt.Sprintf("%v", i), 1<<16)
+		bodies = append(bodies, body)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			writeAtomic(sharedFile, []byte(body))
+		}()
+	}
+	wg.Wait()
+
+	sharedBody, sharedErr := os.ReadFile(sharedFile)
+	leftover, _ := filepath.Glob(filepath.Join(sharedDir, "*.tmp"))
+
+	Convey("Checking files written to the cache at the same time are not mixed", t, func() {
+		Convey("using 10 writers of the same file", func() {
+			Convey("the file is the whole body of one writer and no temporary files are left", func() {
+				So(sharedErr, ShouldBeNil)
+				So(bodies, ShouldContain, string(sharedBody))
+				So(leftover, ShouldBeEmpty)
+			})
+		})
+	})
+
+	t.Setenv(EnvCacheDir, sizeDir)
+	t.Setenv(EnvCacheTTL, "2h")
+	t.Setenv(EnvCacheSize, "1000")
+	envDecoder, envErr := AuthInit("")
+
+	t.Setenv(EnvCacheTTL, "a day")
+	_, badErr := AuthInit("")
+
+	Convey("Checking the cache is set with environment variables", t, func() {
+		Convey(fmt.Sprintf("using %s, %s and %s", EnvCacheDir, EnvCacheTTL, EnvCacheSize), func() {
+			Convey("the decoder has the cache and invalid values return an error", func() {
+				So(envErr, ShouldBeNil)
+				So(*envDecoder.cache, ShouldResemble, Cache{Dir: sizeDir, TTL: 2 * time.Hour, MaxSize: 1000})
+				So(badErr, ShouldNotBeNil)
+			})
+		})
+	})
+}
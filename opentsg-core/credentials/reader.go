@@ -17,11 +17,16 @@ package credentials
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
+	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 
@@ -59,6 +64,11 @@ func InitDecoder(c *context.Context, s3Profile string, httpKeys ...string) error
 	return nil
 }
 
+// AddDecoder adds a decoder to the context, to be used by the GetWebBytes function.
+func AddDecoder(c *context.Context, decoder Decoder) {
+	*c = context.WithValue(*c, credentialsAuth, decoder)
+}
+
 // GetWebBytes is a wrapper of `credentials` where the configuration body is stored in config.
 // This is to prevent several intialisations of the authbody or the data being passed around.
 func GetWebBytes(c *context.Context, uri string) ([]byte, error) {
@@ -80,10 +90,83 @@ func GetWebBytes(c *context.Context, uri string) ([]byte, error) {
 	return auth.Decode(uri)
 }
 
+// PinFragment is the url fragment that pins the sha256 hash
+// of a file, e.g. https://example.com/logo.png#sha256=<hex hash>
+const PinFragment = "#sha256="
+
+// SplitPin splits a url into the url and the sha256 of its pin fragment,
+// the hash is empty if the url is not pinned.
+func SplitPin(url string) (string, string) {
+	if i := strings.LastIndex(url, PinFragment); i != -1 {
+		return url[:i], url[i+len(PinFragment):]
+	}
+
+	return url, ""
+}
+
+// Verify checks the sha256 of the data matches the expected
+// hex hash, returning an error that names the url if it does not.
+func Verify(url string, data []byte, expected string) error {
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, expected) {
+		return fmt.Errorf("integrity check failed for %s, expected a sha256 of %s and got %s", url, expected, got)
+	}
+
+	return nil
+}
+
+// SetFS sets the filesystem that the paths that are not urls are read from,
+// such as an embed.FS. Paths are relative to the root folder of the filesystem,
+// and absolute paths are relative to the top of the filesystem.
+func (d *Decoder) SetFS(fsys fs.FS, root string) {
+	d.fsys, d.fsRoot = fsys, root
+}
+
+// FSPath returns the path of a file in a fs.FS, relative to the root folder.
+// Absolute paths are relative to the top of the filesystem.
+func FSPath(root, name string) string {
+	name = filepath.ToSlash(name)
+	if path.IsAbs(name) {
+		return strings.TrimPrefix(path.Clean(name), "/")
+	}
+
+	return path.Join(filepath.ToSlash(root), name)
+}
+
 // Decode returns the body of a url and an error if the information could not be extracted.
+// If the url has a sha256 pin fragment, then the body is only returned if its hash matches.
 func (d Decoder) Decode(url string) ([]byte, error) {
+	url, pin := SplitPin(url)
+	body, err := d.decode(url)
+	if err != nil || pin == "" {
+		return body, err
+	}
+
+	if err := Verify(url, body, pin); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// decode returns the body of a url
+func (d Decoder) decode(url string) ([]byte, error) {
 	d.mut.Lock()
 	defer d.mut.Unlock()
+
+	if d.fsys != nil && !strings.Contains(url, "://") {
+		return fs.ReadFile(d.fsys, FSPath(d.fsRoot, url))
+	}
+
+	if d.cache != nil {
+		return d.cache.get(url, d.fetch)
+	}
+
+	return d.fetch(url)
+}
+
+// fetch gets the body of a url from its source
+func (d Decoder) fetch(url string) ([]byte, error) {
 	// Insert a credentials manager
 	tokenGen := d.authorisation
 	switch {
@@ -5,6 +5,8 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"testing"
@@ -54,6 +56,30 @@ func TestDecodeHTTP(t *testing.T) {
 	}
 }
 
+func TestDecodePinned(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pinned file"))
+	}))
+	defer server.Close()
+
+	good := fmt.Sprintf("%x", sha256.Sum256([]byte("pinned file")))
+	bad := fmt.Sprintf("%x", sha256.Sum256([]byte("another file")))
+	emptyDecode, _ := AuthInit("")
+
+	body, err := emptyDecode.Decode(server.URL + "/file.json" + PinFragment + good)
+	_, badErr := emptyDecode.Decode(server.URL + "/file.json" + PinFragment + bad)
+
+	Convey("Checking pinned urls are verified", t, func() {
+		Convey("using a url with a matching sha256 pin and a url with a different pin", func() {
+			Convey("the matching file is returned and the other returns an integrity error", func() {
+				So(err, ShouldBeNil)
+				So(string(body), ShouldEqual, "pinned file")
+				So(badErr, ShouldResemble, fmt.Errorf("integrity check failed for %s/file.json, expected a sha256 of %s and got %s", server.URL, bad, good))
+			})
+		})
+	})
+}
+
 func TestDecodeGitHub(t *testing.T) {
 	// tokenB, err := os.ReadFile("./testdata/ghkey.txt")
 	token := string(ghToken)
@@ -7,14 +7,13 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
-	"image/png"
+	_ "image/png"
 	"os"
-	"regexp"
 
 	"github.com/mrmxf/opentsg-modules/opentsg-core/colour"
 	"github.com/mrmxf/opentsg-modules/opentsg-core/credentials"
 	"github.com/nfnt/resize"
-	"golang.org/x/image/tiff"
+	_ "golang.org/x/image/tiff"
 )
 
 // artkeyGen set the background of the canvas as the inputted image and generate a map of keys
@@ -26,14 +25,14 @@ func artKeyGen(c *context.Context, geomCanvas draw.Image, base string, frame Fra
 		return canvas, err
 	}
 	// extract the NRGBA64 image scaled to the canvas
-	baseImg, err := keyGen(c, base, canvas.Bounds().Max)
+	baseImg, err := keyGen(c, base, canvas.Bounds().Max, frame.Decode)
 	if err != nil {
 		return canvas, err
 	}
 
 	// add the image and then extract the locations
 	colour.Draw(canvas, canvas.Bounds(), baseImg, image.Point{}, draw.Src)
-	keys, err := imageToKeyMap(baseImg, c)
+	keys, err := imageToKeyMap(baseImg.BaseImage(), c)
 	if err != nil {
 		return canvas, err
 	}
@@ -63,50 +62,66 @@ func artToCanvas(tag string, c *context.Context) (draw.Image, image.Point, draw.
 }
 
 // key gen extracts the file from a http source then a local source
-func keyGen(c *context.Context, base string, bounds image.Point) (*image.NRGBA64, error) {
+func keyGen(c *context.Context, base string, bounds image.Point, decode func(string, []byte) (colour.Image, error)) (*colour.NRGBA64, error) {
 
 	file, err := credentials.GetWebBytes(c, base)
 	if err == nil {
-		return extract(file, base, bounds)
+		return extract(file, base, bounds, decode)
 	}
 
 	file, err = os.ReadFile(base)
 	if err == nil {
 
-		return extract(file, base, bounds)
+		return extract(file, base, bounds, decode)
 	}
 
 	return nil, fmt.Errorf("0042 error opening background image %v", err)
 
 }
 
-// extract converts the bytes to an image and scales it if required
-func extract(b []byte, fname string, bounds image.Point) (i *image.NRGBA64, e error) {
-	// assign the context to loop it out
+// extract converts the bytes to an image and scales it if required.
+// The image keeps the colour space it was decoded with.
+func extract(b []byte, fname string, bounds image.Point, decode func(string, []byte) (colour.Image, error)) (*colour.NRGBA64, error) {
+	if decode == nil {
+		decode = decodeImage
+	}
 
-	var midI image.Image
-	read := bytes.NewReader(b)
-	regTIFF := regexp.MustCompile(`^[\w\W]{1,255}\.[tT][iI][fF]{1,2}$`)
-	regPNG := regexp.MustCompile(`^[\w\W]{1,255}\.[pP][nN][gG]$`)
-	switch {
-	case regPNG.MatchString(fname):
-		midI, e = png.Decode(read)
-	case regTIFF.MatchString(fname):
-		midI, e = tiff.Decode(read)
-	default:
-		e = fmt.Errorf("0043 %v is an invalid file type", fname)
+	decoded, err := decode(fname, b)
+	if err != nil {
+		return nil, fmt.Errorf("0043 error decoding background image %v", err)
 	}
+
+	// resize the underlying image, so the resizer does
+	// not have to handle the colour space aware type
+	var midI image.Image = decoded
+	if nrgba, ok := decoded.(*colour.NRGBA64); ok {
+		midI = nrgba.BaseImage()
+	}
+
 	// resize the image to fit the canvas
 	if midI.Bounds().Max.X != bounds.X || midI.Bounds().Max.Y != bounds.Y {
 		midI = resize.Resize(uint(bounds.X), uint(bounds.Y), midI, resize.Bicubic)
 	}
-	i = image.NewNRGBA64(midI.Bounds())
-	colour.Draw(i, i.Bounds(), midI, image.Point{}, draw.Src)
-	if e != nil {
-		e = fmt.Errorf("0042 error opening background image %v", e)
+	i := colour.NewNRGBA64(decoded.Space(), midI.Bounds())
+	draw.Draw(i.BaseImage(), i.Bounds(), midI, image.Point{}, draw.Src)
+
+	return i, nil
+}
+
+// decodeImage decodes png and tiff files with an empty colour space,
+// it is used when no decoder has been given to gridgen.
+func decodeImage(fname string, b []byte) (colour.Image, error) {
+	midI, _, err := image.Decode(bytes.NewReader(b))
+	if err == image.ErrFormat {
+		return nil, fmt.Errorf("%v is an invalid file type", fname)
+	} else if err != nil {
+		return nil, err
 	}
 
-	return
+	i := colour.NewNRGBA64(colour.ColorSpace{}, midI.Bounds())
+	colour.Draw(i, i.Bounds(), midI, image.Point{}, draw.Src)
+
+	return i, nil
 }
 
 // imageToKeyMap finds the areas of transparency in an image
@@ -347,6 +347,25 @@ func (l Location) CalcArea(c *context.Context) (image.Rectangle, image.Point, er
 	return image.Rect(0, 0, width, height), tsgLocation, nil
 }
 
+// Area returns the area the box covers on a frame of frameSize,
+// that is split into a grid of rows and cols.
+func (l Location) Area(frameSize image.Point, rows, cols int) (image.Rectangle, error) {
+	if rows == 0 || cols == 0 {
+		return image.Rectangle{}, fmt.Errorf("0041 No columns or rows declared, got %v rows and %v columns", rows, cols)
+	}
+
+	c := context.WithValue(context.Background(), xkey, float64(frameSize.X)/float64(cols))
+	c = context.WithValue(c, ykey, float64(frameSize.Y)/float64(rows))
+	c = context.WithValue(c, sizekey, frameSize)
+
+	area, tsgLocation, err := l.CalcArea(&c)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+
+	return area.Add(tsgLocation), nil
+}
+
 func roundedMask(rect image.Rectangle, radius int) draw.Image {
 
 	// set up a mask
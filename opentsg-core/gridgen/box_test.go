@@ -194,6 +194,39 @@ func TestBadBox(t *testing.T) {
 	}
 }
 
+func TestArea(t *testing.T) {
+
+	locations := []Location{
+		{Box: Box{X: 0, Y: 1}},
+		{Box: Box{X: 1, Y: 1, X2: "100%", Y2: "100%"}},
+		{Box: Box{X: "27px", Y: "27px", Width: "26px", Height: "26px"}},
+	}
+	expected := []image.Rectangle{image.Rect(0, 100, 100, 200), image.Rect(100, 100, 1000, 1000), image.Rect(27, 27, 53, 53)}
+
+	for i, loc := range locations {
+		area, err := loc.Area(image.Point{1000, 1000}, 10, 10)
+		Convey("Checking the area of a box is found without a canvas", t, func() {
+			Convey(fmt.Sprintf("using a %v as the input box on a 1000x1000 frame of 10 rows and columns", loc), func() {
+				Convey(fmt.Sprintf("the area is %v", expected[i]), func() {
+					So(err, ShouldBeNil)
+					So(area, ShouldResemble, expected[i])
+				})
+			})
+		})
+	}
+
+	_, err := Location{Box: Box{UseAlias: "top"}}.Area(image.Point{1000, 1000}, 10, 10)
+	_, gridErr := Location{Box: Box{X: 0, Y: 0}}.Area(image.Point{1000, 1000}, 0, 10)
+	Convey("Checking the area of a box without coordinates is not found", t, func() {
+		Convey("using a box with an alias and a frame without rows", func() {
+			Convey("errors are returned", func() {
+				So(err, ShouldResemble, fmt.Errorf("invalid coordinates of x <nil> and y <nil> received"))
+				So(gridErr, ShouldResemble, fmt.Errorf("0041 No columns or rows declared, got 0 rows and 10 columns"))
+			})
+		})
+	})
+}
+
 func TestBoxTSIG(t *testing.T) {
 	tsigs := "./testdata/tpig/mock.json"
 
@@ -8,6 +8,8 @@ import (
 	"image/color"
 	"image/draw"
 	"math"
+	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -46,7 +48,7 @@ type FrameConfiguration struct {
 	LineWidth float64
 	// FrameSize is the size of the frame
 	FrameSize image.Point
-	// CanvasType - "ACES" or "" for default
+	// CanvasType - "ACES", "float" or "" for default
 	CanvasType string
 	// What Color is the canvas
 	CanvasFill color.Color
@@ -58,6 +60,9 @@ type FrameConfiguration struct {
 	Geometry string
 	// A path to an image file
 	BaseImage string
+	// Decode decodes the base image, if it is nil
+	// then only png and tiff files can be used.
+	Decode func(filename string, data []byte) (colour.Image, error)
 }
 
 // var rows = canvaswidget.GetGridRows
@@ -137,9 +142,12 @@ func ImageGenerator(c context.Context, canvasSize image.Rectangle) draw.Image {
 	}
 	frame := frameConfig.(FrameConfiguration)
 	// base := imageType(c)
-	if frame.CanvasType == "ACES" {
-
+	switch frame.CanvasType {
+	case "ACES":
 		return colour.NewARGBA(canvasSize)
+	case "float":
+		// float canvases keep their values until they are saved
+		return colour.NewNRGBAF32(frame.ColorSpace, canvasSize)
 	}
 
 	// space := colourSpaceType(c)
@@ -178,8 +186,16 @@ func GridGen(c *context.Context, dir string, frame FrameConfiguration) (draw.Ima
 
 	// base := baser(*c)
 	if frame.BaseImage != "" {
+		baseImage := frame.BaseImage
+		// fall back to the factory directory if the
+		// image is not relative to the working directory
+		if _, err := os.Stat(baseImage); err != nil && !filepath.IsAbs(baseImage) {
+			if _, err := os.Stat(filepath.Join(dir, baseImage)); err == nil {
+				baseImage = filepath.Join(dir, baseImage)
+			}
+		}
 
-		return artKeyGen(c, geomImg.canvas, frame.BaseImage, frame)
+		return artKeyGen(c, geomImg.canvas, baseImage, frame)
 	}
 
 	return gridGen(c, geomImg, frame)
@@ -0,0 +1,238 @@
+package gridgen
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/mrmxf/opentsg-modules/opentsg-core/colour"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+/*
+Transform is the set of transformations applied to a widget patch,
+after the widget has been generated and before it is added to the test pattern.
+
+The flips are applied first, then the scale and finally the rotation.
+All transformations are made about the centre of the patch, so the
+centre of the widget stays in the same place on the test pattern.
+*/
+type Transform struct {
+	// Rotate is the clockwise rotation in degrees
+	Rotate float64 `json:"rotate,omitempty" yaml:"rotate,omitempty"`
+	// Filter is the resampling filter used for rotations that
+	// are not a multiple of 90 degrees and for scaling.
+	// It can be "nearest", "approxbilinear", "bilinear" or "catmullrom",
+	// the default is "bilinear".
+	Filter         string `json:"filter,omitempty" yaml:"filter,omitempty"`
+	FlipHorizontal bool   `json:"flipHorizontal,omitempty" yaml:"flipHorizontal,omitempty"`
+	FlipVertical   bool   `json:"flipVertical,omitempty" yaml:"flipVertical,omitempty"`
+	// Scale is the scale factor for each axis,
+	// any factor that is not declared is 1.
+	Scale *Scale `json:"scale,omitempty" yaml:"scale,omitempty"`
+}
+
+// Scale is the x and y scale factors of a transform
+type Scale struct {
+	X float64 `json:"x,omitempty" yaml:"x,omitempty"`
+	Y float64 `json:"y,omitempty" yaml:"y,omitempty"`
+}
+
+var interpolators = map[string]xdraw.Interpolator{
+	"nearest":        xdraw.NearestNeighbor,
+	"approxbilinear": xdraw.ApproxBiLinear,
+	"bilinear":       xdraw.BiLinear,
+	"catmullrom":     xdraw.CatmullRom,
+}
+
+// IsIdentity returns true if the transform leaves
+// the patch unchanged.
+func (t Transform) IsIdentity() bool {
+	sx, sy := t.scales()
+
+	return math.Mod(t.Rotate, 360) == 0 &&
+		!t.FlipHorizontal && !t.FlipVertical && sx == 1 && sy == 1
+}
+
+// TransformArea returns the area a patch occupies on the
+// test pattern after it has been transformed.
+func (t Transform) TransformArea(area image.Rectangle) image.Rectangle {
+	if t.IsIdentity() {
+		return area
+	}
+
+	size := t.transformSize(area.Size())
+	// keep the centre in the same position
+	min := area.Min.Add(area.Size().Sub(size).Div(2))
+
+	return image.Rectangle{Min: min, Max: min.Add(size)}
+}
+
+// Apply transforms the patch and its mask, returning the transformed patch
+// and mask with bounds starting at 0,0.
+// If the mask is nil and the transformation leaves areas of the
+// patch uncovered, a mask is generated to keep those areas transparent.
+func (t Transform) Apply(patch, mask draw.Image) (draw.Image, draw.Image) {
+	if t.IsIdentity() {
+		return patch, mask
+	}
+
+	srcBounds := patch.Bounds()
+	dstBounds := image.Rectangle{Max: t.transformSize(srcBounds.Size())}
+	dst := newPatchLike(patch, dstBounds)
+
+	sx, sy := t.scales()
+	if turns, exact := t.exactTurns(); exact && sx == 1 && sy == 1 {
+		// move the pixels without any resampling
+		t.exactTransform(dst, patch, turns)
+		if mask == nil {
+			return dst, nil
+		}
+		dstMask := image.NewAlpha16(dstBounds)
+		t.exactTransform(dstMask, mask, turns)
+
+		return dst, dstMask
+	}
+
+	interp, ok := interpolators[t.Filter]
+	if !ok {
+		interp = xdraw.BiLinear
+	}
+
+	// every area not covered by the patch is to be transparent
+	if mask == nil {
+		opaque := image.NewAlpha16(srcBounds)
+		draw.Draw(opaque, srcBounds, &image.Uniform{color.Alpha16{A: 0xffff}}, image.Point{}, draw.Src)
+		mask = opaque
+	}
+
+	aff := t.affine(srcBounds, dstBounds)
+	interp.Transform(dst, aff, patch, srcBounds, xdraw.Src, nil)
+	dstMask := image.NewAlpha16(dstBounds)
+	interp.Transform(dstMask, aff, mask, srcBounds, xdraw.Src, nil)
+
+	return dst, dstMask
+}
+
+// scales returns the x and y scale factors, with
+// undeclared factors set to 1.
+func (t Transform) scales() (float64, float64) {
+	sx, sy := 1.0, 1.0
+	if t.Scale != nil {
+		if t.Scale.X != 0 {
+			sx = t.Scale.X
+		}
+		if t.Scale.Y != 0 {
+			sy = t.Scale.Y
+		}
+	}
+
+	return sx, sy
+}
+
+// exactTurns returns the number of clockwise quarter turns and
+// if the rotation is an exact multiple of 90 degrees.
+func (t Transform) exactTurns() (int, bool) {
+	angle := math.Mod(t.Rotate, 360)
+	if angle < 0 {
+		angle += 360
+	}
+
+	turns := int(angle / 90)
+
+	return turns % 4, math.Mod(angle, 90) == 0
+}
+
+// matrix returns the 2x2 matrix of the flip, scale and rotation.
+func (t Transform) matrix() [2][2]float64 {
+	sx, sy := t.scales()
+	if t.FlipHorizontal {
+		sx = -sx
+	}
+	if t.FlipVertical {
+		sy = -sy
+	}
+
+	var sin, cos float64
+	switch turns, exact := t.exactTurns(); {
+	case exact:
+		// prevent rounding errors for the common angles
+		sin, cos = [4]float64{0, 1, 0, -1}[turns], [4]float64{1, 0, -1, 0}[turns]
+	default:
+		sin, cos = math.Sincos(t.Rotate * math.Pi / 180)
+	}
+
+	// y is down in image coordinates so this rotates clockwise
+	return [2][2]float64{{cos * sx, -sin * sy}, {sin * sx, cos * sy}}
+}
+
+// transformSize returns the size of the bounding box of a
+// patch of size after it has been transformed.
+func (t Transform) transformSize(size image.Point) image.Point {
+	m := t.matrix()
+	w, h := float64(size.X), float64(size.Y)
+
+	width := math.Abs(m[0][0]*w) + math.Abs(m[0][1]*h)
+	height := math.Abs(m[1][0]*w) + math.Abs(m[1][1]*h)
+
+	// remove any floating point noise before rounding up
+	return image.Point{X: int(math.Ceil(width - 1e-9)), Y: int(math.Ceil(height - 1e-9))}
+}
+
+// affine returns the source to destination matrix, that
+// maps the centre of the source to the centre of the destination.
+func (t Transform) affine(src, dst image.Rectangle) f64.Aff3 {
+	m := t.matrix()
+	scx, scy := float64(src.Min.X+src.Max.X)/2, float64(src.Min.Y+src.Max.Y)/2
+	dcx, dcy := float64(dst.Min.X+dst.Max.X)/2, float64(dst.Min.Y+dst.Max.Y)/2
+
+	return f64.Aff3{
+		m[0][0], m[0][1], dcx - m[0][0]*scx - m[0][1]*scy,
+		m[1][0], m[1][1], dcy - m[1][0]*scx - m[1][1]*scy,
+	}
+}
+
+// exactTransform flips and rotates the src by quarter turns, moving
+// each pixel to its new position without any interpolation.
+func (t Transform) exactTransform(dst draw.Image, src image.Image, turns int) {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			nx, ny := x, y
+			if t.FlipHorizontal {
+				nx = w - 1 - nx
+			}
+			if t.FlipVertical {
+				ny = h - 1 - ny
+			}
+
+			// rotate a quarter turn clockwise each time,
+			// swapping the width and height
+			pw, ph := w, h
+			for i := 0; i < turns; i++ {
+				nx, ny = ph-1-ny, nx
+				pw, ph = ph, pw
+			}
+
+			dst.Set(nx, ny, src.At(x+b.Min.X, y+b.Min.Y))
+		}
+	}
+}
+
+// newPatchLike generates an empty image of the same type as the patch.
+func newPatchLike(patch draw.Image, bounds image.Rectangle) draw.Image {
+	switch img := patch.(type) {
+	case *colour.NRGBA64:
+		return colour.NewNRGBA64(img.Space(), bounds)
+	case *colour.ARGBA:
+		return colour.NewARGBA(bounds)
+	case *colour.NRGBAF32:
+		return colour.NewNRGBAF32(img.Space(), bounds)
+	default:
+		return image.NewNRGBA64(bounds)
+	}
+}
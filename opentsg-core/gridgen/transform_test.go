@@ -0,0 +1,107 @@
+package gridgen
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/mrmxf/opentsg-modules/opentsg-core/colour"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTransform(t *testing.T) {
+
+	// a 4x2 patch with a unique colour in each corner
+	patch := image.NewNRGBA64(image.Rect(0, 0, 4, 2))
+	draw.Draw(patch, patch.Bounds(), &image.Uniform{color.NRGBA64{A: 0xffff}}, image.Point{}, draw.Src)
+	topLeft := color.NRGBA64{R: 0xffff, A: 0xffff}
+	topRight := color.NRGBA64{G: 0xffff, A: 0xffff}
+	bottomLeft := color.NRGBA64{B: 0xffff, A: 0xffff}
+	patch.Set(0, 0, topLeft)
+	patch.Set(3, 0, topRight)
+	patch.Set(0, 1, bottomLeft)
+
+	exact := []Transform{
+		{Rotate: 90},
+		{Rotate: -270},
+		{Rotate: 180},
+		{FlipHorizontal: true},
+		{FlipVertical: true},
+		{Rotate: 90, FlipHorizontal: true},
+	}
+
+	type corners struct {
+		size                          image.Point
+		topLeft, topRight, bottomLeft image.Point
+	}
+
+	expected := []corners{
+		{image.Point{2, 4}, image.Point{1, 0}, image.Point{1, 3}, image.Point{0, 0}},
+		{image.Point{2, 4}, image.Point{1, 0}, image.Point{1, 3}, image.Point{0, 0}},
+		{image.Point{4, 2}, image.Point{3, 1}, image.Point{0, 1}, image.Point{3, 0}},
+		{image.Point{4, 2}, image.Point{3, 0}, image.Point{0, 0}, image.Point{3, 1}},
+		{image.Point{4, 2}, image.Point{0, 1}, image.Point{3, 1}, image.Point{0, 0}},
+		{image.Point{2, 4}, image.Point{1, 3}, image.Point{1, 0}, image.Point{0, 3}},
+	}
+
+	for i, trans := range exact {
+		out, mask := trans.Apply(patch, nil)
+
+		Convey("Checking patches are rotated and flipped by exact pixel moves", t, func() {
+			Convey(fmt.Sprintf("using the transform %+v", trans), func() {
+				Convey("the corners are moved to the expected positions and no mask is made", func() {
+					So(out.Bounds().Size(), ShouldResemble, expected[i].size)
+					So(out.At(expected[i].topLeft.X, expected[i].topLeft.Y), ShouldResemble, topLeft)
+					So(out.At(expected[i].topRight.X, expected[i].topRight.Y), ShouldResemble, topRight)
+					So(out.At(expected[i].bottomLeft.X, expected[i].bottomLeft.Y), ShouldResemble, bottomLeft)
+					So(mask, ShouldBeNil)
+				})
+			})
+		})
+	}
+
+	area := image.Rect(100, 100, 140, 120)
+	areaTransforms := []Transform{{}, {Rotate: 90}, {Scale: &Scale{X: 2}}, {Rotate: 45}, {Scale: &Scale{X: 0.5, Y: 0.5}}}
+	expectedAreas := []image.Rectangle{
+		area,
+		image.Rect(110, 90, 130, 130),
+		image.Rect(80, 100, 160, 120),
+		image.Rect(99, 89, 142, 132),
+		image.Rect(110, 105, 130, 115),
+	}
+
+	for i, trans := range areaTransforms {
+
+		Convey("Checking the canvas area of a transformed patch", t, func() {
+			Convey(fmt.Sprintf("using the transform %+v", trans), func() {
+				Convey("the area is the bounding box of the patch, centred on the original patch", func() {
+					So(trans.TransformArea(area), ShouldResemble, expectedAreas[i])
+				})
+			})
+		})
+	}
+
+	cspace := colour.ColorSpace{ColorSpace: "rec709"}
+	cPatch := colour.NewNRGBA64(cspace, image.Rect(0, 0, 20, 10))
+	colour.Draw(cPatch, cPatch.Bounds(), &image.Uniform{&colour.CNRGBA64{R: 0xffff, A: 0xffff, ColorSpace: cspace}}, image.Point{}, draw.Src)
+
+	rotated, rotMask := Transform{Rotate: 45, Filter: "nearest"}.Apply(cPatch, nil)
+	scaled, scaleMask := Transform{Scale: &Scale{X: 2, Y: 0.5}}.Apply(cPatch, nil)
+
+	Convey("Checking patches are resampled for arbitrary rotations and scales", t, func() {
+		Convey("using a 45 degree rotation and a scale of 2,0.5 on a colour space aware patch", func() {
+			Convey("the image type is kept and the uncovered corners are masked", func() {
+				So(rotated, ShouldHaveSameTypeAs, cPatch)
+				So(rotated.(*colour.NRGBA64).Space(), ShouldResemble, cspace)
+				So(rotated.Bounds(), ShouldResemble, image.Rect(0, 0, 22, 22))
+				So(rotMask.At(11, 11), ShouldResemble, color.Alpha16{A: 0xffff})
+				So(rotMask.At(0, 0), ShouldResemble, color.Alpha16{})
+
+				So(scaled.Bounds(), ShouldResemble, image.Rect(0, 0, 40, 5))
+				So(scaleMask.At(20, 2), ShouldResemble, color.Alpha16{A: 0xffff})
+			})
+		})
+	})
+}
@@ -1,10 +1,13 @@
-// package middleware runs input middleware this is not currently not used
+// package middleware runs input middleware and contains the
+// conditions that enable factory includes and creates per frame.
 package middleware
 
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"regexp"
+	"slices"
 	"strings"
 )
 
@@ -53,3 +56,73 @@ func framecount(min, max, pos int) bool {
 	return false
 
 }
+
+/*
+When is a set of conditions for enabling an include or a create
+update of a factory. Every condition that is set has to be met,
+a When with no conditions is always met.
+*/
+type When struct {
+	// From is the first frame the condition is met
+	From *int `json:"from,omitempty" yaml:"from,omitempty"`
+	// To is the frame the condition stops being met, it is not included
+	To *int `json:"to,omitempty" yaml:"to,omitempty"`
+	// Every is met every n frames, starting at the Offset frame
+	Every  int `json:"every,omitempty" yaml:"every,omitempty"`
+	Offset int `json:"offset,omitempty" yaml:"offset,omitempty"`
+	// Frames is a list of frames the condition is met on
+	Frames []int `json:"frames,omitempty" yaml:"frames,omitempty"`
+	// Metadata is met if every metadata key matches one of its values
+	Metadata map[string][]any `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	// AnyOf is met if any of its conditions are met
+	AnyOf []When `json:"anyOf,omitempty" yaml:"anyOf,omitempty"`
+	// Not inverts the result of the other conditions
+	Not bool `json:"not,omitempty" yaml:"not,omitempty"`
+}
+
+// Met checks if the conditions are met for the frame
+// number and the metadata of the frame.
+func (w When) Met(frame int, metadata map[string]any) bool {
+	return w.met(frame, metadata) != w.Not
+}
+
+func (w When) met(frame int, metadata map[string]any) bool {
+	if w.From != nil || w.To != nil {
+		min, max := 0, math.MaxInt
+		if w.From != nil {
+			min = *w.From
+		}
+		if w.To != nil {
+			max = *w.To
+		}
+
+		if !framecount(min, max, frame) {
+			return false
+		}
+	}
+
+	if w.Every > 0 && (frame < w.Offset || (frame-w.Offset)%w.Every != 0) {
+		return false
+	}
+
+	if len(w.Frames) > 0 && !slices.Contains(w.Frames, frame) {
+		return false
+	}
+
+	for key, values := range w.Metadata {
+		value, ok := metadata[key]
+		if !ok {
+			return false
+		}
+
+		if !slices.ContainsFunc(values, func(v any) bool { return fmt.Sprint(v) == fmt.Sprint(value) }) {
+			return false
+		}
+	}
+
+	if len(w.AnyOf) > 0 {
+		return slices.ContainsFunc(w.AnyOf, func(alt When) bool { return alt.Met(frame, metadata) })
+	}
+
+	return true
+}
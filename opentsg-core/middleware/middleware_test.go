@@ -42,3 +42,44 @@ func TestMinMaxFrame(t *testing.T) {
 		})
 	}
 }
+
+func TestWhen(t *testing.T) {
+	two, six := 2, 6
+	whens := []When{{From: &two, To: &six}, {Every: 3, Offset: 1}, {Frames: []int{0, 4, 7}},
+		{Metadata: map[string][]any{"colour": {"red", "blue"}}}, {From: &two, Not: true},
+		{AnyOf: []When{{Frames: []int{1}}, {Every: 4}}}}
+	expected := [][]bool{
+		{false, false, true, true, true, true, false, false},
+		{false, true, false, false, true, false, false, true},
+		{true, false, false, false, true, false, false, true},
+		{true, true, true, true, true, true, true, true},
+		{true, true, false, false, false, false, false, false},
+		{true, true, false, false, true, false, false, false},
+	}
+
+	for i, w := range whens {
+		var got []bool
+		for frame := range 8 {
+			got = append(got, w.Met(frame, map[string]any{"colour": "blue"}))
+		}
+
+		Convey("Checking when conditions are met on the right frames", t, func() {
+			Convey(fmt.Sprintf("using %+v as the conditions for frames 0 to 7", w), func() {
+				Convey("the conditions are met on the expected frames", func() {
+					So(got, ShouldResemble, expected[i])
+				})
+			})
+		})
+	}
+
+	missing := When{Metadata: map[string][]any{"colour": {"red"}}}
+
+	Convey("Checking metadata conditions are not met by other values", t, func() {
+		Convey("using a red metadata condition with blue and missing metadata", func() {
+			Convey("the conditions are not met", func() {
+				So(missing.Met(0, map[string]any{"colour": "blue"}), ShouldBeFalse)
+				So(missing.Met(0, map[string]any{}), ShouldBeFalse)
+			})
+		})
+	})
+}
@@ -0,0 +1,522 @@
+// Package migrate rewrites widget and factory files from older
+// releases of openTSG to the current props and location box layout.
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Generation is the openTSG release a file was written for
+type Generation string
+
+const (
+	// Generation040 files are from before the camelCase keys of 0.4.1
+	Generation040 Generation = "0.4.0"
+	// Generation041 files have camelCase keys, but use the
+	// top level widget type and grid locations
+	Generation041 Generation = "0.4.1"
+	// GenerationCurrent files use the props and location box layout of 0.5.0 onwards
+	GenerationCurrent Generation = "0.5.0"
+)
+
+// The migration rules
+const (
+	// RuleCamelCase is a lowercase key renamed to its camelCase key
+	RuleCamelCase = "camel-case"
+	// RuleType is the widget type moved to props.type
+	RuleType = "props-type"
+	// RuleGrid is the grid location and alias moved to props.location
+	RuleGrid = "grid-location"
+	// RuleGridPosition is a framecounter gridPosition string moved to gridPosition.alias
+	RuleGridPosition = "grid-position"
+	// RuleImagePosition is an addimage position moved to the offset
+	RuleImagePosition = "image-position"
+	// RuleImageSize is an addimage imagesize moved to the location box
+	RuleImageSize = "image-size"
+)
+
+// Change is a single change made to a file
+type Change struct {
+	// Rule is the rule that made the change
+	Rule string
+	// Path is the dot path of the key that was changed
+	Path string
+	// From and To are the json of the values before and after the change
+	From, To string
+}
+
+// String returns the change in the form path: from -> to (rule)
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s (%s)", c.Path, c.From, c.To, c.Rule)
+}
+
+// FileReport is the migration of a single file
+type FileReport struct {
+	File string
+	// Factory is true if the file is a factory, rather than a widget
+	Factory bool
+	// Generation is the release the file was detected as being written for
+	Generation Generation
+	Changes    []Change
+	// Skipped is the reason the file was not migrated, such as being a remote file
+	Skipped string
+}
+
+// Report is the migration of a factory tree
+type Report struct {
+	Files []FileReport
+}
+
+// legacyKeys are the lowercase keys of before 0.4.1 and their camelCase keys
+var legacyKeys = map[string]string{}
+
+// camelKeys are the camelCase keys of the widgets
+var camelKeys = []string{"backgroundColor", "backgroundFillColor", "baseImage", "bitDepth", "borderColor", "borderSize",
+	"bottomLeft", "bottomRight", "colorSpace", "cwRotation", "fillType", "fontSize", "frameCounter", "frameSize",
+	"gradientSeparator", "graticuleColor", "gridColumns", "gridPosition", "gridRows", "groupsTemplates", "imageFill",
+	"imageType", "initialPixelValue", "lineColor", "maxBitDepth", "noiseType", "objectFitFill", "objectQuery",
+	"pixelValueRepeat", "plateType", "segmentColors", "segmentCount", "startAngle", "startColor", "targetAlias",
+	"textColor", "textHeight", "textProperties", "textxPosition", "textyPosition", "topLeft", "topRight", "waveType",
+	"widgetProperties", "xAlignment", "xDetections", "xStep", "xStepEnd", "yAlignment", "yDetections", "yOffset",
+	"yStep", "yStepEnd", "zoneSize"}
+
+func init() {
+	for _, key := range camelKeys {
+		legacyKeys[strings.ToLower(key)] = key
+	}
+}
+
+// factoryKeys are the keys that mark a file as a factory
+var factoryKeys = []string{"include", "create", "generate", "sweep"}
+
+// Detect returns the release generation of a widget or factory file
+func Detect(data []byte) (Generation, error) {
+	_, changes, err := migrate(data)
+	if err != nil {
+		return "", err
+	}
+
+	return generation(changes), nil
+}
+
+// Widget migrates a widget file to the current layout, returning
+// the migrated widget and every change that was made.
+func Widget(data []byte) ([]byte, []Change, error) {
+	var widget map[string]any
+	if err := yaml.Unmarshal(data, &widget); err != nil {
+		return nil, nil, fmt.Errorf("0066 error parsing the widget: %v", err)
+	}
+
+	changes, err := migrateWidget(widget, "")
+	if err != nil || len(changes) == 0 {
+		return data, changes, err
+	}
+
+	out, err := marshal(widget)
+
+	return out, changes, err
+}
+
+// Factory migrates the create updates of a factory to the current layout,
+// returning the migrated factory and every change that was made.
+func Factory(data []byte) ([]byte, []Change, error) {
+	var fact map[string]any
+	if err := yaml.Unmarshal(data, &fact); err != nil {
+		return nil, nil, fmt.Errorf("0066 error parsing the factory: %v", err)
+	}
+
+	var changes []Change
+	creates, _ := fact["create"].([]any)
+	for i, create := range creates {
+		targets, _ := create.(map[string]any)
+		for _, alias := range sortedKeys(targets) {
+			update, ok := targets[alias].(map[string]any)
+			if !ok {
+				continue
+			}
+
+			updateChanges, err := migrateWidget(update, fmt.Sprintf("create.%v.%s.", i, alias))
+			if err != nil {
+				return nil, nil, err
+			}
+			changes = append(changes, updateChanges...)
+		}
+	}
+
+	if len(changes) == 0 {
+		return data, nil, nil
+	}
+
+	out, err := marshal(fact)
+
+	return out, changes, err
+}
+
+// Tree migrates the factory tree of the input file, and every local file
+// it includes. The migrated files are written over the originals, unless
+// dryRun is true, when only the report is made. Remote includes are skipped.
+func Tree(inputFile string, dryRun bool) (Report, error) {
+	var report Report
+	inputFile, _ = filepath.Abs(inputFile)
+	err := tree(inputFile, filepath.Dir(inputFile), dryRun, map[string]bool{}, &report)
+
+	return report, err
+}
+
+// tree migrates a file and its includes
+func tree(file, root string, dryRun bool, done map[string]bool, report *Report) error {
+	if done[file] {
+		return nil
+	}
+	done[file] = true
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("0066 %v", err)
+	}
+
+	var contents map[string]any
+	if err := yaml.Unmarshal(data, &contents); err != nil {
+		return fmt.Errorf("0066 error parsing %s: %v", file, err)
+	}
+
+	fileReport := FileReport{File: file, Factory: isFactory(contents)}
+	var out []byte
+	if fileReport.Factory {
+		out, fileReport.Changes, err = Factory(data)
+	} else {
+		out, fileReport.Changes, err = Widget(data)
+	}
+	if err != nil {
+		return fmt.Errorf("%v in %s", err, file)
+	}
+
+	fileReport.Generation = generation(fileReport.Changes)
+	report.Files = append(report.Files, fileReport)
+
+	if len(fileReport.Changes) != 0 && !dryRun {
+		if ext := filepath.Ext(file); ext == ".yaml" || ext == ".yml" {
+			var yamlContents any
+			json.Unmarshal(out, &yamlContents)
+			out, _ = yaml.Marshal(yamlContents)
+		}
+
+		if err := os.WriteFile(file, out, 0644); err != nil {
+			return fmt.Errorf("0066 error writing %s: %v", file, err)
+		}
+	}
+
+	includes, _ := contents["include"].([]any)
+	for _, inc := range includes {
+		incMap, _ := inc.(map[string]any)
+		uri, _ := incMap["uri"].(string)
+		if uri == "" {
+			continue
+		}
+
+		if strings.Contains(uri, "://") {
+			report.Files = append(report.Files, FileReport{File: uri, Skipped: "remote files are not migrated"})
+
+			continue
+		}
+
+		// includes are relative to the factory, then the input factory
+		path := uri
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(file), uri)
+			if _, err := os.Stat(path); err != nil {
+				path = filepath.Join(root, uri)
+			}
+		}
+
+		if err := tree(path, root, dryRun, done, report); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrate migrates a file that is either a widget or factory
+func migrate(data []byte) ([]byte, []Change, error) {
+	var contents map[string]any
+	if err := yaml.Unmarshal(data, &contents); err != nil {
+		return nil, nil, fmt.Errorf("0066 error parsing the file: %v", err)
+	}
+
+	if isFactory(contents) {
+		return Factory(data)
+	}
+
+	return Widget(data)
+}
+
+// isFactory checks if the file is a factory
+func isFactory(contents map[string]any) bool {
+	for _, key := range factoryKeys {
+		if _, ok := contents[key]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// generation finds the release of a file from the changes needed to migrate it
+func generation(changes []Change) Generation {
+	gen := GenerationCurrent
+	for _, c := range changes {
+		if c.Rule == RuleCamelCase {
+			return Generation040
+		}
+		gen = Generation041
+	}
+
+	return gen
+}
+
+// migrateWidget applies every rule to a widget, or a create update of a widget
+func migrateWidget(widget map[string]any, path string) ([]Change, error) {
+	changes := camelCase(widget, path)
+
+	props, _ := widget["props"].(map[string]any)
+	newProps := props == nil
+	if newProps {
+		props = map[string]any{}
+	}
+
+	if wType, ok := widget["type"].(string); ok && props["type"] == nil {
+		props["type"] = wType
+		delete(widget, "type")
+		changes = append(changes, change(RuleType, path+"type", wType, props["type"]))
+	}
+
+	if grid, ok := widget["grid"].(map[string]any); ok {
+		location := map[string]any{}
+		if alias, ok := grid["alias"]; ok {
+			location["alias"] = alias
+		}
+
+		if loc, ok := grid["location"].(string); ok {
+			box, err := locationBox(loc)
+			if err != nil {
+				return nil, fmt.Errorf("0066 %v at %sgrid.location", err, path)
+			}
+			location["box"] = box
+		}
+
+		props["location"] = location
+		delete(widget, "grid")
+		changes = append(changes, change(RuleGrid, path+"grid", grid, location))
+	}
+
+	if pos, ok := widget["gridPosition"].(string); ok {
+		widget["gridPosition"] = map[string]any{"alias": pos}
+		changes = append(changes, change(RuleGridPosition, path+"gridPosition", pos, widget["gridPosition"]))
+	}
+
+	// the addimage keys are found by the type or the image,
+	// as create updates may not have the type
+	if props["type"] == "builtin.addimage" || widget["image"] != nil {
+		if pos, ok := widget["position"].(map[string]any); ok {
+			offset := map[string]any{}
+			for _, axis := range []string{"x", "y"} {
+				if v, ok := pos[axis]; ok {
+					offset[axis] = pixels(v)
+				}
+			}
+			widget["offset"] = offset
+			delete(widget, "position")
+			changes = append(changes, change(RuleImagePosition, path+"position", pos, offset))
+		}
+
+		if size, ok := widget["imagesize"].(map[string]any); ok {
+			location, _ := props["location"].(map[string]any)
+			if location == nil {
+				location = map[string]any{}
+				props["location"] = location
+			}
+			box, _ := location["box"].(map[string]any)
+			if box == nil {
+				box = map[string]any{}
+				location["box"] = box
+			}
+
+			if v, ok := size["w"]; ok && box["x2"] == nil {
+				box["width"] = pixels(v)
+			}
+			if v, ok := size["h"]; ok && box["y2"] == nil {
+				box["height"] = pixels(v)
+			}
+			delete(widget, "imagesize")
+			changes = append(changes, change(RuleImageSize, path+"imagesize", size, box))
+		}
+	}
+
+	if newProps && len(props) != 0 {
+		widget["props"] = props
+	}
+
+	return changes, nil
+}
+
+// camelCase renames every lowercase legacy key to its camelCase key
+func camelCase(value any, path string) []Change {
+	var changes []Change
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			val := v[key]
+			if camel, ok := legacyKeys[key]; ok && camel != key {
+				if _, exists := v[camel]; !exists {
+					delete(v, key)
+					v[camel] = val
+					changes = append(changes, change(RuleCamelCase, path+key, key, camel))
+					key = camel
+				}
+			}
+
+			changes = append(changes, camelCase(val, path+key+".")...)
+		}
+	case []any:
+		for i, val := range v {
+			changes = append(changes, camelCase(val, fmt.Sprintf("%s%v.", path, i))...)
+		}
+	}
+
+	return changes
+}
+
+var (
+	regSingle = regexp.MustCompile(`^[a-z]{1,3}[0-9]{1,3}$`)
+	regArea   = regexp.MustCompile(`^[a-z]{1,3}[0-9]{1,3}:[a-z]{1,3}[0-9]{1,3}$`)
+	regXY     = regexp.MustCompile(`^\((-?[0-9]{1,5}),(-?[0-9]{1,5})\)-\((-?[0-9]{1,5}),(-?[0-9]{1,5})\)$`)
+	regRC     = regexp.MustCompile(`^r([0-9]+)c([0-9]+)$`)
+	regRCArea = regexp.MustCompile(`^r([0-9]+)c([0-9]+):r([0-9]+)c([0-9]+)$`)
+	regArt    = regexp.MustCompile(`^key:[\w]{3,10}$`)
+)
+
+// locationBox converts a grid location string to a location box,
+// matching the coordinates of the grid strings of older releases.
+func locationBox(location string) (map[string]any, error) {
+	lower := strings.ToLower(location)
+
+	switch {
+	case regArt.MatchString(location):
+		return map[string]any{"useGridKeys": []any{location}}, nil
+	case regSingle.MatchString(lower):
+		x, y, err := gridSplit(lower)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]any{"x": x, "y": y}, nil
+	case regArea.MatchString(lower):
+		start, end, _ := strings.Cut(lower, ":")
+		x, y, err := gridSplit(start)
+		if err != nil {
+			return nil, err
+		}
+		xEnd, yEnd, err := gridSplit(end)
+		if err != nil {
+			return nil, err
+		}
+
+		// the end square was included in the area
+		return map[string]any{"x": x, "y": y, "x2": xEnd + 1, "y2": yEnd + 1}, nil
+	case regXY.MatchString(lower):
+		m := regXY.FindStringSubmatch(lower)
+
+		return map[string]any{"x": m[1] + "px", "y": m[2] + "px", "x2": m[3] + "px", "y2": m[4] + "px"}, nil
+	case regRC.MatchString(lower):
+		m := regRC.FindStringSubmatch(lower)
+		r, _ := strconv.Atoi(m[1])
+		c, _ := strconv.Atoi(m[2])
+
+		return map[string]any{"x": r - 1, "y": c - 1}, nil
+	case regRCArea.MatchString(lower):
+		m := regRCArea.FindStringSubmatch(lower)
+		vals := make([]int, 4)
+		for i := range vals {
+			vals[i], _ = strconv.Atoi(m[i+1])
+		}
+
+		return map[string]any{"x": vals[0] - 1, "y": vals[1] - 1, "x2": vals[2] - 1, "y2": vals[3] - 1}, nil
+	default:
+		// anything else was an alias
+		return map[string]any{"useAlias": location}, nil
+	}
+}
+
+// gridSplit splits the letters and numbers of a grid square into its x and y,
+// where the letters are counted like spreadsheet columns, with a as 0.
+func gridSplit(tile string) (int, int, error) {
+	split := strings.IndexFunc(tile, func(r rune) bool { return r < 'a' || r > 'z' })
+	if split <= 0 {
+		return 0, 0, fmt.Errorf("invalid grid square %s", tile)
+	}
+
+	x := 0
+	for i, val := range tile[:split] {
+		power := int(math.Pow(26, float64(split-i-1)))
+		if i == split-1 {
+			x += power * int(val-'a')
+		} else {
+			x += power * int(val-'a'+1)
+		}
+	}
+
+	y, err := strconv.Atoi(tile[split:])
+
+	return x, y, err
+}
+
+// pixels converts a number of pixels to a pixel coordinate
+func pixels(v any) any {
+	switch n := v.(type) {
+	case int, float64:
+		return fmt.Sprintf("%vpx", n)
+	}
+
+	return v
+}
+
+// change makes a change with the json of the values
+func change(rule, path string, from, to any) Change {
+	fromJSON, _ := json.Marshal(from)
+	toJSON, _ := json.Marshal(to)
+
+	return Change{Rule: rule, Path: path, From: string(fromJSON), To: string(toJSON)}
+}
+
+// marshal writes a migrated file as indented json
+func marshal(contents map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(contents); err != nil {
+		return nil, fmt.Errorf("0066 error writing the migrated file: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// sortedKeys returns the keys of a map in order, so
+// the changes are always reported in the same order
+func sortedKeys(m map[string]any) []string {
+	return slices.Sorted(maps.Keys(m))
+}
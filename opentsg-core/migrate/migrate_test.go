@@ -0,0 +1,140 @@
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLocationBox(t *testing.T) {
+	locations := []string{"a0", "B3", "a5:p8", "aa1", "(10,20)-(300,400)", "R2C3", "R1C1:R3C4", "key:red", "bottom"}
+	expected := []map[string]any{{"x": 0, "y": 0}, {"x": 1, "y": 3}, {"x": 0, "y": 5, "x2": 16, "y2": 9}, {"x": 26, "y": 1},
+		{"x": "10px", "y": "20px", "x2": "300px", "y2": "400px"}, {"x": 1, "y": 2}, {"x": 0, "y": 0, "x2": 2, "y2": 3},
+		{"useGridKeys": []any{"key:red"}}, {"useAlias": "bottom"},
+	}
+
+	for i, loc := range locations {
+		box, err := locationBox(loc)
+
+		Convey("Checking grid locations are converted to location boxes", t, func() {
+			Convey(fmt.Sprintf("using a location of %s", loc), func() {
+				Convey(fmt.Sprintf("a box of %v is returned", expected[i]), func() {
+					So(err, ShouldBeNil)
+					So(box, ShouldResemble, expected[i])
+				})
+			})
+		})
+	}
+}
+
+func TestWidget(t *testing.T) {
+	widgets := []string{
+		`{"type": "builtin.framecounter", "grid": {"location": "a0:b1", "alias": "counter"}, "framecounter": true, "textcolor": "#C2A649", "gridposition": "top left"}`,
+		`{"type": "builtin.addimage", "grid": {"location": "counter"}, "image": "logo.png", "position": {"x": 120, "y": 420}, "imagesize": {"w": 1000, "h": 500}}`,
+		`{"props": {"type": "builtin.textbox", "location": {"box": {"x": 1, "y": 1}}}, "textColor": "#fff"}`,
+	}
+	expected := []map[string]any{
+		{"props": map[string]any{"type": "builtin.framecounter", "location": map[string]any{"alias": "counter", "box": map[string]any{"x": 0.0, "y": 0.0, "x2": 2.0, "y2": 2.0}}},
+			"frameCounter": true, "textColor": "#C2A649", "gridPosition": map[string]any{"alias": "top left"}},
+		{"props": map[string]any{"type": "builtin.addimage", "location": map[string]any{"box": map[string]any{"useAlias": "counter", "width": "1000px", "height": "500px"}}},
+			"image": "logo.png", "offset": map[string]any{"x": "120px", "y": "420px"}},
+		{"props": map[string]any{"type": "builtin.textbox", "location": map[string]any{"box": map[string]any{"x": 1.0, "y": 1.0}}}, "textColor": "#fff"},
+	}
+	rules := [][]string{{RuleCamelCase, RuleCamelCase, RuleCamelCase, RuleType, RuleGrid, RuleGridPosition},
+		{RuleType, RuleGrid, RuleImagePosition, RuleImageSize}, nil}
+	generations := []Generation{Generation040, Generation041, GenerationCurrent}
+
+	for i, widget := range widgets {
+		out, changes, err := Widget([]byte(widget))
+		gen, genErr := Detect([]byte(widget))
+
+		var got map[string]any
+		json.Unmarshal(out, &got)
+		var gotRules []string
+		for _, c := range changes {
+			gotRules = append(gotRules, c.Rule)
+		}
+
+		Convey("Checking legacy widgets are migrated to the current layout", t, func() {
+			Convey(fmt.Sprintf("using a widget of %s", widget), func() {
+				Convey(fmt.Sprintf("the widget is migrated and detected as being from %s", generations[i]), func() {
+					So(err, ShouldBeNil)
+					So(genErr, ShouldBeNil)
+					So(got, ShouldResemble, expected[i])
+					So(gotRules, ShouldResemble, rules[i])
+					So(gen, ShouldEqual, generations[i])
+				})
+			})
+		})
+	}
+
+	_, changes, _ := Widget([]byte(widgets[0]))
+
+	Convey("Checking the changes of a migration are reported", t, func() {
+		Convey("using a framecounter from before 0.4.1", func() {
+			Convey("every change has the path of the key and the values before and after", func() {
+				So(changes[0].String(), ShouldEqual, `framecounter: "framecounter" -> "frameCounter" (camel-case)`)
+				So(changes[3].String(), ShouldEqual, `type: "builtin.framecounter" -> "builtin.framecounter" (props-type)`)
+				So(changes[4].String(), ShouldEqual, `grid: {"alias":"counter","location":"a0:b1"} -> {"alias":"counter","box":{"x":0,"x2":2,"y":0,"y2":2}} (grid-location)`)
+			})
+		})
+	})
+}
+
+func TestTree(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "widgets"), 0755)
+	factory := `{"include": [{"uri": "widgets/box.json", "name": "box", "args": []}, {"uri": "https://example.com/remote.json", "name": "remote", "args": []}],
+	"create": [{"box": {"grid": {"location": "c2"}, "textcolor": "#fff"}}]}`
+	box := `{"type": "builtin.textbox", "text": ["old"]}`
+	current := `{"props": {"type": "builtin.textbox"}, "text": ["new"]}`
+	os.WriteFile(filepath.Join(dir, "factory.json"), []byte(factory), 0644)
+	os.WriteFile(filepath.Join(dir, "widgets", "box.json"), []byte(box), 0644)
+
+	dryReport, dryErr := Tree(filepath.Join(dir, "factory.json"), true)
+	dryBox, _ := os.ReadFile(filepath.Join(dir, "widgets", "box.json"))
+
+	report, err := Tree(filepath.Join(dir, "factory.json"), false)
+	var migratedFactory, migratedBox map[string]any
+	factoryBytes, _ := os.ReadFile(filepath.Join(dir, "factory.json"))
+	boxBytes, _ := os.ReadFile(filepath.Join(dir, "widgets", "box.json"))
+	json.Unmarshal(factoryBytes, &migratedFactory)
+	json.Unmarshal(boxBytes, &migratedBox)
+
+	Convey("Checking a factory tree is migrated", t, func() {
+		Convey("using a factory with a legacy create update and a legacy widget include", func() {
+			Convey("both files are rewritten and the remote include is skipped", func() {
+				So(dryErr, ShouldBeNil)
+				So(string(dryBox), ShouldEqual, box)
+				So(dryReport, ShouldResemble, report)
+				So(err, ShouldBeNil)
+				So(len(report.Files), ShouldEqual, 3)
+				So(report.Files[0].Factory, ShouldBeTrue)
+				So(report.Files[0].Generation, ShouldEqual, Generation040)
+				So(report.Files[1].Generation, ShouldEqual, Generation041)
+				So(report.Files[2].Skipped, ShouldNotBeEmpty)
+				So(migratedFactory["create"], ShouldResemble, []any{map[string]any{"box": map[string]any{
+					"props": map[string]any{"location": map[string]any{"box": map[string]any{"x": 2.0, "y": 2.0}}}, "textColor": "#fff"}}})
+				So(migratedBox, ShouldResemble, map[string]any{"props": map[string]any{"type": "builtin.textbox"}, "text": []any{"old"}})
+			})
+		})
+	})
+
+	os.WriteFile(filepath.Join(dir, "widgets", "box.json"), []byte(current), 0644)
+	currentReport, _ := Tree(filepath.Join(dir, "widgets", "box.json"), false)
+	currentBytes, _ := os.ReadFile(filepath.Join(dir, "widgets", "box.json"))
+
+	Convey("Checking current files are not rewritten", t, func() {
+		Convey("using a widget with the current layout", func() {
+			Convey("the file is unchanged and reported as current", func() {
+				So(string(currentBytes), ShouldEqual, current)
+				So(currentReport.Files[0].Generation, ShouldEqual, GenerationCurrent)
+				So(currentReport.Files[0].Changes, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,390 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"image/draw"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrmxf/opentsg-modules/opentsg-core/tsg"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// The names of the openTSG metrics
+const (
+	FramesMetric        = "opentsg.frames"
+	WidgetsMetric       = "opentsg.widgets"
+	WidgetLatencyMetric = "opentsg.widget.duration"
+	EncodedBytesMetric  = "opentsg.encode.size"
+	SearchLatencyMetric = "opentsg.search.duration"
+)
+
+// latencyBuckets are the histogram boundaries in seconds
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Metrics records the metrics of openTSG, for dashboards of
+// long running render nodes. The metrics are:
+//
+//   - the frames rendered, by result
+//   - the widgets run, by widget type and status code
+//   - the handler latency of each widget type
+//   - the bytes encoded for each file format
+//   - the latency of searching for files
+//
+// The metrics are added to openTSG as middlewares, and can be exported
+// with any OpenTelemetry metric reader, as well as in the Prometheus text format.
+type Metrics struct {
+	provider *sdkmetric.MeterProvider
+	// reader is used for the prometheus output
+	reader *sdkmetric.ManualReader
+
+	frames        metric.Int64Counter
+	widgets       metric.Int64Counter
+	widgetLatency metric.Float64Histogram
+	encodedBytes  metric.Int64Counter
+	searchLatency metric.Float64Histogram
+}
+
+// NewMetrics creates the openTSG metrics. The options are used
+// for the metric provider, to add OpenTelemetry readers
+// and resources.
+/*
+
+You can export the metrics with the following code.
+
+	reader, _ := tracing.OTLPMetricReader(ctx, time.Minute)
+	metrics, _ := tracing.NewMetrics(sdkmetric.WithReader(reader))
+	defer metrics.Shutdown(ctx)
+
+	opentsg.Use(metrics.Middleware())
+	opentsg.UseSearches(metrics.SearchMiddleware())
+	opentsg.UseContextMiddleware(metrics.ContextMiddleware())
+
+	// serve the prometheus metrics
+	http.Handle("/metrics", metrics)
+
+*/
+func NewMetrics(opts ...sdkmetric.Option) (*Metrics, error) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(append([]sdkmetric.Option{sdkmetric.WithReader(reader)}, opts...)...)
+	meter := provider.Meter("opentsg")
+
+	m := &Metrics{provider: provider, reader: reader}
+
+	var err error
+	if m.frames, err = meter.Int64Counter(FramesMetric,
+		metric.WithDescription("The number of frames rendered"), metric.WithUnit("{frame}")); err != nil {
+		return nil, fmt.Errorf("creating the frame metric: %w", err)
+	}
+
+	if m.widgets, err = meter.Int64Counter(WidgetsMetric,
+		metric.WithDescription("The number of widgets run"), metric.WithUnit("{widget}")); err != nil {
+		return nil, fmt.Errorf("creating the widget metric: %w", err)
+	}
+
+	if m.widgetLatency, err = meter.Float64Histogram(WidgetLatencyMetric,
+		metric.WithDescription("The run time of the widget handlers"), metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(latencyBuckets...)); err != nil {
+		return nil, fmt.Errorf("creating the widget latency metric: %w", err)
+	}
+
+	if m.encodedBytes, err = meter.Int64Counter(EncodedBytesMetric,
+		metric.WithDescription("The number of bytes encoded"), metric.WithUnit("By")); err != nil {
+		return nil, fmt.Errorf("creating the encode metric: %w", err)
+	}
+
+	if m.searchLatency, err = meter.Float64Histogram(SearchLatencyMetric,
+		metric.WithDescription("The time taken to search for files"), metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(latencyBuckets...)); err != nil {
+		return nil, fmt.Errorf("creating the search latency metric: %w", err)
+	}
+
+	return m, nil
+}
+
+// MetricResources generates the attributes for the metrics,
+// giving additional information about the resource being measured.
+func MetricResources(opts *ResourceOptions) sdkmetric.Option {
+
+	if opts == nil {
+		opts = &ResourceOptions{}
+	}
+
+	return sdkmetric.WithResource(resourceOpts(*opts))
+}
+
+// StdoutMetricReader creates a reader that writes the metrics
+// every interval. If conf is nil then the metrics are written to os.Stdout.
+func StdoutMetricReader(conf *WriterConfiguration, interval time.Duration) (sdkmetric.Reader, error) {
+	if conf == nil {
+		conf = &WriterConfiguration{Writer: os.Stdout}
+	}
+
+	exporter, err := stdoutmetric.New(stdoutmetric.WithWriter(conf.Writer))
+	if err != nil {
+		return nil, fmt.Errorf("error creating metric exporter: %w", err)
+	}
+
+	return sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(interval)), nil
+}
+
+// OTLPMetricReader creates a reader that sends the metrics to
+// an OpenTelemetry collector every interval, with the default
+// insecure grpc connection.
+func OTLPMetricReader(ctx context.Context, interval time.Duration) (sdkmetric.Reader, error) {
+	exporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP metric exporter: %w", err)
+	}
+
+	return sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(interval)), nil
+}
+
+// Shutdown flushes and closes the metric readers.
+func (m *Metrics) Shutdown(ctx context.Context) error {
+	return m.provider.Shutdown(ctx)
+}
+
+// Middleware records the frames rendered, the widgets run and
+// the handler latency of each widget. It is added with the Use method of openTSG.
+func (m *Metrics) Middleware() func(h tsg.Handler) tsg.Handler {
+
+	return func(h tsg.Handler) tsg.Handler {
+		return tsg.HandlerFunc(func(resp tsg.Response, req *tsg.Request) {
+
+			mw := &metricWriter{Response: resp}
+			start := time.Now()
+			h.Handle(mw, req)
+			runTime := time.Since(start)
+
+			ctx := context.Background()
+			switch {
+			case !mw.written:
+				// only profiles were written
+			case mw.status == tsg.FrameSuccess:
+				m.frames.Add(ctx, 1, metric.WithAttributes(attribute.String("result", "success")))
+			case mw.status == tsg.FrameFail:
+				m.frames.Add(ctx, 1, metric.WithAttributes(attribute.String("result", "fail")))
+			case req.PatchProperties.WidgetType != "":
+				widgetType := attribute.String("widget_type", req.PatchProperties.WidgetType)
+				m.widgets.Add(ctx, 1, metric.WithAttributes(widgetType, attribute.String("status", mw.status.String())))
+				m.widgetLatency.Record(ctx, runTime.Seconds(), metric.WithAttributes(widgetType))
+			}
+		})
+	}
+}
+
+// metricWriter records the last status code written,
+// that is not a profile.
+type metricWriter struct {
+	tsg.Response
+	status  tsg.StatusCode
+	written bool
+}
+
+func (m *metricWriter) Write(status tsg.StatusCode, message string, args ...any) {
+	if status != tsg.Profiler {
+		m.status = status
+		m.written = true
+	}
+
+	m.Response.Write(status, message, args...)
+}
+
+func (m *metricWriter) BaseImage() draw.Image {
+	return m.Response.BaseImage()
+}
+
+// SearchMiddleware records the latency of searching for files.
+// It is added with the UseSearches method of openTSG.
+func (m *Metrics) SearchMiddleware() func(tsg.Search) tsg.Search {
+
+	return func(search tsg.Search) tsg.Search {
+
+		return tsg.SearchFunc(func(ctx context.Context, URI string) ([]byte, error) {
+			start := time.Now()
+			data, err := search.Search(ctx, URI)
+
+			result := "success"
+			if err != nil {
+				result = "fail"
+			}
+			m.searchLatency.Record(context.Background(), time.Since(start).Seconds(),
+				metric.WithAttributes(attribute.String("result", result)))
+
+			return data, err
+		})
+	}
+}
+
+// ContextMiddleware records the bytes encoded for each file format.
+// It is added with the UseContextMiddleware method of openTSG.
+func (m *Metrics) ContextMiddleware() func(tsg.ContFunc) tsg.ContFunc {
+
+	return func(conter tsg.ContFunc) tsg.ContFunc {
+
+		return tsg.ContFunc(func(ctx context.Context) {
+			conter(ctx)
+
+			if stats, ok := tsg.GetEncodeStats(ctx); ok {
+				m.encodedBytes.Add(context.Background(), stats.Bytes,
+					metric.WithAttributes(attribute.String("format", stats.Format)))
+			}
+		})
+	}
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format,
+// so the metrics can be used as a Prometheus endpoint.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	if err := m.WritePrometheus(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// WritePrometheusFile writes the metrics in the Prometheus text format to
+// the file. The file is replaced in one move, so it can be read by the
+// node exporter textfile collector while openTSG is running.
+func (m *Metrics) WritePrometheusFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := m.WritePrometheus(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// WritePrometheus writes the metrics in the Prometheus text format.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	var rm metricdata.ResourceMetrics
+	if err := m.reader.Collect(context.Background(), &rm); err != nil {
+		return err
+	}
+
+	var out strings.Builder
+	for _, sm := range rm.ScopeMetrics {
+		for _, md := range sm.Metrics {
+			writePromMetric(&out, md)
+		}
+	}
+
+	_, err := io.WriteString(w, out.String())
+
+	return err
+}
+
+// writePromMetric writes the counters and histograms of openTSG
+func writePromMetric(out *strings.Builder, md metricdata.Metrics) {
+	name := promName(md.Name, md.Unit)
+
+	switch data := md.Data.(type) {
+	case metricdata.Sum[int64]:
+		name += "_total"
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s counter\n", name, md.Description, name)
+
+		lines := make([]string, len(data.DataPoints))
+		for i, dp := range data.DataPoints {
+			lines[i] = fmt.Sprintf("%s%s %v\n", name, promLabels(dp.Attributes), dp.Value)
+		}
+		sort.Strings(lines)
+		out.WriteString(strings.Join(lines, ""))
+
+	case metricdata.Histogram[float64]:
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s histogram\n", name, md.Description, name)
+
+		points := make([]string, len(data.DataPoints))
+		for i, dp := range data.DataPoints {
+			var point strings.Builder
+			count := uint64(0)
+			for b, bound := range dp.Bounds {
+				count += dp.BucketCounts[b]
+				fmt.Fprintf(&point, "%s_bucket%s %v\n", name, promLabels(dp.Attributes, "le", promFloat(bound)), count)
+			}
+			fmt.Fprintf(&point, "%s_bucket%s %v\n", name, promLabels(dp.Attributes, "le", "+Inf"), dp.Count)
+			fmt.Fprintf(&point, "%s_sum%s %v\n", name, promLabels(dp.Attributes), promFloat(dp.Sum))
+			fmt.Fprintf(&point, "%s_count%s %v\n", name, promLabels(dp.Attributes), dp.Count)
+			points[i] = point.String()
+		}
+		sort.Strings(points)
+		out.WriteString(strings.Join(points, ""))
+	}
+}
+
+// promName converts the OpenTelemetry name and unit
+// to a Prometheus metric name.
+func promName(name, unit string) string {
+	name = strings.NewReplacer(".", "_", "-", "_").Replace(name)
+
+	switch unit {
+	case "s":
+		name += "_seconds"
+	case "By":
+		name += "_bytes"
+	}
+
+	return name
+}
+
+// promLabels writes the attributes as sorted Prometheus labels,
+// with any extra label key value pairs added at the end.
+func promLabels(set attribute.Set, extra ...string) string {
+	var labels []string
+	for _, kv := range set.ToSlice() {
+		labels = append(labels, fmt.Sprintf("%s=%q", kv.Key, promEscape(kv.Value.Emit())))
+	}
+
+	for i := 0; i+1 < len(extra); i += 2 {
+		labels = append(labels, fmt.Sprintf("%s=%q", extra[i], extra[i+1]))
+	}
+
+	if len(labels) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+// promEscape removes the characters that %q would
+// escape differently to the Prometheus format.
+func promEscape(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\n' {
+			return -1
+		}
+
+		return r
+	}, value)
+}
+
+func promFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mrmxf/opentsg-modules/opentsg-core/tsg"
+	. "github.com/smartystreets/goconvey/convey"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+type metricHandler struct {
+}
+
+func (m metricHandler) Handle(resp tsg.Response, _ *tsg.Request) {
+	resp.Write(tsg.WidgetSuccess, "success")
+}
+
+func TestMetrics(t *testing.T) {
+
+	stdout := bytes.NewBuffer([]byte{})
+	reader, readErr := StdoutMetricReader(&WriterConfiguration{Writer: stdout}, time.Hour)
+	metrics, err := NewMetrics(sdkmetric.WithReader(reader), MetricResources(&ResourceOptions{ServiceName: "metrics test"}))
+
+	otsg, buildErr := tsg.BuildOpenTSG("./testdata/metrics/loader.json", "", true, &tsg.RunnerConfiguration{RunnerCount: 2, ProfilerEnabled: true})
+	otsg.Handle("test.metric", []byte("{}"), metricHandler{})
+	tsg.AddBaseEncoders(otsg)
+	otsg.Use(metrics.Middleware())
+	otsg.UseContextMiddleware(metrics.ContextMiddleware())
+	dir := t.TempDir()
+	otsg.Run(dir)
+
+	info, statErr := os.Stat(filepath.Join(dir, "metrics.png"))
+
+	search := metrics.SearchMiddleware()(tsg.SearchFunc(func(_ context.Context, URI string) ([]byte, error) {
+		if URI == "missing" {
+			return nil, fmt.Errorf("not found")
+		}
+
+		return []byte("found"), nil
+	}))
+	search.Search(context.Background(), "found")
+	search.Search(context.Background(), "missing")
+
+	prom := bytes.NewBuffer([]byte{})
+	promErr := metrics.WritePrometheus(prom)
+
+	Convey("Checking the metrics of an openTSG run are recorded", t, func() {
+		Convey("running a single frame with one widget and the canvas, then two searches", func() {
+			Convey("the prometheus output contains every metric", func() {
+				So(err, ShouldBeNil)
+				So(readErr, ShouldBeNil)
+				So(buildErr, ShouldBeNil)
+				So(statErr, ShouldBeNil)
+				So(promErr, ShouldBeNil)
+				So(prom.String(), ShouldContainSubstring, "# TYPE opentsg_frames_total counter\n")
+				So(prom.String(), ShouldContainSubstring, `opentsg_frames_total{result="success"} 1`)
+				So(prom.String(), ShouldContainSubstring, `opentsg_widgets_total{status="200.001",widget_type="test.metric"} 1`)
+				So(prom.String(), ShouldContainSubstring, "# TYPE opentsg_widget_duration_seconds histogram\n")
+				So(prom.String(), ShouldContainSubstring, `opentsg_widget_duration_seconds_count{widget_type="test.metric"} 1`)
+				So(prom.String(), ShouldContainSubstring, `opentsg_widget_duration_seconds_bucket{widget_type="test.metric",le="+Inf"} 1`)
+				So(prom.String(), ShouldContainSubstring, fmt.Sprintf(`opentsg_encode_size_bytes_total{format="PNG"} %v`, info.Size()))
+				So(prom.String(), ShouldContainSubstring, `opentsg_search_duration_seconds_count{result="success"} 1`)
+				So(prom.String(), ShouldContainSubstring, `opentsg_search_duration_seconds_count{result="fail"} 1`)
+			})
+		})
+	})
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	promFile := filepath.Join(t.TempDir(), "opentsg.prom")
+	fileErr := metrics.WritePrometheusFile(promFile)
+	fileProm, _ := os.ReadFile(promFile)
+
+	shutErr := metrics.Shutdown(context.Background())
+
+	Convey("Checking the metrics are exported", t, func() {
+		Convey("using the http handler, a prometheus file and the stdout exporter", func() {
+			Convey("every output contains the metrics", func() {
+				So(rec.Header().Get("Content-Type"), ShouldStartWith, "text/plain; version=0.0.4")
+				So(rec.Body.String(), ShouldContainSubstring, `opentsg_frames_total{result="success"} 1`)
+				So(fileErr, ShouldBeNil)
+				So(string(fileProm), ShouldContainSubstring, `opentsg_frames_total{result="success"} 1`)
+				So(shutErr, ShouldBeNil)
+				So(stdout.String(), ShouldContainSubstring, FramesMetric)
+				So(stdout.String(), ShouldContainSubstring, "metrics test")
+			})
+		})
+	})
+}
@@ -0,0 +1,186 @@
+package tsg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mrmxf/opentsg-modules/opentsg-core/colour"
+	"github.com/mrmxf/opentsg-modules/opentsg-io/dpx"
+	"github.com/mrmxf/opentsg-modules/opentsg-io/exr"
+	"golang.org/x/image/tiff"
+)
+
+// Decoder is a function for decoding an image file into a colour space aware image.
+// If the colour space of the file is unknown, then the image has an empty colour space.
+type Decoder func(io.Reader) (colour.Image, error)
+
+type decoder struct {
+	magic  [][]byte
+	decode Decoder
+}
+
+// DecoderFunc registers the decoder for the given file extension, with
+// the magic bytes that start every file of that type.
+//
+// Files are matched to a decoder by their magic bytes first, so
+// files with the wrong extension are still decoded.
+// If the magic bytes are nil, the decoder is only used for files with the extension.
+func (o OpenTSG) DecoderFunc(extension string, magic [][]byte, decode Decoder) {
+	registerDecoder(o.decoders, extension, magic, decode)
+}
+
+func registerDecoder(decoders map[string]decoder, extension string, magic [][]byte, decode Decoder) {
+	extension = strings.ToUpper(extension)
+	if _, ok := decoders[extension]; ok {
+		panic(fmt.Sprintf("The decoder extension %s has already been declared", extension))
+	}
+
+	decoders[extension] = decoder{magic: magic, decode: decode}
+}
+
+var (
+	pngMagic  = [][]byte{[]byte("\x89PNG\r\n\x1a\n")}
+	tiffMagic = [][]byte{[]byte("II*\x00"), []byte("MM\x00*")}
+	dpxMagic  = [][]byte{[]byte("SDPX"), []byte("XPDS")}
+	exrMagic  = [][]byte{{0x76, 0x2F, 0x31, 0x01}}
+)
+
+// baseDecoders are used by requests when
+// no decoders have been added to openTSG.
+var baseDecoders = func() map[string]decoder {
+	decoders := map[string]decoder{}
+	addBaseDecoders(decoders)
+
+	return decoders
+}()
+
+/*
+AddBaseDecoders adds the following file decoders to an OpenTSG object:
+
+  - png
+  - tiff (as tiff and tif)
+  - dpx
+  - exr
+
+If no decoders are added, then these decoders are used.
+*/
+func AddBaseDecoders(tsg *OpenTSG) {
+	addBaseDecoders(tsg.decoders)
+}
+
+func addBaseDecoders(decoders map[string]decoder) {
+	registerDecoder(decoders, "png", pngMagic, DecodePngFile)
+	registerDecoder(decoders, "tiff", tiffMagic, DecodeTiffFile)
+	registerDecoder(decoders, "tif", tiffMagic, DecodeTiffFile)
+	registerDecoder(decoders, "dpx", dpxMagic, DecodeDPXFile)
+	registerDecoder(decoders, "exr", exrMagic, DecodeExrFile)
+}
+
+// decodeImage decodes an image with the decoders of openTSG
+func (tsg *OpenTSG) decodeImage(filename string, data []byte) (colour.Image, error) {
+	return Request{decoders: tsg.decoders}.DecodeImage(filename, data)
+}
+
+// decodeWith finds the decoder for the file and decodes it.
+func decodeWith(decoders map[string]decoder, filename string, data []byte) (colour.Image, error) {
+	// search in alphabetical order so
+	// the chosen decoder is always the same
+	extensions := make([]string, 0, len(decoders))
+	for ext := range decoders {
+		extensions = append(extensions, ext)
+	}
+	sort.Strings(extensions)
+
+	for _, ext := range extensions {
+		for _, magic := range decoders[ext].magic {
+			if len(magic) > 0 && bytes.HasPrefix(data, magic) {
+				return decoders[ext].decode(bytes.NewReader(data))
+			}
+		}
+	}
+
+	// fall back to the extension for decoders without magic bytes
+	ext := strings.ToUpper(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if dec, ok := decoders[ext]; ok && len(dec.magic) == 0 {
+		return dec.decode(bytes.NewReader(data))
+	}
+
+	return nil, fmt.Errorf("%s is an invalid file type", filename)
+}
+
+///////////////////////////////
+// Decode function wrappers //
+//////////////////////////////
+
+// DecodePngFile decodes a png file, with an empty colour space
+func DecodePngFile(r io.Reader) (colour.Image, error) {
+	img, err := png.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return toNRGBA64(img), nil
+}
+
+// DecodeTiffFile decodes a tiff file, with an empty colour space
+func DecodeTiffFile(r io.Reader) (colour.Image, error) {
+	img, err := tiff.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return toNRGBA64(img), nil
+}
+
+// DecodeDPXFile decodes a dpx file, with the colour space
+// of its colorimetric specification
+func DecodeDPXFile(r io.Reader) (colour.Image, error) {
+	img, err := dpx.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// DecodeExrFile decodes an exr file, with the colour space
+// of its chromaticities
+func DecodeExrFile(r io.Reader) (colour.Image, error) {
+	img, err := exr.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// toNRGBA64 converts an image to a colour.NRGBA64,
+// with bounds starting at 0,0 and no colour space.
+func toNRGBA64(img image.Image) *colour.NRGBA64 {
+	b := img.Bounds()
+	out := colour.NewNRGBA64(colour.ColorSpace{}, image.Rectangle{Max: b.Size()})
+	base := out.BaseImage()
+
+	// copy the pixels directly if they are already NRGBA64
+	if nrgba, ok := img.(*image.NRGBA64); ok {
+		for y := 0; y < b.Dy(); y++ {
+			copy(base.Pix[y*base.Stride:(y+1)*base.Stride], nrgba.Pix[nrgba.PixOffset(b.Min.X, b.Min.Y+y):])
+		}
+
+		return out
+	}
+
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			base.Set(x, y, img.At(x+b.Min.X, y+b.Min.Y))
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,78 @@
+package tsg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/mrmxf/opentsg-modules/opentsg-core/colour"
+	"github.com/mrmxf/opentsg-modules/opentsg-io/dpx"
+	"github.com/mrmxf/opentsg-modules/opentsg-io/exr"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDecoders(t *testing.T) {
+
+	base := image.NewNRGBA64(image.Rect(0, 0, 8, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			base.Set(x, y, color.NRGBA64{R: uint16(x * 8000), G: uint16(y * 16000), B: 0x4000, A: 0xffff})
+		}
+	}
+
+	var pngBuf, dpxBuf, exrBuf bytes.Buffer
+	png.Encode(&pngBuf, base)
+	dpx.Encode(&dpxBuf, base, nil)
+	exr.Encode(&exrBuf, base)
+
+	// the files are named with the wrong extension,
+	// to check the magic bytes are used
+	names := []string{"frame.png", "frame.png", "frame.dpx"}
+	files := [][]byte{pngBuf.Bytes(), dpxBuf.Bytes(), exrBuf.Bytes()}
+	spaces := []colour.ColorSpace{{}, {}, {ColorSpace: "rec709"}}
+	// the half floats of the exr do not keep every 16 bit value
+	corners := []color.NRGBA64{base.NRGBA64At(7, 3), base.NRGBA64At(7, 3), {R: 55999, G: 47999, B: 16384, A: 65535}}
+
+	for i, name := range names {
+		img, err := Request{}.DecodeImage(name, files[i])
+
+		Convey("Checking images are decoded with the base decoders", t, func() {
+			Convey(fmt.Sprintf("using %s with the magic bytes %q", name, files[i][:4]), func() {
+				Convey("the image is decoded with the colour space of the file", func() {
+					So(err, ShouldBeNil)
+					So(img.Bounds(), ShouldResemble, base.Bounds())
+					So(img.Space(), ShouldResemble, spaces[i])
+					So(img.(*colour.NRGBA64).BaseImage().NRGBA64At(7, 3), ShouldResemble, corners[i])
+				})
+			})
+		})
+	}
+
+	otsg, err := BuildOpenTSG("./testdata/handlerLoaders/loader.json", "", true, nil)
+	AddBaseDecoders(otsg)
+	// a decoder that is only found by its extension
+	otsg.DecoderFunc("raw", nil, func(r io.Reader) (colour.Image, error) {
+		return colour.NewNRGBA64(colour.ColorSpace{ColorSpace: "rec2020"}, image.Rect(0, 0, 2, 2)), nil
+	})
+
+	raw, rawErr := otsg.decodeImage("frame.raw", []byte("raw pixels"))
+	_, txtErr := otsg.decodeImage("frame.txt", []byte("raw pixels"))
+	_, fakeErr := otsg.decodeImage("frame.png", []byte("not a png"))
+
+	Convey("Checking custom decoders are added to openTSG", t, func() {
+		Convey("using a raw decoder without magic bytes", func() {
+			Convey("only files with the extension are decoded and redeclaring decoders panics", func() {
+				So(err, ShouldBeNil)
+				So(rawErr, ShouldBeNil)
+				So(raw.Space(), ShouldResemble, colour.ColorSpace{ColorSpace: "rec2020"})
+				So(txtErr, ShouldResemble, fmt.Errorf("frame.txt is an invalid file type"))
+				So(fakeErr, ShouldResemble, fmt.Errorf("frame.png is an invalid file type"))
+				So(func() { AddBaseDecoders(otsg) }, ShouldPanic)
+			})
+		})
+	})
+}
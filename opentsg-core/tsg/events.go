@@ -0,0 +1,127 @@
+package tsg
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is the type of an openTSG run event
+type EventType string
+
+const (
+	// RunStarted is sent once, before any frames are run
+	RunStarted EventType = "RunStarted"
+	// FrameStarted is sent when a frame starts being generated
+	FrameStarted EventType = "FrameStarted"
+	// WidgetQueued is sent when a widget has been run, and
+	// is waiting to be composited onto the frame
+	WidgetQueued EventType = "WidgetQueued"
+	// WidgetCompleted is sent when a widget has been composited,
+	// or failed to run
+	WidgetCompleted EventType = "WidgetCompleted"
+	// FrameEncoded is sent for every file a frame is saved as
+	FrameEncoded EventType = "FrameEncoded"
+	// FrameFinished is sent when a frame is finished, with the
+	// FrameSuccess or FrameFail status
+	FrameFinished EventType = "FrameFinished"
+	// RunFinished is sent once, after every frame has run or the
+	// error policy stopped the run, with the RunSuccess or RunFail status
+	RunFinished EventType = "RunFinished"
+)
+
+// Event is a progress event of an openTSG run.
+// Fields that are not relevant to the event type are left empty.
+type Event struct {
+	Type EventType `json:"type"`
+	// Time is when the event happened
+	Time time.Time `json:"time"`
+	// JobID is the job ID of the frame
+	JobID string `json:"jobID,omitempty"`
+	// Frame is the frame number of the event
+	Frame int `json:"frame"`
+	// FrameCount is the total number of frames in the run
+	FrameCount int `json:"frameCount"`
+	// WidgetID is the full ID of the widget
+	WidgetID string `json:"widgetID,omitempty"`
+	// WidgetType is the type of the widget
+	WidgetType string `json:"widgetType,omitempty"`
+	// Status is the final status code of the widget, frame or run
+	Status StatusCode `json:"status,omitempty"`
+	// File is the file the frame was encoded as
+	File string `json:"file,omitempty"`
+	// Duration is the time taken, for widgets this is the time from
+	// set up until completion, for FrameEncoded the encode time and
+	// for FrameFinished and RunFinished the total time.
+	Duration time.Duration `json:"duration(ns),omitempty"`
+	// Errors is the count of errors in the frame, or the run
+	Errors int `json:"errors,omitempty"`
+	// FramesDone is the count of frames that have finished
+	FramesDone int `json:"framesDone"`
+	// ETA is the estimated time for the rest of the run to finish,
+	// based on the average time of the frames that have finished
+	ETA time.Duration `json:"ETA(ns)"`
+}
+
+// eventStream sends the events to every subscriber
+type eventStream struct {
+	mu          sync.Mutex
+	subscribers []func(Event)
+
+	start      time.Time
+	frameCount int
+	framesDone int
+}
+
+// Subscribe adds a function that is called with every event of a run.
+// Subscribers are called one event at a time, in the order the events
+// happen, so they do not need to be safe for concurrent use.
+//
+// Subscribers block openTSG while they run, so slow subscribers
+// should pass the events on to a buffered channel.
+func (o *OpenTSG) Subscribe(subscriber func(Event)) {
+	o.events.mu.Lock()
+	o.events.subscribers = append(o.events.subscribers, subscriber)
+	o.events.mu.Unlock()
+}
+
+// startRun resets the stream for a new run
+func (e *eventStream) startRun(frameCount int) {
+	e.mu.Lock()
+	e.start = time.Now()
+	e.frameCount = frameCount
+	e.framesDone = 0
+	e.mu.Unlock()
+
+	e.send(Event{Type: RunStarted})
+}
+
+// send fills in the run progress of the event
+// and sends it to every subscriber.
+func (e *eventStream) send(ev Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if ev.Type == FrameFinished {
+		e.framesDone++
+	}
+
+	if len(e.subscribers) == 0 {
+		return
+	}
+
+	ev.Time = time.Now()
+	ev.FrameCount = e.frameCount
+	ev.FramesDone = e.framesDone
+	if e.framesDone > 0 {
+		perFrame := ev.Time.Sub(e.start) / time.Duration(e.framesDone)
+		ev.ETA = perFrame * time.Duration(e.frameCount-e.framesDone)
+	}
+
+	if ev.Type == RunFinished {
+		ev.Duration = ev.Time.Sub(e.start)
+	}
+
+	for _, sub := range e.subscribers {
+		sub(ev)
+	}
+}
@@ -0,0 +1,54 @@
+package tsg
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEvents(t *testing.T) {
+
+	otsg, buildErr := BuildOpenTSG("./testdata/handlerLoaders/loader.json", "", true, &RunnerConfiguration{RunnerCount: 3})
+	otsg.Handle("test.fill", []byte("{}"), Filler{})
+	AddBaseEncoders(otsg)
+
+	var events []Event
+	otsg.Subscribe(func(e Event) {
+		events = append(events, e)
+	})
+	otsg.Run("")
+	os.Remove("./testdata/handlerLoaders/racer.png")
+
+	counts := map[EventType]int{}
+	for _, e := range events {
+		counts[e.Type]++
+	}
+
+	completed := map[string]StatusCode{}
+	for _, e := range events {
+		if e.Type == WidgetCompleted {
+			completed[e.WidgetID] = e.Status
+		}
+	}
+
+	Convey("Checking the events of a run are sent to subscribers", t, func() {
+		Convey("running a single frame of three fill widgets and a canvas", func() {
+			Convey("every event is sent in order, with the progress of the run", func() {
+				So(buildErr, ShouldBeNil)
+				So(len(events), ShouldBeGreaterThan, 2)
+				So(events[0].Type, ShouldEqual, RunStarted)
+				So(events[0].FrameCount, ShouldEqual, 1)
+				So(events[1].Type, ShouldEqual, FrameStarted)
+				So(events[len(events)-2].Type, ShouldEqual, FrameFinished)
+				So(events[len(events)-2].Status, ShouldEqual, FrameSuccess)
+				So(events[len(events)-1].Type, ShouldEqual, RunFinished)
+				So(events[len(events)-1].FramesDone, ShouldEqual, 1)
+				So(events[len(events)-1].ETA, ShouldEqual, 0)
+				So(counts, ShouldResemble, map[EventType]int{RunStarted: 1, FrameStarted: 1, WidgetQueued: 4,
+					WidgetCompleted: 4, FrameEncoded: 1, FrameFinished: 1, RunFinished: 1})
+				So(completed["cs.red"], ShouldEqual, 200)
+			})
+		})
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"image/draw"
 	"io"
+	"io/fs"
 	"math"
 	"reflect"
 	"strconv"
@@ -34,8 +35,10 @@ type OpenTSG struct {
 	middlewares []func(Handler) Handler
 	//
 	searchMiddleware   []func(Search) Search
-	encoders           map[string]Encoder
+	encoders           map[string]encoder
+	decoders           map[string]decoder
 	contextMiddlewares []func(ContFunc) ContFunc
+	events             *eventStream
 	// runner configuration
 	runnerConf RunnerConfiguration
 }
@@ -63,6 +66,26 @@ func setName(ctx context.Context, name string) context.Context {
 	return context.WithValue(ctx, contName, name)
 }
 
+const encodeStatsKey = contKey("encode stats for context middleware")
+
+// EncodeStats are the details of a file being encoded,
+// the Bytes are set once the encoder has run.
+type EncodeStats struct {
+	// Format is the upper case file extension
+	Format string
+	// Bytes is the size of the encoded file
+	Bytes int64
+}
+
+// GetEncodeStats gets the encode stats from the context of an encoder,
+// to be used in tandem with a ContFunc. It returns false for contexts
+// that are not encoding a file.
+func GetEncodeStats(ctx context.Context) (*EncodeStats, bool) {
+	stats, ok := ctx.Value(encodeStatsKey).(*EncodeStats)
+
+	return stats, ok
+}
+
 // Make a getter
 
 // RunnerConfiguration is the set up for the internal runners
@@ -73,6 +96,17 @@ type RunnerConfiguration struct {
 	RunnerCount int
 	// Enable the profiler
 	ProfilerEnabled bool
+	// WidgetTimeout is the longest a widget handler can run
+	// before it is cancelled, there is no timeout if it is 0.
+	WidgetTimeout time.Duration
+	// SearchPaths are the folders that files are searched for in,
+	// after the folders of the factories.
+	SearchPaths []string
+	// ErrorPolicy is how the run handles errors, it is Lenient if empty.
+	ErrorPolicy ErrorPolicy
+	// ErrorThreshold is the count of errors that stops
+	// the run when the ErrorPolicy is Threshold.
+	ErrorThreshold int
 }
 
 type hand struct {
@@ -80,19 +114,64 @@ type hand struct {
 	handler Handler
 }
 
+type encoder struct {
+	schema []byte
+	encode Encoder
+}
+
 // BuildOpenTSG creates the OpenTSG engine.
 // It is configured by an input json file and any profile set up information.
 func BuildOpenTSG(inputFile string, profile string, debug bool, runnerConf *RunnerConfiguration, httpsKeys ...string) (*OpenTSG, error) {
-	cont, framenumber, configErr := core.FileImport(inputFile, profile, debug, httpsKeys...)
+	return BuildOpenTSGFS(nil, inputFile, profile, debug, runnerConf, httpsKeys...)
+}
+
+// BuildOpenTSGFS creates the OpenTSG engine from a factory in a filesystem,
+// such as an embed.FS. The includes and assets of the factory are read from
+// the filesystem, unless they are urls. The disk is used if fsys is nil.
+func BuildOpenTSGFS(fsys fs.FS, inputFile string, profile string, debug bool, runnerConf *RunnerConfiguration, httpsKeys ...string) (*OpenTSG, error) {
+	if runnerConf == nil {
+		runnerConf = &RunnerConfiguration{RunnerCount: 1}
+	}
+
+	if err := runnerConf.ErrorPolicy.validate(runnerConf.ErrorThreshold); err != nil {
+		return nil, err
+	}
+
+	cont, framenumber, configErr := core.FileImportWith(inputFile, profile, debug,
+		core.ImportOptions{SearchPaths: runnerConf.SearchPaths, FS: fsys}, httpsKeys...)
 
 	if configErr != nil {
 		return nil, configErr
 	}
 
+	return newOpenTSG(cont, framenumber, runnerConf), nil
+}
+
+// BuildOpenTSGBytes creates the OpenTSG engine from the bytes of a factory.
+// The name is the virtual path of the factory, the includes and assets are
+// found relative to its folder in fsys, or on the disk if fsys is nil.
+func BuildOpenTSGBytes(factory []byte, name string, fsys fs.FS, profile string, debug bool, runnerConf *RunnerConfiguration, httpsKeys ...string) (*OpenTSG, error) {
 	if runnerConf == nil {
 		runnerConf = &RunnerConfiguration{RunnerCount: 1}
 	}
 
+	if err := runnerConf.ErrorPolicy.validate(runnerConf.ErrorThreshold); err != nil {
+		return nil, err
+	}
+
+	cont, framenumber, configErr := core.BytesImport(factory, name, profile, debug,
+		core.ImportOptions{SearchPaths: runnerConf.SearchPaths, FS: fsys}, httpsKeys...)
+
+	if configErr != nil {
+		return nil, configErr
+	}
+
+	return newOpenTSG(cont, framenumber, runnerConf), nil
+}
+
+// newOpenTSG sets up the OpenTSG engine for an imported factory
+func newOpenTSG(cont context.Context, framenumber int, runnerConf *RunnerConfiguration) *OpenTSG {
+
 	// stop negative runners appearing
 	// and just locking everything up
 	if runnerConf.RunnerCount < 1 {
@@ -101,13 +180,15 @@ func BuildOpenTSG(inputFile string, profile string, debug bool, runnerConf *Runn
 
 	opentsg := &OpenTSG{internal: cont, framecount: framenumber,
 		handlers:   map[string]hand{},
-		encoders:   map[string]Encoder{},
+		encoders:   map[string]encoder{},
+		decoders:   map[string]decoder{},
+		events:     &eventStream{},
 		runnerConf: *runnerConf}
 
 	// set up a canvaswidget handler, that runs empty
 	opentsg.HandleFunc(canvaswidget.WType, HandlerFunc(func(_ Response, _ *Request) {}))
 
-	return opentsg, nil
+	return opentsg
 }
 
 // NameSave is the extensions and encode function struct
@@ -159,7 +240,8 @@ func metaHookHandle(input draw.Image, c *context.Context) (map[string]any, error
 	}
 
 	if canvaswidget.GetMetaConfiguration(*c) {
-		metaDataMap["Frame Configuration"] = extractMetadata(c, "", "")
+		// secrets from the factories are not written to the metadata
+		metaDataMap["Frame Configuration"] = core.Redact(*c, extractMetadata(c, "", ""))
 	}
 	// return some hook stats
 
@@ -13,7 +13,10 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mrmxf/opentsg-modules/opentsg-core/colour"
 	"github.com/mrmxf/opentsg-modules/opentsg-core/gridgen"
@@ -107,6 +110,29 @@ func TestHandlerAdditions(t *testing.T) {
 	})
 }
 
+func TestBuildFS(t *testing.T) {
+	fsys := os.DirFS("./testdata/handlerLoaders")
+	loader, _ := os.ReadFile("./testdata/handlerLoaders/loader.json")
+
+	diskTSG, diskErr := BuildOpenTSG("./testdata/handlerLoaders/loader.json", "", true, nil)
+	fsTSG, fsErr := BuildOpenTSGFS(fsys, "loader.json", "", true, nil)
+	bytesTSG, bytesErr := BuildOpenTSGBytes(loader, "virtual.json", fsys, "", true, nil)
+	_, missingErr := BuildOpenTSGFS(fsys, "missing.json", "", true, nil)
+
+	Convey("Checking openTSG is built from a filesystem and from bytes", t, func() {
+		Convey("using the handler loader as a os.DirFS and as bytes with a virtual path", func() {
+			Convey("the includes are found in the filesystem and the frames match the disk", func() {
+				So(diskErr, ShouldBeNil)
+				So(fsErr, ShouldBeNil)
+				So(bytesErr, ShouldBeNil)
+				So(fsTSG.framecount, ShouldEqual, diskTSG.framecount)
+				So(bytesTSG.framecount, ShouldEqual, diskTSG.framecount)
+				So(missingErr, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
 func TestMethodFunctions(t *testing.T) {
 	// @TODO test the response and request methods
 
@@ -179,6 +205,56 @@ type JSONLog struct {
 	WidgetID   string `json:"WidgetID"`
 }
 
+func TestFloatCanvas(t *testing.T) {
+	otsg, buildErr := BuildOpenTSG("./testdata/float/loader.json", "", true, &RunnerConfiguration{RunnerCount: 5})
+	otsg.Handle("test.fill", []byte("{}"), Filler{})
+	AddBaseEncoders(otsg)
+
+	// the widgets run concurrently, so the type is only set once
+	var canvasType string
+	var typeOnce sync.Once
+	otsg.Use(func(next Handler) Handler {
+		return HandlerFunc(func(resp Response, req *Request) {
+			typeOnce.Do(func() {
+				canvasType = reflect.TypeOf(resp.BaseImage()).String()
+			})
+			next.Handle(resp, req)
+		})
+	})
+	// the outputs and their hash files are written to the temp dir
+	dir := t.TempDir()
+	otsg.Run(dir)
+
+	genFile, genErr := os.Open(filepath.Join(dir, "racer.png"))
+	var genImage *image.NRGBA64
+	if genErr == nil {
+		baseVals, _ := png.Decode(genFile)
+		genFile.Close()
+		genImage = image.NewNRGBA64(baseVals.Bounds())
+		colour.Draw(genImage, genImage.Bounds(), baseVals, image.Point{0, 0}, draw.Over)
+	}
+
+	controlFile, _ := os.Open("./testdata/handlerLoaders/expectedRace.png")
+	controlVals, _ := png.Decode(controlFile)
+	controlFile.Close()
+	controlImage := image.NewNRGBA64(controlVals.Bounds())
+	colour.Draw(controlImage, controlImage.Bounds(), controlVals, image.Point{0, 0}, draw.Over)
+
+	_, exrErr := os.Stat(filepath.Join(dir, "racer.exr"))
+
+	Convey("Checking float canvases are generated and saved", t, func() {
+		Convey("running boxes on top of each other on a float canvas, saved as a png and exr", func() {
+			Convey("the widgets are given float images and the png matches the 16 bit canvas", func() {
+				So(buildErr, ShouldBeNil)
+				So(genErr, ShouldBeNil)
+				So(exrErr, ShouldBeNil)
+				So(canvasType, ShouldEqual, "*colour.NRGBAF32")
+				So(genImage.Pix, ShouldResemble, controlImage.Pix)
+			})
+		})
+	})
+}
+
 func TestMiddlewares(t *testing.T) {
 
 	otsg, err := BuildOpenTSG("./testdata/handlerLoaders/loader.json", "", true, nil)
@@ -524,12 +600,13 @@ func TestQueue(t *testing.T) {
 	for i, ba := range areas {
 		out := setUpPoolRunner(0, firstRun[i], false)
 
-		pass := out.drawers.check(3, ba)
+		pass, blocker := out.drawers.check(3, ba)
 		fmt.Println(out.drawers.drawQueue)
 		Convey("Checking the z order handler stops premature widgets", t, func() {
 			Convey(message[i], func() {
-				Convey("A false value is returned stating it is not the widgets turn", func() {
+				Convey("A false value is returned stating it is not the widgets turn, with the blocking widget", func() {
 					So(pass, ShouldBeFalse)
+					So(blocker, ShouldEqual, 0)
 				})
 			})
 		})
@@ -547,7 +624,7 @@ func TestQueue(t *testing.T) {
 	for i, ba := range areas {
 		out := setUpPoolRunner(0, true, runStatus[i])
 
-		pass := out.drawers.check(3, ba)
+		pass, _ := out.drawers.check(3, ba)
 		fmt.Println(out.drawers.drawQueue)
 		Convey("Checking the z order handler allows widgets that do not clash", t, func() {
 			Convey(message[i], func() {
@@ -617,3 +694,77 @@ func (ts *testSlog) WithAttrs(attrs []slog.Attr) slog.Handler {
 func (ts *testSlog) WithGroup(name string) slog.Handler {
 	return ts
 }
+
+// misbehaver panics for red and never finishes for green
+type misbehaver struct {
+	Fill string `json:"fill" yaml:"fill"`
+}
+
+func (m misbehaver) Handle(r Response, req *Request) {
+	switch m.Fill {
+	case "red":
+		var fills []colour.Color
+		_ = fills[3]
+	case "green":
+		<-req.Context.Done()
+
+		return
+	}
+
+	Filler{Fill: m.Fill}.Handle(r, req)
+}
+
+func TestPanicsAndTimeouts(t *testing.T) {
+
+	otsg, err := BuildOpenTSG("./testdata/handlerLoaders/loader.json", "", true, &RunnerConfiguration{RunnerCount: 1, WidgetTimeout: 500 * time.Millisecond})
+	AddBaseEncoders(otsg)
+	otsg.Handle("test.fill", []byte("{}"), misbehaver{})
+
+	logArr := testSlog{logs: make([]string, 0), level: slog.LevelError}
+	otsg.Use(Logger(slog.New(&logArr)))
+
+	statuses := map[string]StatusCode{}
+	var frameStatus StatusCode
+	otsg.Subscribe(func(e Event) {
+		switch e.Type {
+		case WidgetCompleted:
+			statuses[e.WidgetID] = e.Status
+		case FrameFinished:
+			frameStatus = e.Status
+		}
+	})
+
+	otsg.Run("")
+	_, statErr := os.Stat("./testdata/handlerLoaders/racer.png")
+	os.Remove("./testdata/handlerLoaders/racer.png")
+
+	Convey("Checking panicking and hanging widgets do not stop the frame", t, func() {
+		Convey("running a widget that panics, a widget that never finishes and a widget that works", func() {
+			Convey("the panic and timeout are logged as widget errors and the frame is still saved", func() {
+				So(err, ShouldBeNil)
+				So(statErr, ShouldBeNil)
+				So(frameStatus, ShouldEqual, FrameSuccess)
+				So(statuses, ShouldResemble, map[string]StatusCode{"cs.red": WidgetError, "cs.green": WidgetError,
+					"cs.blue": 200, "canvas": 0})
+				So(len(logArr.logs), ShouldEqual, 2)
+				So(logArr.logs, ShouldContain, "0056 the widget cs.green did not finish within 500ms: context deadline exceeded")
+			})
+		})
+	})
+
+	panicked := ""
+	for _, l := range logArr.logs {
+		if strings.HasPrefix(l, "0055") {
+			panicked = l
+		}
+	}
+
+	Convey("Checking panics are logged with a stack trace", t, func() {
+		Convey("using the log of the widget that panicked", func() {
+			Convey("the log has the panic message and the stack trace of the widget", func() {
+				So(panicked, ShouldStartWith, "0055 the widget cs.red panicked: runtime error: index out of range [3] with length 0")
+				So(panicked, ShouldContainSubstring, "misbehaver.Handle")
+			})
+		})
+	})
+}
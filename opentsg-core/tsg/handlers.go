@@ -8,6 +8,7 @@ import (
 	"image/draw"
 	"os"
 	"path/filepath"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"time"
@@ -64,6 +65,17 @@ func (o OpenTSG) Handle(wType string, schema []byte, handler Handler) {
 	o.handlers[wType] = hand{schema: schema, handler: handler}
 }
 
+// Lint checks the factory tree of the input file for problems, such as
+// unused args and includes. Widgets are checked against the registered widget types.
+func (o OpenTSG) Lint(inputFile, profile string, httpKeys ...string) ([]core.LintIssue, error) {
+	wTypes := make([]string, 0, len(o.handlers))
+	for wType := range o.handlers {
+		wTypes = append(wTypes, wType)
+	}
+
+	return core.Lint(inputFile, profile, core.LintOptions{WidgetTypes: wTypes, SearchPaths: o.runnerConf.SearchPaths}, httpKeys...)
+}
+
 type Search interface {
 	Search(ctx context.Context, URI string) ([]byte, error)
 }
@@ -117,6 +129,7 @@ type Request struct {
 
 	searchWithCredentials Search
 	getWidgetMetadata     func(alias, dotpath string) any
+	decoders              map[string]decoder
 }
 
 // SearchWithCredentials searches a URI utilising any login credentials used
@@ -131,6 +144,20 @@ func (r Request) SearchWithCredentials(ctx context.Context, URI string) ([]byte,
 	return r.searchWithCredentials.Search(ctx, URI)
 }
 
+// DecodeImage decodes the bytes of an image file, using the decoders
+// added to openTSG. The decoder is found by the magic bytes of the
+// data, then by the extension of the filename.
+//
+// If no decoders have been added then the png, tiff, dpx and exr
+// decoders are used.
+func (r Request) DecodeImage(filename string, data []byte) (colour.Image, error) {
+	if len(r.decoders) == 0 {
+		return decodeWith(baseDecoders, filename, data)
+	}
+
+	return decodeWith(r.decoders, filename, data)
+}
+
 // GenerateSubImage generates an image of area bounds, that matches the type of image given to it.
 //
 // Note it will not work with custom draw.Image types
@@ -139,6 +166,8 @@ func (r Request) GenerateSubImage(baseImg draw.Image, bounds image.Rectangle) dr
 	switch img := baseImg.(type) {
 	case *colour.NRGBA64:
 		return colour.NewNRGBA64(img.Space(), bounds)
+	case *colour.NRGBAF32:
+		return colour.NewNRGBAF32(img.Space(), bounds)
 	default:
 
 		return image.NewNRGBA64(bounds)
@@ -243,6 +272,7 @@ type StatusCode float64
 
 const (
 	FrameSuccess    = StatusCode(200.003)
+	RunSuccess      = StatusCode(200.004)
 	WidgetSuccess   = StatusCode(200.001)
 	SaveSuccess     = StatusCode(200.002)
 	WidgetNotFound  = StatusCode(404.001)
@@ -252,6 +282,7 @@ const (
 	WidgetError   = StatusCode(500.001)
 	WidgetWarning = StatusCode(400.001)
 	FrameFail     = StatusCode(400.003)
+	RunFail       = StatusCode(400.004)
 )
 
 // String prints the status code as 000.0000, ensuring the final 3 digits are printed
@@ -294,27 +325,48 @@ func (tsg *OpenTSG) logErrorsWithWarning(code StatusCode, frameNumber int, jobId
 }
 
 // Run starts the OpenTSG engine, it runs every frame given
-// to it from the set up file.
-func (tsg *OpenTSG) Run(mnt string) {
+// to it from the set up file. Frames are run until the
+// ErrorPolicy of the RunnerConfiguration stops the run.
+func (tsg *OpenTSG) Run(mnt string) RunResult {
 	imageNo := tsg.framecount
+	policy := tsg.runnerConf.ErrorPolicy
+	if policy == "" {
+		policy = Lenient
+	}
+	threshold := tsg.runnerConf.ErrorThreshold
+	result := RunResult{Policy: policy, Frames: imageNo}
+	if policy == Threshold {
+		result.Threshold = threshold
+	}
 
 	// wait for every frame to run before exiting the lopp
 	var wg sync.WaitGroup
-	wg.Add(tsg.framecount)
 
 	// hookdata is a large map that contains all the metadata across the run.
 	var locker sync.Mutex
 	hookdata := syncmap{&locker, make(map[string]any)}
 
 	runFile := time.Now().Format("2006-01-02T15:04:05")
+	tsg.events.startRun(imageNo)
 
 	for frameLoopNo := 0; frameLoopNo < imageNo; frameLoopNo++ {
+		// the previous frames have broken the error policy
+		if policy.exceeded(result.Errors, threshold) {
+			result.Aborted = true
+			tsg.logErrors(RunFail, frameLoopNo, "", fmt.Errorf("the %s error policy stopped the run after %v errors, %v of %v frames were not run",
+				policy, result.Errors, imageNo-frameLoopNo, imageNo))
+
+			break
+		}
+
 		// make an internal function
 		// so that a defer print statement can be used at the end of each frame generation
 		// and for running as a go this reduces time by about 40%?
 		frameNo := frameLoopNo
 		var frameWait sync.WaitGroup
 		frameWait.Add(1)
+		wg.Add(1)
+		frameErrors, frameFailed := 0, false
 
 		go func() {
 			defer wg.Done()
@@ -328,8 +380,9 @@ func (tsg *OpenTSG) Run(mnt string) {
 			// defer the progress bar message to use the values at the end of the "function"
 			// the idea is for them to auto update
 			defer func() {
-
+				status := FrameFail
 				if saveTime != 0 {
+					status = FrameSuccess
 					tsg.logErrors(FrameSuccess, frameNo, jobID,
 						fmt.Errorf("generating frame %v/%v, gen: %v ms, save: %sms, errors:%v", frameNo, imageNo-1,
 							microToMili(int64(time.Since(genMeasure).Microseconds())), microToMili(saveTime), monit.ErrorCount),
@@ -339,19 +392,30 @@ func (tsg *OpenTSG) Run(mnt string) {
 						fmt.Errorf("critical errors encountered, frame %v not generated, gen: %v ms", frameNo,
 							microToMili(int64(time.Since(genMeasure).Microseconds()))))
 				}
+
+				frameErrors, frameFailed = monit.ErrorCount, status == FrameFail
+				tsg.events.send(Event{Type: FrameFinished, JobID: jobID, Frame: frameNo, Status: status,
+					Duration: time.Since(genMeasure), Errors: monit.ErrorCount})
 				// add the log to the cache channel
 
 			}()
 
+			tsg.events.send(Event{Type: FrameStarted, JobID: jobID, Frame: frameNo})
+
 			// update metadata to be included in the frame context
 			frameConfigCont, errs := core.FrameWidgetsGeneratorHandle(tsg.internal, frameNo)
 
 			// this is important for showing missed widget updates
 			// log the errors
 			if len(errs) > 0 {
+				monit.incrementError(len(errs))
+				if policy.exceeded(result.Errors+monit.ErrorCount, threshold) {
+					tsg.logErrorsWithWarning(404, frameNo, jobID, fmt.Sprintf("OpenTSG stopping with the %s error policy", policy), errs...)
+
+					return
+				}
 
 				tsg.logErrorsWithWarning(404, frameNo, jobID, "OpenTSG still running", errs...)
-				monit.incrementError(len(errs))
 			}
 			frameContext := &frameConfigCont
 			errs = canvaswidget.LoopInitHandle(frameContext)
@@ -378,6 +442,7 @@ func (tsg *OpenTSG) Run(mnt string) {
 					ColorSpace: canvaswidget.GetBaseColourSpace(*frameContext),
 					Geometry:   canvaswidget.GetGeometry(*frameContext),
 					BaseImage:  canvaswidget.GetBaseImage(*frameContext),
+					Decode:     tsg.decodeImage,
 				})
 
 			if err != nil {
@@ -390,6 +455,11 @@ func (tsg *OpenTSG) Run(mnt string) {
 			// generate all the widgets
 			tsg.widgetHandle(frameContext, canvas, &monit)
 
+			// frames with errors that break the policy are not saved
+			if policy.exceeded(result.Errors+monit.ErrorCount, threshold) {
+				return
+			}
+
 			// get the metadata and add it onto the map for this frame
 			// @TODO update with the new metadata context
 			md, _ := metaHookHandle(canvas, frameContext)
@@ -404,19 +474,31 @@ func (tsg *OpenTSG) Run(mnt string) {
 
 			// save the image
 			saveMeasure := time.Now()
+			outputs := canvaswidget.GetOutputConfigurations(*frameContext)
 			carves := gridgen.Carve(frameContext, canvas, canvaswidget.GetOutputs(*frameContext))
 			for _, carvers := range carves {
 				// save.CanvasSave(canvas, canvaswidget.GetFileName(*frameContext), canvaswidget.GetFileDepth(*frameContext), mnt, i4, debug, frameLog)
-				tsg.canvasSave(carvers.Image, carvers.Location, canvaswidget.GetFileDepth(*frameContext), mnt, &monit)
+				tsg.canvasSave(carvers.Image, carvers.Location, outputs, canvaswidget.GetFileDepth(*frameContext), mnt, core.GetJSONLines(*frameContext), &monit)
 			}
 			saveTime = time.Since(saveMeasure).Microseconds()
 
 		}()
 		frameWait.Wait()
 
+		result.FramesRun++
+		result.Errors += frameErrors
+		if frameFailed {
+			result.FramesFailed++
+		}
 	}
 
 	wg.Wait()
+	result.Failed = policy.exceeded(result.Errors, threshold)
+	runStatus := RunSuccess
+	if result.Failed {
+		runStatus = RunFail
+	}
+	tsg.events.send(Event{Type: RunFinished, Status: runStatus, Errors: result.Errors})
 	fmt.Println("")
 
 	// move to a metadatahandler function
@@ -430,12 +512,27 @@ func (tsg *OpenTSG) Run(mnt string) {
 		md.Write(b)
 	}
 
+	return result
 }
 
 // CanvasSave saves the file according to the extensions provided
 // the name add is for debug to allow to identify images
-func (tsg *OpenTSG) canvasSave(canvas draw.Image, filename []string, bitdeph int, mnt string, monit *monitor) {
-	for _, name := range filename {
+// Each filename is saved with the options of the output at the same position.
+func (tsg *OpenTSG) canvasSave(canvas draw.Image, filename []string, outputs []canvaswidget.Output, bitdeph int, mnt string, lines validator.JSONLines, monit *monitor) {
+	for i, name := range filename {
+		var options map[string]any
+		if i < len(outputs) {
+			options = outputs[i].Options
+		}
+
+		// check the options are valid for the encoder
+		if errs := tsg.validateOutputOptions(name, options, lines); len(errs) > 0 {
+			monit.incrementError(len(errs))
+			tsg.logErrors(700, monit.frameNo, monit.jobID, errs...)
+
+			continue
+		}
+
 		truepath, err := filepath.Abs(filepath.Join(mnt, name))
 		if err != nil {
 			monit.incrementError(1)
@@ -444,15 +541,38 @@ func (tsg *OpenTSG) canvasSave(canvas draw.Image, filename []string, bitdeph int
 			continue
 		}
 
-		err = tsg.encodeFrame(truepath, canvas, EncodeOptions{bitdeph})
+		encodeTime, err := tsg.encodeFrame(truepath, canvas, EncodeOptions{BitDepth: bitdeph, Options: options})
 		if err != nil {
 			monit.incrementError(1)
 			tsg.logErrors(700, monit.frameNo, monit.jobID, err)
+
+			continue
+		}
+
+		if tsg.runnerConf.ProfilerEnabled {
+			tsg.profileEncode(encodeProfile{Encode: encodeTime, Format: strings.ToUpper(strings.TrimPrefix(filepath.Ext(name), ".")), File: name, Frame: monit.frameNo}, monit.jobID)
 		}
+
+		tsg.events.send(Event{Type: FrameEncoded, JobID: monit.jobID, Frame: monit.frameNo, File: name, Duration: encodeTime})
 	}
 
 }
 
+// profileEncode writes the encode profile through the middlewares
+func (tsg *OpenTSG) profileEncode(p encodeProfile, jobID string) {
+	profiler := chain[Handler](tsg.middlewares, HandlerFunc(func(r1 Response, r2 *Request) {
+		out, _ := json.Marshal(p)
+		r1.Write(Profiler, string(out))
+	}))
+
+	profiler.Handle(&response{}, &Request{
+		Context:         context.Background(),
+		JobID:           jobID,
+		PatchProperties: PatchProperties{WidgetFullID: "core.encode", WidgetType: "core.encode"},
+		FrameProperties: FrameProperties{FrameNumber: p.Frame},
+	})
+}
+
 type monitor struct {
 	frameNo    int
 	ErrorCount int
@@ -474,6 +594,18 @@ type profile struct {
 	Wtype     string        `json:"type"`
 	WID       string        `json:"widgetID"`
 	ZPosition int           `json:"ZPosition"`
+	Frame     int           `json:"frame"`
+	// BlockedBy are the widgets that had to be drawn
+	// before this widget could be composited
+	BlockedBy []string `json:"blockedBy,omitempty"`
+}
+
+// encodeProfile is the profile of saving a frame
+type encodeProfile struct {
+	Encode time.Duration `json:"EncodeTime(ns)"`
+	Format string        `json:"format"`
+	File   string        `json:"file"`
+	Frame  int           `json:"frame"`
 }
 
 // // update widgetHandle to make the choices for me
@@ -529,7 +661,7 @@ func (tsg *OpenTSG) widgetHandle(c *context.Context, canvas draw.Image, monit *m
 			time.Sleep(10 * time.Millisecond)
 			runner, available = runPool.GetRunner()
 		}
-		p := profile{ZPosition: i}
+		p := profile{ZPosition: i, Frame: monit.frameNo}
 		setUpStart := time.Now()
 		// run the widget async
 		go func() {
@@ -603,7 +735,12 @@ func (tsg *OpenTSG) widgetHandle(c *context.Context, canvas draw.Image, monit *m
 						return
 					}
 
-					Han, err = Unmarshal(handlers.handler)(widgProps.Contents)
+					// plugins are sent the widget json, so are not unmarshalled
+					if plugin, isPlugin := hdler.(*pluginHandler); isPlugin {
+						Han = plugin
+					} else {
+						Han, err = Unmarshal(handlers.handler)(widgProps.Contents)
+					}
 
 				}
 
@@ -641,6 +778,7 @@ func (tsg *OpenTSG) widgetHandle(c *context.Context, canvas draw.Image, monit *m
 				req.FrameProperties = fp
 				req.RawWidgetYAML = widgProps.Contents
 				req.searchWithCredentials = webSearcher
+				req.decoders = tsg.decoders
 				req.PatchProperties = pp
 
 				// chain that middleware at the last second?
@@ -652,7 +790,7 @@ func (tsg *OpenTSG) widgetHandle(c *context.Context, canvas draw.Image, monit *m
 
 			var canvasArea image.Rectangle
 			if gridCanvas != nil {
-				canvasArea = gridCanvas.Bounds().Add(imgLocation)
+				canvasArea = widgProps.Transform.TransformArea(gridCanvas.Bounds().Add(imgLocation))
 			}
 
 			// log the area so other widgets can go while
@@ -662,10 +800,15 @@ func (tsg *OpenTSG) widgetHandle(c *context.Context, canvas draw.Image, monit *m
 			handleStart := time.Now()
 			if widgProps.WType != "builtin.canvas" {
 				// RUN the widget
-				Han.Handle(&resp, &req)
+				tsg.runHandler(Han, &resp, &req)
 			}
 			p.Handler = time.Since(handleStart)
 
+			// rotate, flip and scale the patch before it is drawn
+			if (resp.status == 200 || resp.status == WidgetSuccess) && !widgProps.Transform.IsIdentity() {
+				gridCanvas, mask = widgProps.Transform.Apply(gridCanvas, mask)
+			}
+
 			// wait until it is the widgets turn
 
 			queue := time.Now()
@@ -680,9 +823,15 @@ func (tsg *OpenTSG) widgetHandle(c *context.Context, canvas draw.Image, monit *m
 					zPosLock.Unlock()
 				}
 			*/
+			tsg.events.send(Event{Type: WidgetQueued, JobID: monit.jobID, Frame: monit.frameNo,
+				WidgetID: widgProps.FullName, WidgetType: widgProps.WType, Status: resp.status})
+
 			// queue until the widget can run
-			runPool.queue(runner, position, canvasArea)
+			blockers := runPool.queue(runner, position, canvasArea)
 			p.Queue = time.Since(queue)
+			for _, b := range blockers {
+				p.BlockedBy = append(p.BlockedBy, allWidgetsArr[b].FullName)
+			}
 
 			// only draw the image if
 			// no errors occurred running the handler
@@ -693,7 +842,7 @@ func (tsg *OpenTSG) widgetHandle(c *context.Context, canvas draw.Image, monit *m
 				drawer := ContFunc(func(ctx context.Context) {
 					compostion := time.Now()
 					//	canvasLock.Lock()
-					colour.DrawMask(canvas, canvasArea, gridCanvas, image.Point{}, mask, image.Point{}, draw.Over)
+					colour.DrawMaskBlend(canvas, canvasArea, gridCanvas, image.Point{}, mask, image.Point{}, widgProps.Blend, widgProps.GetOpacity())
 					//	canvasLock.Unlock()
 					p.Composite = time.Since(compostion)
 
@@ -714,6 +863,8 @@ func (tsg *OpenTSG) widgetHandle(c *context.Context, canvas draw.Image, monit *m
 
 			// signal that the widget has finished
 			runPool.CompleteZ(position)
+			tsg.events.send(Event{Type: WidgetCompleted, JobID: monit.jobID, Frame: monit.frameNo,
+				WidgetID: widgProps.FullName, WidgetType: widgProps.WType, Status: resp.status, Duration: time.Since(setUpStart)})
 			/*
 				zPosLock.Lock()
 				// update zpos regardless
@@ -728,6 +879,72 @@ func (tsg *OpenTSG) widgetHandle(c *context.Context, canvas draw.Image, monit *m
 
 }
 
+// runHandler runs the widget handler, recovering from any panics
+// and cancelling the request context if the widget timeout is reached.
+// Panics and timeouts are written as widget errors through the middlewares,
+// so the widget is not composited and the rest of the frame can run.
+func (tsg *OpenTSG) runHandler(han Handler, resp *response, req *Request) {
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if tsg.runnerConf.WidgetTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, tsg.runnerConf.WidgetTimeout)
+	}
+	defer cancel()
+	req.Context = ctx
+
+	// the handler has its own response and request, so a
+	// handler that has timed out can not change the results
+	handResp := &response{baseImg: resp.baseImg}
+	handReq := *req
+	// done returns the stack trace of any panics
+	done := make(chan string, 1)
+
+	run := func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Sprintf("%v\n%s", r, debug.Stack())
+			}
+		}()
+
+		han.Handle(handResp, &handReq)
+		done <- ""
+	}
+
+	if tsg.runnerConf.WidgetTimeout > 0 {
+		go run()
+	} else {
+		run()
+	}
+
+	var panicked string
+	select {
+	case panicked = <-done:
+	case <-ctx.Done():
+	}
+
+	switch {
+	case panicked != "":
+		chain(tsg.middlewares, GenErrorHandler(WidgetError,
+			fmt.Sprintf("0055 the widget %s panicked: %s", req.PatchProperties.WidgetFullID, panicked))).Handle(resp, req)
+
+		return
+	case ctx.Err() != nil:
+		// handlers that stop when the context is cancelled
+		// have still timed out
+		chain(tsg.middlewares, GenErrorHandler(WidgetError,
+			fmt.Sprintf("0056 the widget %s did not finish within %v: %v", req.PatchProperties.WidgetFullID, tsg.runnerConf.WidgetTimeout, ctx.Err()))).Handle(resp, req)
+
+		return
+	}
+
+	*resp = *handResp
+	*req = handReq
+}
+
 type drawQueue struct {
 	drawn bool
 	area  image.Rectangle
@@ -783,11 +1000,13 @@ func (p *Pool) LogDrawArea(position int, area image.Rectangle) {
 	p.drawers.Unlock()
 }
 
-func (p *Pool) queue(runner poolRunner, position int, area image.Rectangle) {
+// queue waits until every widget underneath the area has been drawn,
+// it returns the z positions of the widgets it waited for.
+func (p *Pool) queue(runner poolRunner, position int, area image.Rectangle) []int {
 
 	// put the runner back with no memory
 	// so the cache is still useable?
-	clearPath := p.drawers.check(position, area)
+	clearPath, blocker := p.drawers.check(position, area)
 
 	if !clearPath {
 		// put the runner in the pool while queueing
@@ -805,32 +1024,37 @@ func (p *Pool) queue(runner poolRunner, position int, area image.Rectangle) {
 		}()
 	}
 
+	var blockers []int
 	for !clearPath {
+		if len(blockers) == 0 || blockers[len(blockers)-1] != blocker {
+			blockers = append(blockers, blocker)
+		}
 		time.Sleep(time.Millisecond * 1)
-		clearPath = p.drawers.check(position, area)
+		clearPath, blocker = p.drawers.check(position, area)
 	}
 
+	return blockers
 }
 
-func (c *drawers) check(position int, area image.Rectangle) bool {
+// check returns true if the area is clear to draw on,
+// if it is not clear the z position of the blocking widget is returned.
+func (c *drawers) check(position int, area image.Rectangle) (bool, int) {
 	c.Lock()
 	widgePos := *c.currentZ
 	c.Unlock()
 
 	// do not bother checking areas underneath
 	if widgePos == position {
-		return true
+		return true, 0
 	}
 
-	clearPath := true
 	// do not check against its own area
 	for i := widgePos; i < position; i++ {
 		c.Lock()
 		under, ok := c.drawQueue[i]
 		c.Unlock()
 		if !ok {
-			clearPath = false
-			break
+			return false, i
 		}
 
 		// already been drawn so area does
@@ -841,11 +1065,11 @@ func (c *drawers) check(position int, area image.Rectangle) bool {
 
 		// if any overlap then stop the search
 		if area.Overlaps(under.area) {
-			clearPath = false
-			break
+			return false, i
 		}
 	}
-	return clearPath
+
+	return true, 0
 }
 
 // Pool is the runner pool for running individual widgets
@@ -0,0 +1,33 @@
+package tsg
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLint(t *testing.T) {
+
+	otsg, buildErr := BuildOpenTSG("./testdata/handlerLoaders/loader.json", "", true, nil)
+	unregistered, lintErr := otsg.Lint("./testdata/handlerLoaders/loader.json", "")
+
+	var rules []string
+	for _, issue := range unregistered {
+		rules = append(rules, issue.Rule+" "+issue.Alias)
+	}
+
+	otsg.Handle("test.fill", []byte("{}"), Filler{})
+	registered, registeredErr := otsg.Lint("./testdata/handlerLoaders/loader.json", "")
+
+	Convey("Checking factories are linted with the registered widget types", t, func() {
+		Convey("using a factory of fill widgets before and after the fill handler is registered", func() {
+			Convey("the fill widgets are only reported before the handler is registered", func() {
+				So(buildErr, ShouldBeNil)
+				So(lintErr, ShouldBeNil)
+				So(rules, ShouldResemble, []string{"unregistered-type cs.blue", "unregistered-type cs.green", "unregistered-type cs.red"})
+				So(registeredErr, ShouldBeNil)
+				So(registered, ShouldBeEmpty)
+			})
+		})
+	})
+}
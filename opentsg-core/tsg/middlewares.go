@@ -103,7 +103,7 @@ func getLogLevel(status StatusCode) slog.Level {
 	switch status {
 	case WidgetSuccess, 200, Profiler:
 		return slog.LevelDebug
-	case FrameSuccess:
+	case FrameSuccess, RunSuccess:
 		return slog.LevelInfo
 	case WidgetNotFound, WidgetWarning:
 		return slog.LevelWarn
@@ -0,0 +1,412 @@
+package tsg
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mrmxf/opentsg-modules/opentsg-core/colour"
+)
+
+// PluginProtocol is the version of the plugin protocol
+const PluginProtocol = 1
+
+// PluginStartTimeout is how long a plugin has to advertise its widgets
+var PluginStartTimeout = 10 * time.Second
+
+// PluginMaxJSON is the largest json message in bytes that is read from a plugin,
+// larger messages break the protocol. The pixels are limited to the size of the patch.
+var PluginMaxJSON = 16 << 20
+
+// PluginHello is the first message a plugin sends,
+// advertising the widgets it can run.
+type PluginHello struct {
+	Protocol int            `json:"protocol"`
+	Widgets  []PluginWidget `json:"widgets"`
+}
+
+// PluginWidget is a widget type run by a plugin,
+// with the json schema of the widget.
+type PluginWidget struct {
+	Type   string          `json:"type"`
+	Schema json.RawMessage `json:"schema,omitempty"`
+}
+
+// PluginRequest is the widget request sent to a plugin
+type PluginRequest struct {
+	WidgetType string `json:"widgetType"`
+	WidgetID   string `json:"widgetID"`
+	// Widget is the json of the widget
+	Widget json.RawMessage `json:"widget"`
+	// Width and Height are the size of the patch
+	// the plugin returns.
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// X and Y are the location of the patch in the frame
+	X           int               `json:"x"`
+	Y           int               `json:"y"`
+	ColourSpace colour.ColorSpace `json:"colourSpace"`
+	// Geometry are the segments of the patch, relative to the patch
+	Geometry []PluginSegment `json:"geometry,omitempty"`
+	Frame    PluginFrame     `json:"frame"`
+}
+
+// PluginSegment is a segment of the patch geometry
+type PluginSegment struct {
+	ID     string   `json:"id"`
+	X      int      `json:"x"`
+	Y      int      `json:"y"`
+	Width  int      `json:"width"`
+	Height int      `json:"height"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// PluginFrame are the properties of the frame being generated
+type PluginFrame struct {
+	FrameNumber int    `json:"frameNumber"`
+	WorkingDir  string `json:"workingDir"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+}
+
+// PluginResponse is the result a plugin sends
+// back for each request.
+type PluginResponse struct {
+	Status  StatusCode `json:"status"`
+	Message string     `json:"message,omitempty"`
+}
+
+// Plugin is an executable that runs widgets out of process.
+type Plugin struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	// only one request is sent at a time
+	mu      sync.Mutex
+	widgets []PluginWidget
+	err     error
+}
+
+// AddPlugin starts the executable as a plugin and registers every widget type
+// it advertises, with their schemas.
+//
+// Messages between openTSG and the plugin are sent over stdin and stdout, as
+// a 4 byte big endian length followed by that many bytes of json, then a 4
+// byte big endian length followed by that many bytes of pixels.
+// The pixels are 16 bit big endian non-premultiplied RGBA, in rows from the
+// top left of the patch, the same as image.NRGBA64.
+//
+// The plugin first sends a PluginHello, without any pixels. Then for
+// every widget it is sent a PluginRequest without any pixels, and returns a
+// PluginResponse with the pixels of the patch. If no pixels are returned the
+// patch is left unchanged.
+//
+// Messages with more json than PluginMaxJSON, or more pixels than the patch,
+// stop the plugin from being used. A widget that is cancelled, by the
+// WidgetTimeout of the RunnerConfiguration, kills the plugin.
+//
+// Anything the plugin writes to stderr is written to os.Stderr.
+func (o *OpenTSG) AddPlugin(command string, args ...string) (*Plugin, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("0057 %v", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("0057 %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("0057 error starting plugin %s: %v", command, err)
+	}
+
+	p := &Plugin{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}
+
+	// read the hello without blocking forever
+	var hello PluginHello
+	helloErr := make(chan error, 1)
+	go func() {
+		_, err := readPluginMessage(p.stdout, &hello, 0)
+		helloErr <- err
+	}()
+
+	select {
+	case err = <-helloErr:
+	case <-time.After(PluginStartTimeout):
+		err = fmt.Errorf("no widgets were advertised within %v", PluginStartTimeout)
+	}
+
+	if err == nil && hello.Protocol != PluginProtocol {
+		err = fmt.Errorf("protocol version %v is not supported, expected %v", hello.Protocol, PluginProtocol)
+	}
+
+	if err == nil {
+		for _, w := range hello.Widgets {
+			if _, ok := o.handlers[w.Type]; ok {
+				err = fmt.Errorf("the widget type %s has already been declared", w.Type)
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		p.Close()
+		return nil, fmt.Errorf("0057 error starting plugin %s: %v", command, err)
+	}
+
+	p.widgets = hello.Widgets
+	for _, w := range hello.Widgets {
+		o.Handle(w.Type, w.Schema, &pluginHandler{plugin: p})
+	}
+
+	return p, nil
+}
+
+// Widgets returns the widgets the plugin advertised
+func (p *Plugin) Widgets() []PluginWidget {
+	return p.widgets
+}
+
+// Close stops the plugin, by closing its stdin
+// and waiting for it to exit.
+func (p *Plugin) Close() error {
+	p.stdin.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- p.cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(PluginStartTimeout):
+		p.cmd.Process.Kill()
+		return <-done
+	}
+}
+
+// run sends a request to the plugin and returns the response.
+// If the context is done before the plugin responds, the plugin is
+// killed, as its later responses would not match their requests.
+func (p *Plugin) run(ctx context.Context, req PluginRequest) (PluginResponse, []byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// don't talk to a plugin that has broken the protocol
+	if p.err != nil {
+		return PluginResponse{}, nil, p.err
+	}
+
+	// the widget may have timed out waiting for the plugin
+	if err := ctx.Err(); err != nil {
+		return PluginResponse{}, nil, err
+	}
+
+	type result struct {
+		resp   PluginResponse
+		pixels []byte
+		err    error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		var res result
+		res.err = writePluginMessage(p.stdin, req, nil)
+		if res.err == nil {
+			res.pixels, res.err = readPluginMessage(p.stdout, &res.resp, req.Width*req.Height*8)
+		}
+		done <- res
+	}()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		p.cmd.Process.Kill()
+		p.err = fmt.Errorf("the plugin %s was stopped as %s did not finish: %v", p.cmd.Path, req.WidgetID, ctx.Err())
+
+		return PluginResponse{}, nil, p.err
+	}
+
+	if res.err != nil {
+		p.err = fmt.Errorf("the plugin %s has stopped responding: %v", p.cmd.Path, res.err)
+		return res.resp, nil, p.err
+	}
+
+	return res.resp, res.pixels, nil
+}
+
+// pluginHandler runs the widgets of a plugin.
+// It is not unmarshalled as the widget json
+// is sent to the plugin.
+type pluginHandler struct {
+	plugin *Plugin
+}
+
+func (ph *pluginHandler) Handle(resp Response, req *Request) {
+	// the widget is sent as json, even if it was written as yaml
+	widget := req.RawWidgetYAML
+	if !json.Valid(widget) {
+		var clean any
+		if err := yaml.Unmarshal(widget, &clean); err != nil {
+			resp.Write(WidgetError, fmt.Sprintf("0057 extracting %s: %v", req.PatchProperties.WidgetFullID, err))
+			return
+		}
+
+		widget, _ = json.Marshal(clean)
+	}
+
+	bounds := resp.BaseImage().Bounds()
+	pr := PluginRequest{WidgetType: req.PatchProperties.WidgetType, WidgetID: req.PatchProperties.WidgetFullID,
+		Widget: widget, Width: bounds.Dx(), Height: bounds.Dy(),
+		X: req.PatchProperties.TSGLocation.X, Y: req.PatchProperties.TSGLocation.Y,
+		ColourSpace: req.PatchProperties.ColourSpace,
+		Frame: PluginFrame{FrameNumber: req.FrameProperties.FrameNumber, WorkingDir: req.FrameProperties.WorkingDir,
+			Width: req.FrameProperties.FrameDimensions.X, Height: req.FrameProperties.FrameDimensions.Y}}
+
+	for _, seg := range req.PatchProperties.Geometry {
+		pr.Geometry = append(pr.Geometry, PluginSegment{ID: seg.ID, X: seg.Shape.Min.X, Y: seg.Shape.Min.Y,
+			Width: seg.Shape.Dx(), Height: seg.Shape.Dy(), Tags: seg.Tags})
+	}
+
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	result, pixels, err := ph.plugin.run(ctx, pr)
+	if err != nil {
+		resp.Write(WidgetError, fmt.Sprintf("0057 %v", err))
+		return
+	}
+
+	if result.Status == 0 {
+		resp.Write(WidgetError, fmt.Sprintf("0057 the plugin did not return a status for %s", pr.WidgetID))
+		return
+	}
+
+	if len(pixels) > 0 {
+		if len(pixels) != bounds.Dx()*bounds.Dy()*8 {
+			resp.Write(WidgetError, fmt.Sprintf("0057 the plugin returned %v bytes of pixels for %s, expected %v",
+				len(pixels), pr.WidgetID, bounds.Dx()*bounds.Dy()*8))
+			return
+		}
+
+		patch := colour.NewNRGBA64(req.PatchProperties.ColourSpace, image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		copy(patch.BaseImage().Pix, pixels)
+		colour.Draw(resp.BaseImage(), bounds, patch, image.Point{}, draw.Src)
+	}
+
+	resp.Write(result.Status, result.Message)
+}
+
+// ServePlugin runs a plugin written in Go, over the reader and writer,
+// which are stdin and stdout for plugins started by openTSG.
+// The run function is called for every request, returning the
+// response and the pixels of the patch.
+//
+// It returns when the reader is closed.
+func ServePlugin(r io.Reader, w io.Writer, widgets []PluginWidget, run func(PluginRequest) (PluginResponse, []byte)) error {
+	if err := writePluginMessage(w, PluginHello{Protocol: PluginProtocol, Widgets: widgets}, nil); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(r)
+	for {
+		var req PluginRequest
+		if _, err := readPluginMessage(reader, &req, 0); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+
+		resp, pixels := run(req)
+		if err := writePluginMessage(w, resp, pixels); err != nil {
+			return err
+		}
+	}
+}
+
+// writePluginMessage writes the json and pixel frames of a message
+func writePluginMessage(w io.Writer, message any, pixels []byte) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, 0, 8+len(body))
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(body)))
+	frame = append(frame, body...)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(pixels)))
+
+	if _, err := w.Write(frame); err != nil {
+		return err
+	}
+
+	_, err = w.Write(pixels)
+
+	return err
+}
+
+// readPluginMessage reads the json of a message into
+// message and returns the pixels, which can be at most maxPixels bytes
+func readPluginMessage(r io.Reader, message any, maxPixels int) ([]byte, error) {
+	body, err := readPluginFrame(r, PluginMaxJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(body, message); err != nil {
+		return nil, err
+	}
+
+	pixels, err := readPluginFrame(r, maxPixels)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return pixels, err
+}
+
+// readPluginFrame reads a length and then that many bytes,
+// lengths larger than the limit are not read.
+func readPluginFrame(r io.Reader, limit int) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(length[:])
+	if uint64(size) > uint64(limit) {
+		return nil, fmt.Errorf("a frame of %v bytes was sent, the limit is %v bytes", size, limit)
+	}
+
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, err
+	}
+
+	return frame, nil
+}
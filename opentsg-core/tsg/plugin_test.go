@@ -0,0 +1,142 @@
+package tsg
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestPluginProcess is the plugin run by TestPlugins,
+// it is skipped when run as a normal test.
+func TestPluginProcess(t *testing.T) {
+	switch os.Getenv("OPENTSG_TEST_PLUGIN") {
+	case "fill":
+	case "hang":
+		ServePlugin(os.Stdin, os.Stdout, []PluginWidget{{Type: "plugin.hang"}}, func(req PluginRequest) (PluginResponse, []byte) {
+			select {}
+		})
+	case "broken":
+		os.Stdout.Write([]byte("not a plugin"))
+		os.Exit(0)
+	default:
+		return
+	}
+
+	widgets := []PluginWidget{{Type: "plugin.fill", Schema: []byte(`{"type": "object", "required": ["fill"]}`)}}
+	ServePlugin(os.Stdin, os.Stdout, widgets, func(req PluginRequest) (PluginResponse, []byte) {
+		pixels := make([]byte, req.Width*req.Height*8)
+		for i := 0; i < len(pixels); i += 8 {
+			// red with a full alpha
+			binary.BigEndian.PutUint16(pixels[i:], 0xffff)
+			binary.BigEndian.PutUint16(pixels[i+6:], 0xffff)
+		}
+
+		return PluginResponse{Status: WidgetSuccess,
+			Message: fmt.Sprintf("filled %s %vx%v at %v,%v", req.WidgetID, req.Width, req.Height, req.X, req.Y)}, pixels
+	})
+
+	os.Exit(0)
+}
+
+func TestPlugins(t *testing.T) {
+	t.Setenv("OPENTSG_TEST_PLUGIN", "fill")
+
+	otsg, buildErr := BuildOpenTSG("./testdata/plugin/loader.json", "", true, nil)
+	AddBaseEncoders(otsg)
+	plugin, pluginErr := otsg.AddPlugin(os.Args[0], "-test.run=^TestPluginProcess$")
+	_, dupErr := otsg.AddPlugin(os.Args[0], "-test.run=^TestPluginProcess$")
+
+	logArr := testSlog{logs: make([]string, 0), level: slog.LevelDebug}
+	otsg.Use(Logger(slog.New(&logArr)))
+	dir := t.TempDir()
+	otsg.Run(dir)
+	closeErr := plugin.Close()
+
+	out, outErr := os.Open(filepath.Join(dir, "plugin.png"))
+	var img image.Image
+	if outErr == nil {
+		img, outErr = png.Decode(out)
+		out.Close()
+	}
+
+	Convey("Checking widgets are run by plugins", t, func() {
+		Convey("using a plugin that fills the patch red, with a widget that has a fill and a widget without", func() {
+			Convey("the widget is filled by the plugin and the other widget fails the advertised schema", func() {
+				So(buildErr, ShouldBeNil)
+				So(pluginErr, ShouldBeNil)
+				So(plugin.Widgets()[0].Type, ShouldEqual, "plugin.fill")
+				So(dupErr, ShouldResemble, fmt.Errorf("0057 error starting plugin %s: the widget type plugin.fill has already been declared", os.Args[0]))
+				So(closeErr, ShouldBeNil)
+				So(outErr, ShouldBeNil)
+				So(logArr.logs, ShouldContain, "filled red 32x32 at 0,0")
+				So(logArr.logs, ShouldContain, "0027 fill is required in unknown files please check your files for the fill property in the name nofill")
+				r, _, _, _ := img.At(5, 5).RGBA()
+				So(r, ShouldEqual, 0xffff)
+				r, _, _, _ = img.At(40, 5).RGBA()
+				So(r, ShouldEqual, 0)
+			})
+		})
+	})
+
+	t.Setenv("OPENTSG_TEST_PLUGIN", "broken")
+	brokenTSG, _ := BuildOpenTSG("./testdata/plugin/loader.json", "", true, nil)
+	_, brokenErr := brokenTSG.AddPlugin(os.Args[0], "-test.run=^TestPluginProcess$")
+	_, missingErr := brokenTSG.AddPlugin("./testdata/plugin/missing")
+
+	Convey("Checking plugins that do not follow the protocol are not added", t, func() {
+		Convey("using a plugin that writes text and a plugin that does not exist", func() {
+			Convey("errors are returned for both plugins", func() {
+				// "not " is read as the length of the json
+				So(brokenErr, ShouldResemble, fmt.Errorf("0057 error starting plugin %s: a frame of %v bytes was sent, the limit is %v bytes",
+					os.Args[0], binary.BigEndian.Uint32([]byte("not ")), PluginMaxJSON))
+				So(missingErr, ShouldNotBeNil)
+				So(missingErr.Error(), ShouldStartWith, "0057 error starting plugin ./testdata/plugin/missing")
+			})
+		})
+	})
+
+	var large bytes.Buffer
+	writePluginMessage(&large, PluginResponse{Status: WidgetSuccess}, make([]byte, 32*32*8+1))
+	_, largeErr := readPluginMessage(&large, &PluginResponse{}, 32*32*8)
+
+	Convey("Checking frames larger than their limit are not read", t, func() {
+		Convey("using a response with one more byte of pixels than a 32x32 patch", func() {
+			Convey("an error is returned before the pixels are read", func() {
+				So(largeErr, ShouldResemble, fmt.Errorf("a frame of 8193 bytes was sent, the limit is 8192 bytes"))
+			})
+		})
+	})
+
+	t.Setenv("OPENTSG_TEST_PLUGIN", "hang")
+	hangTSG, _ := BuildOpenTSG("./testdata/plugin/loader.json", "", true, nil)
+	hang, hangErr := hangTSG.AddPlugin(os.Args[0], "-test.run=^TestPluginProcess$")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, timeoutErr := hang.run(ctx, PluginRequest{WidgetID: "first"})
+	_, _, nextErr := hang.run(context.Background(), PluginRequest{WidgetID: "second"})
+	elapsed := time.Since(start)
+	hang.Close()
+
+	Convey("Checking plugins are stopped when a widget is cancelled", t, func() {
+		Convey("using a plugin that never responds and a widget with a timeout of 100ms", func() {
+			Convey("the plugin is killed so the next widget returns an error instead of waiting", func() {
+				So(hangErr, ShouldBeNil)
+				So(timeoutErr, ShouldResemble, fmt.Errorf("the plugin %s was stopped as first did not finish: %v", os.Args[0], context.DeadlineExceeded))
+				So(nextErr, ShouldResemble, timeoutErr)
+				So(elapsed, ShouldBeLessThan, PluginStartTimeout)
+			})
+		})
+	})
+}
@@ -0,0 +1,70 @@
+package tsg
+
+import "fmt"
+
+// ErrorPolicy is how openTSG handles the configuration,
+// schema and widget errors of a run.
+type ErrorPolicy string
+
+const (
+	// Lenient keeps running after errors, frames are only
+	// not generated if their canvas can not be made.
+	// It is the default policy.
+	Lenient ErrorPolicy = "lenient"
+	// Strict stops the run at the first error, the frame
+	// with the error is not saved and no more frames are run.
+	Strict ErrorPolicy = "strict"
+	// Threshold stops the run once the errors of the run reach the ErrorThreshold
+	// of the RunnerConfiguration, the frame that reaches it is not saved.
+	Threshold ErrorPolicy = "threshold"
+)
+
+// RunResult is the result of an openTSG run
+type RunResult struct {
+	// Policy is the error policy of the run
+	Policy ErrorPolicy `json:"policy"`
+	// Threshold is the error threshold of the Threshold policy
+	Threshold int `json:"threshold,omitempty"`
+	// Frames is the number of frames in the run
+	Frames int `json:"frames"`
+	// FramesRun is the number of frames that were started
+	FramesRun int `json:"framesRun"`
+	// FramesFailed is the number of frames that were not saved
+	FramesFailed int `json:"framesFailed"`
+	// Errors is the count of errors across the run
+	Errors int `json:"errors"`
+	// Aborted is true if the policy stopped the run before every frame was run
+	Aborted bool `json:"aborted"`
+	// Failed is true if the errors broke the error policy,
+	// a Lenient run does not fail.
+	Failed bool `json:"failed"`
+}
+
+// validate checks the policy is known, and
+// the threshold policy has a valid threshold
+func (p ErrorPolicy) validate(threshold int) error {
+	switch p {
+	case "", Lenient, Strict:
+		return nil
+	case Threshold:
+		if threshold < 1 {
+			return fmt.Errorf("0069 the error threshold is %v, it must be at least 1 for the threshold error policy", threshold)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("0069 unknown error policy %q, expected %q, %q or %q", p, Lenient, Strict, Threshold)
+	}
+}
+
+// exceeded checks if a count of errors breaks the policy
+func (p ErrorPolicy) exceeded(errors, threshold int) bool {
+	switch p {
+	case Strict:
+		return errors > 0
+	case Threshold:
+		return errors >= threshold
+	default:
+		return false
+	}
+}
@@ -0,0 +1,73 @@
+package tsg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestErrorPolicy(t *testing.T) {
+	dir := t.TempDir()
+	canvas, _ := json.Marshal(map[string]any{"props": map[string]any{"type": "builtin.canvas"},
+		"outputs": []string{filepath.Join(dir, "frame.png")}, "frameSize": map[string]any{"w": 64, "h": 36},
+		"gridColumns": 16, "gridRows": 9, "filedepth": 8})
+	frame := map[string]any{"canvas": map[string]any{}, "err": map[string]any{}}
+	factory, _ := json.Marshal(map[string]any{
+		"include": []any{map[string]any{"uri": "canvas.json", "name": "canvas"}, map[string]any{"uri": "missing.json", "name": "err"}},
+		"create":  []any{frame, frame, frame},
+	})
+	os.WriteFile(filepath.Join(dir, "canvas.json"), canvas, 0644)
+	os.WriteFile(filepath.Join(dir, "missing.json"), []byte(`{"props": {"type": "test.missing"}}`), 0644)
+	os.WriteFile(filepath.Join(dir, "factory.json"), factory, 0644)
+
+	// every frame has a widget without a handler
+	confs := []*RunnerConfiguration{nil, {RunnerCount: 1, ErrorPolicy: Strict}, {RunnerCount: 1, ErrorPolicy: Threshold, ErrorThreshold: 2}}
+	expected := []RunResult{{Policy: Lenient, Frames: 3, FramesRun: 3, Errors: 3},
+		{Policy: Strict, Frames: 3, FramesRun: 1, FramesFailed: 1, Errors: 1, Aborted: true, Failed: true},
+		{Policy: Threshold, Threshold: 2, Frames: 3, FramesRun: 2, FramesFailed: 1, Errors: 2, Aborted: true, Failed: true}}
+	expectedStatus := []StatusCode{RunSuccess, RunFail, RunFail}
+
+	for i, conf := range confs {
+		otsg, err := BuildOpenTSG(filepath.Join(dir, "factory.json"), "", true, conf)
+		AddBaseEncoders(otsg)
+
+		var finished Event
+		otsg.Subscribe(func(e Event) {
+			if e.Type == RunFinished {
+				finished = e
+			}
+		})
+		result := otsg.Run("")
+
+		Convey("Checking the error policy is followed by a run", t, func() {
+			Convey(fmt.Sprintf("using the %s policy with three frames that each have an error", expected[i].Policy), func() {
+				Convey(fmt.Sprintf("a result of %+v is returned", expected[i]), func() {
+					So(err, ShouldBeNil)
+					So(result, ShouldResemble, expected[i])
+					So(finished.Status, ShouldEqual, expectedStatus[i])
+					So(finished.Errors, ShouldEqual, expected[i].Errors)
+				})
+			})
+		})
+	}
+
+	badConfs := []*RunnerConfiguration{{ErrorPolicy: "loose"}, {ErrorPolicy: Threshold}}
+	badErrs := []string{`0069 unknown error policy "loose", expected "lenient", "strict" or "threshold"`,
+		"0069 the error threshold is 0, it must be at least 1 for the threshold error policy"}
+
+	for i, conf := range badConfs {
+		_, err := BuildOpenTSG(filepath.Join(dir, "factory.json"), "", true, conf)
+
+		Convey("Checking invalid error policies are not used", t, func() {
+			Convey(fmt.Sprintf("using a policy of %q with a threshold of %v", conf.ErrorPolicy, conf.ErrorThreshold), func() {
+				Convey(fmt.Sprintf("an error of %s is returned", badErrs[i]), func() {
+					So(err, ShouldResemble, fmt.Errorf("%s", badErrs[i]))
+				})
+			})
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package tsg
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/draw"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// ProfileCollector gathers the profiles written with the
+// Profiler status code, to build a report of an openTSG run.
+//
+// The profiler must be enabled in the RunnerConfiguration
+// for any profiles to be written.
+type ProfileCollector struct {
+	mu      sync.Mutex
+	widgets []profile
+	encodes []encodeProfile
+}
+
+// NewProfileCollector generates an empty profile collector.
+func NewProfileCollector() *ProfileCollector {
+	return &ProfileCollector{}
+}
+
+// Middleware returns the middleware that collects the profiles,
+// it is added to openTSG with the Use method.
+func (pc *ProfileCollector) Middleware() func(Handler) Handler {
+	return func(h Handler) Handler {
+		return HandlerFunc(func(resp Response, req *Request) {
+			h.Handle(&profileWriter{r: resp, pc: pc, widgetType: req.PatchProperties.WidgetType}, req)
+		})
+	}
+}
+
+// profileWriter records any profiles, before
+// forwarding the write to the wrapped response
+type profileWriter struct {
+	r          Response
+	pc         *ProfileCollector
+	widgetType string
+}
+
+func (p *profileWriter) Write(status StatusCode, message string, args ...any) {
+	if status == Profiler {
+		p.pc.add(p.widgetType, message)
+	}
+
+	p.r.Write(status, message, args...)
+}
+
+func (p *profileWriter) BaseImage() draw.Image {
+	return p.r.BaseImage()
+}
+
+// add parses and stores a profile message
+func (pc *ProfileCollector) add(widgetType, message string) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if widgetType == "core.encode" {
+		var enc encodeProfile
+		if json.Unmarshal([]byte(message), &enc) == nil {
+			pc.encodes = append(pc.encodes, enc)
+		}
+
+		return
+	}
+
+	var prof profile
+	if json.Unmarshal([]byte(message), &prof) == nil {
+		pc.widgets = append(pc.widgets, prof)
+	}
+}
+
+// ProfileReport is the aggregated profile of an openTSG run.
+type ProfileReport struct {
+	// Widgets is the count of widget profiles in the report
+	Widgets int `json:"widgets"`
+	// WidgetTypes are the totals for each widget type
+	WidgetTypes map[string]ProfileTotals `json:"widgetTypes"`
+	// WidgetIDs are the totals for each widget ID,
+	// across every frame
+	WidgetIDs map[string]ProfileTotals `json:"widgetIDs"`
+	// Percentiles are the percentiles of each stage of
+	// running a widget, across every widget.
+	Percentiles StagePercentiles `json:"percentiles"`
+	// Encodes are the encode times of each file format
+	Encodes map[string]EncodeTotals `json:"encodes"`
+	// Frames are the critical paths of each frame
+	Frames []FrameProfile `json:"frames"`
+}
+
+// ProfileTotals are the summed times for a group of widgets.
+type ProfileTotals struct {
+	Count     int           `json:"count"`
+	SetUp     time.Duration `json:"SetUpTime(ns)"`
+	Handler   time.Duration `json:"WidgetRunTime(ns)"`
+	Queue     time.Duration `json:"QueueTime(ns)"`
+	Composite time.Duration `json:"CompositeTime(ns)"`
+}
+
+// Total is the sum of every stage
+func (p ProfileTotals) Total() time.Duration {
+	return p.SetUp + p.Handler + p.Queue + p.Composite
+}
+
+// Percentiles are the nearest rank percentiles of a set of times.
+type Percentiles struct {
+	P50 time.Duration `json:"p50(ns)"`
+	P90 time.Duration `json:"p90(ns)"`
+	P99 time.Duration `json:"p99(ns)"`
+	Max time.Duration `json:"max(ns)"`
+}
+
+// StagePercentiles are the percentiles of each stage of running a widget.
+type StagePercentiles struct {
+	SetUp     Percentiles `json:"setUp"`
+	Handler   Percentiles `json:"widgetRun"`
+	Queue     Percentiles `json:"queue"`
+	Composite Percentiles `json:"composite"`
+}
+
+// EncodeTotals are the encode times of a file format.
+type EncodeTotals struct {
+	Count       int           `json:"count"`
+	Total       time.Duration `json:"EncodeTime(ns)"`
+	Percentiles Percentiles   `json:"percentiles"`
+}
+
+// FrameProfile is the critical path of a frame.
+//
+// Widgets wait in the queue for any widgets underneath them to
+// be drawn, the critical path is the longest chain of widgets
+// that waited on each other, which limits how fast a frame can be made.
+type FrameProfile struct {
+	Frame int `json:"frame"`
+	// CriticalPath are the widget IDs of the critical path
+	// in the order they ran
+	CriticalPath []string `json:"criticalPath"`
+	// CriticalTime is the set up, run and composite time
+	// of every widget on the critical path
+	CriticalTime time.Duration `json:"CriticalTime(ns)"`
+	// Blocked are the widgets that waited for other widgets
+	Blocked []BlockedWidget `json:"blocked,omitempty"`
+}
+
+// BlockedWidget is a widget that waited in the queue
+// for the widgets underneath it.
+type BlockedWidget struct {
+	WidgetID  string        `json:"widgetID"`
+	BlockedBy []string      `json:"blockedBy"`
+	Queue     time.Duration `json:"QueueTime(ns)"`
+}
+
+// Report generates the report of every profile collected so far.
+func (pc *ProfileCollector) Report() ProfileReport {
+	pc.mu.Lock()
+	widgets := append([]profile{}, pc.widgets...)
+	encodes := append([]encodeProfile{}, pc.encodes...)
+	pc.mu.Unlock()
+
+	report := ProfileReport{Widgets: len(widgets), WidgetTypes: map[string]ProfileTotals{},
+		WidgetIDs: map[string]ProfileTotals{}, Encodes: map[string]EncodeTotals{}, Frames: []FrameProfile{}}
+
+	var setUps, handlers, queues, composites []time.Duration
+	frames := map[int][]profile{}
+	for _, w := range widgets {
+		report.WidgetTypes[w.Wtype] = addProfile(report.WidgetTypes[w.Wtype], w)
+		report.WidgetIDs[w.WID] = addProfile(report.WidgetIDs[w.WID], w)
+
+		setUps = append(setUps, w.SetUp)
+		handlers = append(handlers, w.Handler)
+		queues = append(queues, w.Queue)
+		composites = append(composites, w.Composite)
+		frames[w.Frame] = append(frames[w.Frame], w)
+	}
+
+	report.Percentiles = StagePercentiles{SetUp: percentiles(setUps), Handler: percentiles(handlers),
+		Queue: percentiles(queues), Composite: percentiles(composites)}
+
+	formats := map[string][]time.Duration{}
+	for _, e := range encodes {
+		formats[e.Format] = append(formats[e.Format], e.Encode)
+	}
+
+	for format, times := range formats {
+		totals := EncodeTotals{Count: len(times), Percentiles: percentiles(times)}
+		for _, t := range times {
+			totals.Total += t
+		}
+		report.Encodes[format] = totals
+	}
+
+	frameNumbers := make([]int, 0, len(frames))
+	for f := range frames {
+		frameNumbers = append(frameNumbers, f)
+	}
+	sort.Ints(frameNumbers)
+
+	for _, f := range frameNumbers {
+		report.Frames = append(report.Frames, criticalPath(f, frames[f]))
+	}
+
+	return report
+}
+
+func addProfile(totals ProfileTotals, p profile) ProfileTotals {
+	totals.Count++
+	totals.SetUp += p.SetUp
+	totals.Handler += p.Handler
+	totals.Queue += p.Queue
+	totals.Composite += p.Composite
+
+	return totals
+}
+
+// percentiles calculates the nearest rank percentiles
+func percentiles(times []time.Duration) Percentiles {
+	if len(times) == 0 {
+		return Percentiles{}
+	}
+
+	sorted := append([]time.Duration{}, times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := func(p float64) time.Duration {
+		i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+
+		return sorted[max(i, 0)]
+	}
+
+	return Percentiles{P50: rank(50), P90: rank(90), P99: rank(99), Max: sorted[len(sorted)-1]}
+}
+
+// criticalPath finds the longest chain of blocking widgets in a frame.
+func criticalPath(frame int, widgets []profile) FrameProfile {
+	sort.Slice(widgets, func(i, j int) bool { return widgets[i].ZPosition < widgets[j].ZPosition })
+
+	fp := FrameProfile{Frame: frame, CriticalPath: []string{}}
+	// the longest time to reach the end of each widget
+	// and the widget before it on that path
+	ends := map[string]time.Duration{}
+	previous := map[string]string{}
+
+	var last string
+	for _, w := range widgets {
+		var start time.Duration
+		for _, b := range w.BlockedBy {
+			if ends[b] > start {
+				start = ends[b]
+				previous[w.WID] = b
+			}
+		}
+
+		ends[w.WID] = start + w.SetUp + w.Handler + w.Composite
+		if last == "" || ends[w.WID] > ends[last] {
+			last = w.WID
+		}
+
+		if len(w.BlockedBy) > 0 {
+			fp.Blocked = append(fp.Blocked, BlockedWidget{WidgetID: w.WID, BlockedBy: w.BlockedBy, Queue: w.Queue})
+		}
+	}
+
+	if last == "" {
+		return fp
+	}
+
+	fp.CriticalTime = ends[last]
+	for id, ok := last, true; ok; id, ok = previous[id] {
+		fp.CriticalPath = append([]string{id}, fp.CriticalPath...)
+	}
+
+	return fp
+}
+
+// WriteJSON writes the report as indented json.
+func (r ProfileReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+
+	return enc.Encode(r)
+}
+
+// WriteText writes the report as a readable summary.
+func (r ProfileReport) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Profiled %v widgets\n\n", r.Widgets)
+
+	fmt.Fprintln(tw, "Stage\tp50\tp90\tp99\tmax")
+	for _, stage := range []struct {
+		name string
+		p    Percentiles
+	}{{"set up", r.Percentiles.SetUp}, {"widget run", r.Percentiles.Handler},
+		{"queue", r.Percentiles.Queue}, {"composite", r.Percentiles.Composite}} {
+		fmt.Fprintf(tw, "%s\t%v\t%v\t%v\t%v\n", stage.name, stage.p.P50, stage.p.P90, stage.p.P99, stage.p.Max)
+	}
+
+	writeTotals(tw, "Widget type", r.WidgetTypes)
+	writeTotals(tw, "Widget ID", r.WidgetIDs)
+
+	if len(r.Encodes) > 0 {
+		fmt.Fprintln(tw, "\nFormat\tcount\ttotal\tp50\tp90\tmax")
+		for _, format := range sortedKeys(r.Encodes) {
+			e := r.Encodes[format]
+			fmt.Fprintf(tw, "%s\t%v\t%v\t%v\t%v\t%v\n", format, e.Count, e.Total, e.Percentiles.P50, e.Percentiles.P90, e.Percentiles.Max)
+		}
+	}
+
+	for _, f := range r.Frames {
+		fmt.Fprintf(tw, "\nFrame %v critical path (%v): %v\n", f.Frame, f.CriticalTime, f.CriticalPath)
+		for _, b := range f.Blocked {
+			fmt.Fprintf(tw, "  %s\twaited %v for\t%v\n", b.WidgetID, b.Queue, b.BlockedBy)
+		}
+	}
+
+	return tw.Flush()
+}
+
+func writeTotals(w io.Writer, title string, totals map[string]ProfileTotals) {
+	fmt.Fprintf(w, "\n%s\tcount\tset up\twidget run\tqueue\tcomposite\ttotal\n", title)
+	for _, key := range sortedKeys(totals) {
+		t := totals[key]
+		fmt.Fprintf(w, "%s\t%v\t%v\t%v\t%v\t%v\t%v\n", key, t.Count, t.SetUp, t.Handler, t.Queue, t.Composite, t.Total())
+	}
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,85 @@
+package tsg
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProfileReport(t *testing.T) {
+
+	otsg, buildErr := BuildOpenTSG("./testdata/handlerLoaders/loader.json", "", true, &RunnerConfiguration{RunnerCount: 5, ProfilerEnabled: true})
+	otsg.Handle("test.fill", []byte("{}"), Filler{})
+	AddBaseEncoders(otsg)
+	collector := NewProfileCollector()
+	otsg.Use(collector.Middleware())
+	otsg.Run("")
+	os.Remove("./testdata/handlerLoaders/racer.png")
+
+	report := collector.Report()
+	var jsonOut, textOut bytes.Buffer
+	jsonErr := report.WriteJSON(&jsonOut)
+	textErr := report.WriteText(&textOut)
+	var decoded ProfileReport
+	unmarshErr := json.Unmarshal(jsonOut.Bytes(), &decoded)
+
+	Convey("Checking the profiles of a run are collected into a report", t, func() {
+		Convey("running three fill widgets and a canvas, saved as a png", func() {
+			Convey("every widget and the png encode are in the report", func() {
+				So(buildErr, ShouldBeNil)
+				So(report.Widgets, ShouldEqual, 4)
+				So(report.WidgetTypes["test.fill"].Count, ShouldEqual, 3)
+				So(report.WidgetIDs["cs.red"].Count, ShouldEqual, 1)
+				So(report.Encodes["PNG"].Count, ShouldEqual, 1)
+				So(len(report.Frames), ShouldEqual, 1)
+				So(len(report.Frames[0].CriticalPath), ShouldBeGreaterThan, 0)
+				So(jsonErr, ShouldBeNil)
+				So(unmarshErr, ShouldBeNil)
+				So(decoded.Widgets, ShouldEqual, 4)
+				So(textErr, ShouldBeNil)
+				So(textOut.String(), ShouldContainSubstring, "Frame 0 critical path")
+			})
+		})
+	})
+
+	// a frame where c waits for a and b, and d waits for c
+	pc := NewProfileCollector()
+	profiles := []profile{
+		{WID: "a", Wtype: "fill", ZPosition: 0, Handler: 10 * time.Millisecond},
+		{WID: "b", Wtype: "fill", ZPosition: 1, Handler: 30 * time.Millisecond},
+		{WID: "c", Wtype: "text", ZPosition: 2, Handler: 5 * time.Millisecond, Queue: 25 * time.Millisecond, BlockedBy: []string{"a", "b"}},
+		{WID: "d", Wtype: "text", ZPosition: 3, Handler: 5 * time.Millisecond, Queue: 5 * time.Millisecond, BlockedBy: []string{"c"}},
+		{WID: "e", Wtype: "fill", ZPosition: 4, Handler: 20 * time.Millisecond},
+	}
+	for _, p := range profiles {
+		msg, _ := json.Marshal(p)
+		pc.add(p.Wtype, string(msg))
+	}
+	pc.add("core.encode", `{"EncodeTime(ns)":1000,"format":"DPX","file":"a.dpx"}`)
+	pc.add("core.encode", `{"EncodeTime(ns)":3000,"format":"DPX","file":"b.dpx"}`)
+
+	synthetic := pc.Report()
+	var text bytes.Buffer
+	synthetic.WriteText(&text)
+
+	Convey("Checking the critical path of a frame", t, func() {
+		Convey("using a widget that waits for two widgets, which is waited on by another widget", func() {
+			Convey("the path follows the slowest blocking widgets", func() {
+				So(synthetic.Frames[0].CriticalPath, ShouldResemble, []string{"b", "c", "d"})
+				So(synthetic.Frames[0].CriticalTime, ShouldEqual, 40*time.Millisecond)
+				So(synthetic.Frames[0].Blocked, ShouldResemble, []BlockedWidget{
+					{WidgetID: "c", BlockedBy: []string{"a", "b"}, Queue: 25 * time.Millisecond},
+					{WidgetID: "d", BlockedBy: []string{"c"}, Queue: 5 * time.Millisecond}})
+				So(synthetic.WidgetTypes["fill"], ShouldResemble, ProfileTotals{Count: 3, Handler: 60 * time.Millisecond})
+				So(synthetic.Percentiles.Handler, ShouldResemble, Percentiles{P50: 10 * time.Millisecond, P90: 30 * time.Millisecond, P99: 30 * time.Millisecond, Max: 30 * time.Millisecond})
+				So(synthetic.Encodes["DPX"], ShouldResemble, EncodeTotals{Count: 2, Total: 4000, Percentiles: Percentiles{P50: 1000, P90: 3000, P99: 3000, Max: 3000}})
+				So(strings.Contains(text.String(), "waited 25ms for"), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -3,15 +3,22 @@ package tsg
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"image"
 	"image/draw"
 	"io"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"time"
+
+	_ "embed"
 
 	"github.com/mrmxf/opentsg-modules/opentsg-core/colour"
+	"github.com/mrmxf/opentsg-modules/opentsg-core/config/validator"
+	"golang.org/x/image/tiff"
 
 	ascmhl "github.com/mrmxf/opentsg-mhl"
 	"github.com/mrmxf/opentsg-modules/opentsg-io/csvsave"
@@ -29,30 +36,87 @@ type EncodeOptions struct {
 	// the target bitdepth an image is saved to
 	// only relevant for DPX files
 	BitDepth int
+	// Options are the options given to this output
+	// in the canvas widget, they have been validated
+	// against the schema of the encoder.
+	Options map[string]any
+}
+
+// Unmarshal decodes the output options into v,
+// v is left unchanged if there are no options.
+func (e EncodeOptions) Unmarshal(v any) error {
+	if len(e.Options) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(e.Options)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
 }
 
-// HandleFunc registers the handler function for the given pattern in [DefaultServeMux].
-// The documentation for [ServeMux] explains how patterns are matched.
-func (o OpenTSG) EncoderFunc(extension string, encoder Encoder) {
+// EncoderFunc registers the encoder for the given file extension,
+// any output options are accepted by the encoder.
+func (o OpenTSG) EncoderFunc(extension string, encode Encoder) {
+	o.EncoderFuncWithSchema(extension, nil, encode)
+}
+
+// EncoderFuncWithSchema registers the encoder for the given file extension, with
+// an accompanying json schema for the options of each output.
+// If the schema is nil, any options are accepted.
+func (o OpenTSG) EncoderFuncWithSchema(extension string, schema []byte, encode Encoder) {
 	// set up router here
 	extension = strings.ToUpper(extension)
 	if _, ok := o.encoders[extension]; ok {
 		panic(fmt.Sprintf("The encoder extension %s has already been declared", extension))
 	}
 
+	// set a schema if one is given
+	if schema == nil {
+		schema = []byte("{}")
+	}
+
 	// do some checking for invalid characters, if there
 	// are any
 
-	o.encoders[extension] = encoder
+	o.encoders[extension] = encoder{schema: schema, encode: encode}
 
 }
 
+var (
+	//go:embed jsonschema/dpxoptions.json
+	dpxSchema []byte
+	//go:embed jsonschema/exroptions.json
+	exrSchema []byte
+	//go:embed jsonschema/pngoptions.json
+	pngSchema []byte
+	//go:embed jsonschema/tiffoptions.json
+	tiffSchema []byte
+)
+
 /////////////////////////////
 // Save function wrappers //
 ////////////////////////////
 
-// writeTiffFile saves the file as a tiff
-func EncodeTiffFile(w io.Writer, img image.Image, _ EncodeOptions) error {
+// tiffOptions are the output options for tiff files
+type tiffOptions struct {
+	Compression string `json:"compression"`
+}
+
+// EncodeTiffFile saves the file as a tiff
+func EncodeTiffFile(w io.Writer, img image.Image, eo EncodeOptions) error {
+
+	var opts tiffOptions
+	if err := eo.Unmarshal(&opts); err != nil {
+		return err
+	}
+
+	// the compressed files are saved with the go tiff library
+	if opts.Compression == "deflate" {
+		return colour.TiffEncode(w, img, &tiff.Options{Compression: tiff.Deflate, Predictor: true})
+	}
 
 	// check for opaque
 	bound := img.Bounds()
@@ -71,6 +135,8 @@ func EncodeTiffFile(w io.Writer, img image.Image, _ EncodeOptions) error {
 		return tiffup.Encode(w, canvas)
 	case *colour.NRGBA64:
 		return colour.TiffEncode(w, canvas.BaseImage(), nil)
+	case *colour.NRGBAF32:
+		return tiffup.Encode(w, canvas.ToNRGBA64())
 
 	default:
 		// return the alpha channel version anyway
@@ -83,25 +149,74 @@ func EncodeTiffFile(w io.Writer, img image.Image, _ EncodeOptions) error {
 
 }
 
+// pngOptions are the output options for png files
+type pngOptions struct {
+	BitDepth int `json:"bitDepth"`
+}
+
 // EncodePngFile saves the image as a png
-func EncodePngFile(w io.Writer, image image.Image, _ EncodeOptions) error {
-	return colour.PngEncode(w, image)
+func EncodePngFile(w io.Writer, img image.Image, eo EncodeOptions) error {
+
+	var opts pngOptions
+	if err := eo.Unmarshal(&opts); err != nil {
+		return err
+	}
+
+	if opts.BitDepth == 8 {
+		eight := image.NewNRGBA(img.Bounds())
+		colour.Draw(eight, eight.Bounds(), img, img.Bounds().Min, draw.Src)
+		img = eight
+	}
+
+	return colour.PngEncode(w, img)
 }
 
-func EncodeExrFile(w io.Writer, image image.Image, _ EncodeOptions) error {
-	return exr.Encode(w, image)
+// exrOptions are the output options for exr files
+type exrOptions struct {
+	Compression string `json:"compression"`
+	PixelType   string `json:"pixelType"`
 }
 
+// EncodeExrFile saves the image as an exr
+func EncodeExrFile(w io.Writer, image image.Image, eo EncodeOptions) error {
+
+	var opts exrOptions
+	if err := eo.Unmarshal(&opts); err != nil {
+		return err
+	}
+
+	return exr.EncodeWithOptions(w, image, &exr.Options{Compression: opts.Compression, PixelType: opts.PixelType})
+}
+
+// dpxOptions are the output options for dpx files
+type dpxOptions struct {
+	BitDepth   int    `json:"bitDepth"`
+	Packing    string `json:"packing"`
+	Endianness string `json:"endianness"`
+}
+
+// EncodeDPXFile saves the image as a dpx
 func EncodeDPXFile(w io.Writer, toDraw image.Image, eo EncodeOptions) error {
+
+	// the output bit depth is used over the global depth
+	opts := dpxOptions{BitDepth: eo.BitDepth}
+	if err := eo.Unmarshal(&opts); err != nil {
+		return err
+	}
+
 	// default all files to 16 bit
-	if eo.BitDepth == 0 {
-		eo.BitDepth = 16
+	if opts.BitDepth == 0 {
+		opts.BitDepth = 16
 	}
+
+	dpxOpts := &dpx.Options{Bitdepth: opts.BitDepth, Packing: opts.Packing, Endianness: opts.Endianness}
 	switch canvas := toDraw.(type) {
 	case *image.NRGBA64:
-		return dpx.Encode(w, canvas, &dpx.Options{Bitdepth: eo.BitDepth})
+		return dpx.Encode(w, canvas, dpxOpts)
 	case *colour.NRGBA64:
-		return dpx.Encode(w, canvas.BaseImage(), &dpx.Options{Bitdepth: eo.BitDepth})
+		return dpx.Encode(w, canvas.BaseImage(), dpxOpts)
+	case *colour.NRGBAF32:
+		return dpx.Encode(w, canvas.ToNRGBA64(), dpxOpts)
 	default:
 		return fmt.Errorf("configuration error image of type %v can not be saved as a dpx", reflect.TypeOf(toDraw))
 	}
@@ -117,6 +232,8 @@ func EncodeCSVFile(w io.Writer, toDraw image.Image, _ EncodeOptions) error {
 		return csvsave.Encode(w, canvas)
 	case *colour.NRGBA64:
 		return csvsave.Encode(w, canvas.BaseImage())
+	case *colour.NRGBAF32:
+		return csvsave.Encode(w, canvas.ToNRGBA64())
 	default:
 		return fmt.Errorf("configuration error image of type %v can not be saved as a csv", reflect.TypeOf(toDraw))
 
@@ -135,22 +252,22 @@ Add base encoders adds the following file encoders to an OpenTSG object:
 */
 func AddBaseEncoders(tsg *OpenTSG) {
 
-	tsg.EncoderFunc("dpx", EncodeDPXFile)
+	tsg.EncoderFuncWithSchema("dpx", dpxSchema, EncodeDPXFile)
 	tsg.EncoderFunc("csv", EncodeCSVFile)
-	tsg.EncoderFunc("png", EncodePngFile)
-	tsg.EncoderFunc("exr", EncodeExrFile)
-	tsg.EncoderFunc("tiff", EncodeTiffFile)
-	tsg.EncoderFunc("tif", EncodeTiffFile)
+	tsg.EncoderFuncWithSchema("png", pngSchema, EncodePngFile)
+	tsg.EncoderFuncWithSchema("exr", exrSchema, EncodeExrFile)
+	tsg.EncoderFuncWithSchema("tiff", tiffSchema, EncodeTiffFile)
+	tsg.EncoderFuncWithSchema("tif", tiffSchema, EncodeTiffFile)
 
 }
 
-func (tsg *OpenTSG) encodeFrame(filename string, base draw.Image, opts EncodeOptions) error {
-
+// getEncoder returns the encoder for the extension of the filename
+func (tsg *OpenTSG) getEncoder(filename string) (encoder, error) {
 	extensions := strings.Split(filename, ".")
 	ext := extensions[len(extensions)-1]
 
 	// extract the extension type
-	encodeFunc, ok := tsg.encoders[strings.ToUpper(ext)]
+	enc, ok := tsg.encoders[strings.ToUpper(ext)]
 
 	if !ok {
 		formats := make([]string, len(tsg.encoders))
@@ -160,31 +277,69 @@ func (tsg *OpenTSG) encodeFrame(filename string, base draw.Image, opts EncodeOpt
 			i++
 		}
 
-		return fmt.Errorf("%s does not have an available encoder, available encoders are: %v", filename, formats)
+		return encoder{}, fmt.Errorf("%s does not have an available encoder, available encoders are: %v", filename, formats)
+	}
+
+	return enc, nil
+}
+
+// validateOutputOptions checks the options of an output against
+// the schema of the encoder for that file type.
+func (tsg *OpenTSG) validateOutputOptions(filename string, options map[string]any, lines validator.JSONLines) []error {
+	if options == nil {
+		return nil
+	}
+
+	enc, err := tsg.getEncoder(filename)
+	if err != nil {
+		return []error{err}
+	}
+
+	optBytes, err := json.Marshal(options)
+	if err != nil {
+		return []error{fmt.Errorf("0054 %v", err)}
+	}
+
+	return validator.SchemaValidator(enc.schema, optBytes, filename, lines)
+}
+
+// encodeFrame saves the frame and its hash, returning
+// the time taken to encode the frame.
+func (tsg *OpenTSG) encodeFrame(filename string, base draw.Image, opts EncodeOptions) (time.Duration, error) {
+
+	enc, err := tsg.getEncoder(filename)
+	if err != nil {
+		return 0, err
 	}
 
 	// open the file if not sth or the other
 
-	saveTarget, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0777)
+	saveTarget, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0777)
 	if err != nil {
-		return fmt.Errorf("0051 %v", err)
+		return 0, fmt.Errorf("0051 %v", err)
 	}
 
 	defer saveTarget.Close()
 
 	// wrap the function based in a context
 	var fwErr error
+	var encodeTime time.Duration
+	stats := &EncodeStats{Format: strings.ToUpper(strings.TrimPrefix(filepath.Ext(filename), "."))}
 	encodeContext := ContFunc(func(ctx context.Context) {
-		fwErr = encodeFunc(saveTarget, base, opts)
+		start := time.Now()
+		counter := &countWriter{w: saveTarget}
+		fwErr = enc.encode(counter, base, opts)
+		encodeTime = time.Since(start)
+		stats.Bytes = counter.n
 
 	})
 
 	// add the middleware for the encoders
 	encoder := chain(tsg.contextMiddlewares, encodeContext)
 
-	encoder(setName(context.Background(), filename))
+	encoder(context.WithValue(setName(context.Background(), filename), encodeStatsKey, stats))
 	if fwErr != nil {
-		return fmt.Errorf("0051 %v", fwErr)
+		return 0, fmt.Errorf("0051 %v", fwErr)
 	}
 
 	// Amend the case statement for the different types of files here.
@@ -193,6 +348,9 @@ func (tsg *OpenTSG) encodeFrame(filename string, base draw.Image, opts EncodeOpt
 
 	// get the 16 bit pixels and put it through
 	canvas, ok := base.(*image.NRGBA64)
+	if fImg, isFloat := base.(*colour.NRGBAF32); isFloat {
+		canvas, ok = fImg.ToNRGBA64(), true
+	}
 	if !ok { // set to nrgba64 if not ok
 		canvas = image.NewNRGBA64(base.Bounds())
 		colour.Draw(canvas, canvas.Bounds(), base, image.Point{}, draw.Src)
@@ -201,14 +359,27 @@ func (tsg *OpenTSG) encodeFrame(filename string, base draw.Image, opts EncodeOpt
 	// reset the file to the start for the hashreader
 	_, err = saveTarget.Seek(0, io.SeekStart)
 	if err != nil {
-		return fmt.Errorf("0052 %v", err)
+		return 0, fmt.Errorf("0052 %v", err)
 	}
 	err = ascmhl.MhlGenFile(saveTarget, ascmhl.ToHash{Md5: true, C4: true, Xxh128: true, Crc32RGB: true, Crc16RGB: true}, pixB, 16)
 
 	if err != nil {
-		return fmt.Errorf("0053 %v", err)
+		return 0, fmt.Errorf("0053 %v", err)
 	}
-	return err
+	return encodeTime, err
 	// return saveCRC(saveTarget, pixB)
 
 }
+
+// countWriter counts the bytes written to w
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
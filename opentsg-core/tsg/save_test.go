@@ -1,3 +1,115 @@
 package tsg
 
-// . "github.com/smartystreets/goconvey/convey"
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEncodeOptions(t *testing.T) {
+
+	otsg, err := BuildOpenTSG("./testdata/handlerLoaders/loader.json", "", true, nil)
+	AddBaseEncoders(otsg)
+
+	goodOptions := []map[string]any{
+		{"bitDepth": 10, "packing": "filledB", "endianness": "little"},
+		{"compression": "zip", "pixelType": "float"},
+		{"bitDepth": 8},
+		{"compression": "deflate"},
+	}
+	badOptions := []map[string]any{
+		{"bitDepth": 9},
+		{"compression": "piz"},
+		{"bitDepth": 8, "quality": 100},
+		{"compression": "lzw"},
+	}
+	files := []string{"frame.dpx", "frame.exr", "frame.png", "frame.tiff"}
+
+	for i, opt := range badOptions {
+		good := goodOptions[i]
+		goodErrs := otsg.validateOutputOptions(files[i], good, nil)
+		badErrs := otsg.validateOutputOptions(files[i], opt, nil)
+		// files without options are always valid
+		noErrs := otsg.validateOutputOptions(files[i], nil, nil)
+
+		Convey("Checking output options are validated against the encoder schema", t, func() {
+			Convey(fmt.Sprintf("using the file %s with the options %v and %v", files[i], good, opt), func() {
+				Convey("only the invalid options return an error", func() {
+					So(err, ShouldBeNil)
+					So(goodErrs, ShouldBeNil)
+					So(noErrs, ShouldBeNil)
+					So(len(badErrs), ShouldBeGreaterThan, 0)
+				})
+			})
+		})
+	}
+
+	var dpxOpts dpxOptions
+	unmarshErr := EncodeOptions{Options: map[string]any{"bitDepth": 12, "packing": "filledA"}}.Unmarshal(&dpxOpts)
+
+	Convey("Checking the options can be decoded by the encoder", t, func() {
+		Convey("using dpx options of a bit depth of 12 and filledA packing", func() {
+			Convey("the options are decoded into the dpx options", func() {
+				So(unmarshErr, ShouldBeNil)
+				So(dpxOpts, ShouldResemble, dpxOptions{BitDepth: 12, Packing: "filledA"})
+			})
+		})
+	})
+
+	base := image.NewNRGBA64(image.Rect(0, 0, 10, 10))
+	var pngBuf, dpxBuf, exrNone, exrZip bytes.Buffer
+	pngErr := EncodePngFile(&pngBuf, base, EncodeOptions{Options: map[string]any{"bitDepth": 8}})
+	dpxErr := EncodeDPXFile(&dpxBuf, base, EncodeOptions{BitDepth: 16, Options: map[string]any{"bitDepth": 10, "endianness": "little"}})
+	exrErr := EncodeExrFile(&exrNone, base, EncodeOptions{})
+	exrZipErr := EncodeExrFile(&exrZip, base, EncodeOptions{Options: map[string]any{"compression": "zip"}})
+
+	Convey("Checking the options change the encoded files", t, func() {
+		Convey("using an 8 bit png, a little endian 10 bit dpx and a zip compressed exr", func() {
+			Convey("each file is saved with the options", func() {
+				So(pngErr, ShouldBeNil)
+				// the bit depth of the png header
+				So(pngBuf.Bytes()[24], ShouldEqual, 8)
+				So(dpxErr, ShouldBeNil)
+				So(string(dpxBuf.Bytes()[:4]), ShouldEqual, "XPDS")
+				// the bit depth of the first image element
+				So(dpxBuf.Bytes()[803], ShouldEqual, 10)
+				So(exrErr, ShouldBeNil)
+				So(exrZipErr, ShouldBeNil)
+				So(exrZip.Len(), ShouldBeLessThan, exrNone.Len())
+			})
+		})
+	})
+}
+
+func TestOutputOptions(t *testing.T) {
+
+	otsg, err := BuildOpenTSG("./testdata/encoderLoaders/loader.json", "", true, nil)
+	AddBaseEncoders(otsg)
+	dir := t.TempDir()
+	otsg.Run(dir)
+
+	dpxFile, dpxErr := os.ReadFile(filepath.Join(dir, "frame.dpx"))
+	pngFile, pngErr := os.ReadFile(filepath.Join(dir, "frame.png"))
+	_, exrErr := os.Stat(filepath.Join(dir, "frame.exr"))
+	_, tiffErr := os.Stat(filepath.Join(dir, "invalid.tiff"))
+
+	Convey("Checking each output of a frame is saved with its own options", t, func() {
+		Convey("using a canvas with a 10 bit dpx, an 8 bit png, an exr without options and a tiff with invalid options", func() {
+			Convey("the files are saved with their options and the invalid tiff is not saved", func() {
+				So(err, ShouldBeNil)
+				So(dpxErr, ShouldBeNil)
+				So(string(dpxFile[:4]), ShouldEqual, "XPDS")
+				So(dpxFile[803], ShouldEqual, 10)
+				So(pngErr, ShouldBeNil)
+				So(pngFile[24], ShouldEqual, 8)
+				So(exrErr, ShouldBeNil)
+				So(tiffErr, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,230 @@
+package dpx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/mrmxf/opentsg-modules/opentsg-core/colour"
+)
+
+// header offsets of the values used for decoding
+const (
+	pixelsPerLineOffset = 772
+	linesOffset         = 776
+	descriptorOffset    = 800
+	colorimetricOffset  = 802
+	bitDepthOffset      = 803
+	packingOffset       = 804
+	dataOffsetOffset    = 808
+)
+
+// colorimetricSpaces are the colour spaces of the dpx
+// colorimetric specification codes
+var colorimetricSpaces = map[uint8]colour.ColorSpace{
+	6: {ColorSpace: "rec709"},
+	7: {ColorSpace: "rec601"},
+	8: {ColorSpace: "rec601"},
+}
+
+// Decode reads a dpx file as an image. Only the first image element is
+// decoded, which must be RGB with a bit depth of 8, 10, 12 or 16 bits.
+//
+// The colour space of the image is set from the colorimetric specification
+// of the element, if the specification does not match a known colour space
+// then the colour space is left empty.
+func Decode(r io.Reader) (*colour.NRGBA64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < dataOffsetOffset+4 {
+		return nil, fmt.Errorf("file too small to be a dpx file")
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:4]) {
+	case "SDPX":
+		order = binary.BigEndian
+	case "XPDS":
+		order = binary.LittleEndian
+	default:
+		return nil, fmt.Errorf("invalid dpx magic number %q", data[:4])
+	}
+
+	width := int(order.Uint32(data[pixelsPerLineOffset:]))
+	height := int(order.Uint32(data[linesOffset:]))
+	bitdepth := int(data[bitDepthOffset])
+	packing := order.Uint16(data[packingOffset:])
+	offset := int(order.Uint32(data[dataOffsetOffset:]))
+
+	if data[descriptorOffset] != 50 {
+		return nil, fmt.Errorf("unsupported image descriptor %v, only RGB (50) dpx files can be decoded", data[descriptorOffset])
+	}
+
+	if offset > len(data) {
+		return nil, fmt.Errorf("the data offset %v is beyond the end of the file", offset)
+	}
+
+	body := append([]byte{}, data[offset:]...)
+	// undo the little endian byte order
+	if order == binary.LittleEndian {
+		body = toBigEndian(body, bitdepth)
+	}
+
+	img := colour.NewNRGBA64(colorimetricSpaces[data[colorimetricOffset]], image.Rect(0, 0, width, height))
+	base := img.BaseImage()
+
+	switch bitdepth {
+	case 8:
+		err = decode8(base, body)
+	case 10:
+		err = decode10(base, body, packing)
+	case 12:
+		err = decode12(base, body)
+	case 16:
+		err = decode16(base, body)
+	default:
+		err = fmt.Errorf("unsupported bit depth of %v, only 8, 10, 12 and 16 bit dpx files can be decoded", bitdepth)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// toBigEndian reverses toLittleEndian, any
+// incomplete values at the end of the buffer are dropped.
+func toBigEndian(buf []byte, bitdepth int) []byte {
+	size := 4
+	if bitdepth == 16 {
+		size = 2
+	}
+
+	// the swap is symmetrical so the same function is used
+	return toLittleEndian(buf[:len(buf)-len(buf)%size], bitdepth)
+}
+
+// setRGB sets the pixel at x,y with 16 bit values
+// and an opaque alpha.
+func setRGB(img *image.NRGBA64, x, y int, r, g, b uint16) {
+	i := img.PixOffset(x, y)
+	pix := img.Pix[i : i+8 : i+8]
+	pix[0], pix[1] = byte(r>>8), byte(r)
+	pix[2], pix[3] = byte(g>>8), byte(g)
+	pix[4], pix[5] = byte(b>>8), byte(b)
+	pix[6], pix[7] = 0xff, 0xff
+}
+
+// scale converts a value of depth bits to 16 bits,
+// by repeating the most significant bits.
+func scale(v uint32, depth int) uint16 {
+	v16 := v << (16 - depth)
+
+	return uint16(v16 | v16>>depth)
+}
+
+func dataTooSmall(need, got int) error {
+	return fmt.Errorf("the image data is %v bytes, expected %v bytes", got, need)
+}
+
+// decode8 reads the 8 bit values, in the b,g,r order
+// they are written.
+func decode8(img *image.NRGBA64, body []byte) error {
+	b := img.Bounds().Max
+	if len(body) < b.X*b.Y*3 {
+		return dataTooSmall(b.X*b.Y*3, len(body))
+	}
+
+	off := 0
+	for y := 0; y < b.Y; y++ {
+		for x := 0; x < b.X; x++ {
+			setRGB(img, x, y, scale(uint32(body[off+2]), 8), scale(uint32(body[off+1]), 8), scale(uint32(body[off]), 8))
+			off += 3
+		}
+	}
+
+	return nil
+}
+
+// decode10 reads the 32 bit words of r,g,b.
+// Packing 1 has the padding bits at the end of the word
+// and packing 2 has the padding at the start.
+func decode10(img *image.NRGBA64, body []byte, packing uint16) error {
+	b := img.Bounds().Max
+	if len(body) < b.X*b.Y*4 {
+		return dataTooSmall(b.X*b.Y*4, len(body))
+	}
+
+	shift := 2
+	if packing == 2 {
+		shift = 0
+	}
+
+	off := 0
+	for y := 0; y < b.Y; y++ {
+		for x := 0; x < b.X; x++ {
+			word := binary.BigEndian.Uint32(body[off:off+4]) >> shift
+			setRGB(img, x, y, scale(word>>20&0x3ff, 10), scale(word>>10&0x3ff, 10), scale(word&0x3ff, 10))
+			off += 4
+		}
+	}
+
+	return nil
+}
+
+// decode12 reads the 12 bit values, that are packed least
+// significant bit first into 32 bit words. Each line is
+// padded to a whole 32 bit word.
+func decode12(img *image.NRGBA64, body []byte) error {
+	b := img.Bounds().Max
+	lineWords := (b.X*36 + 31) / 32
+	if len(body) < lineWords*4*b.Y {
+		return dataTooSmall(lineWords*4*b.Y, len(body))
+	}
+
+	for y := 0; y < b.Y; y++ {
+		line := body[y*lineWords*4 : (y+1)*lineWords*4]
+		// read the next 12 bits from the line
+		bit := 0
+		next := func() uint32 {
+			var v uint32
+			for i := 0; i < 12; i++ {
+				word := binary.BigEndian.Uint32(line[(bit/32)*4:])
+				v |= (word >> (bit % 32) & 1) << i
+				bit++
+			}
+
+			return v
+		}
+
+		for x := 0; x < b.X; x++ {
+			r, g, bl := next(), next(), next()
+			setRGB(img, x, y, scale(r, 12), scale(g, 12), scale(bl, 12))
+		}
+	}
+
+	return nil
+}
+
+// decode16 reads the big endian 16 bit r,g,b values
+func decode16(img *image.NRGBA64, body []byte) error {
+	b := img.Bounds().Max
+	if len(body) < b.X*b.Y*6 {
+		return dataTooSmall(b.X*b.Y*6, len(body))
+	}
+
+	off := 0
+	for y := 0; y < b.Y; y++ {
+		for x := 0; x < b.X; x++ {
+			setRGB(img, x, y, binary.BigEndian.Uint16(body[off:]), binary.BigEndian.Uint16(body[off+2:]), binary.BigEndian.Uint16(body[off+4:]))
+			off += 6
+		}
+	}
+
+	return nil
+}
@@ -11,17 +11,58 @@ import (
 	"reflect"
 )
 
+// Options are the encoding options for a dpx file
 type Options struct {
+	// Bitdepth is 8, 10, 12 or 16
 	Bitdepth int
+	// Packing is the packing method of 10 bit files, either
+	// "filledA" (the default) where the padding bits are the
+	// least significant bits of each 32 bit word, or "filledB"
+	// where they are the most significant bits.
+	Packing string
+	// Endianness is the byte order of the file, either
+	// "big" (the default) or "little"
+	Endianness string
 }
 
+const (
+	// PackingFilledA is the padding at the end of the 32 bit word
+	PackingFilledA = "filledA"
+	// PackingFilledB is the padding at the start of the 32 bit word
+	PackingFilledB = "filledB"
+	// BigEndian is the default byte order
+	BigEndian    = "big"
+	LittleEndian = "little"
+)
+
 // Encode writes the image m to the file based on the bitdepth, if it is nil a 16 bit image is saved
 func Encode(w io.Writer, m image.Image, options *Options) error {
+	if options == nil {
+		options = &Options{Bitdepth: 16}
+	}
+
+	switch options.Bitdepth {
+	case 8, 10, 12, 16:
+	default:
+		return fmt.Errorf("unsupported bit depth of %v, only 8, 10, 12 and 16 bit dpx files can be saved", options.Bitdepth)
+	}
+
+	switch options.Packing {
+	case "", PackingFilledA, PackingFilledB:
+	default:
+		return fmt.Errorf("unknown packing \"%s\" only \"%s\" and \"%s\" are available", options.Packing, PackingFilledA, PackingFilledB)
+	}
+
+	switch options.Endianness {
+	case "", BigEndian, LittleEndian:
+	default:
+		return fmt.Errorf("unknown endianness \"%s\" only \"%s\" and \"%s\" are available", options.Endianness, BigEndian, LittleEndian)
+	}
 
 	switch im := m.(type) {
 	case *image.NRGBA64:
 		// generate the header and body
-		btotal := headerGen(im, options.Bitdepth)
+		btotal := optionsGen(im, *options)
 		// conver to io.reader and write as a stream loop through as a buffer etc
 		_, err := w.Write(btotal)
 		return err
@@ -33,6 +74,20 @@ func Encode(w io.Writer, m image.Image, options *Options) error {
 }
 
 func headerGen(canvas *image.NRGBA64, bitdepth int) []byte {
+	return optionsGen(canvas, Options{Bitdepth: bitdepth})
+}
+
+// optionsGen generates the dpx file with the packing
+// and byte order of the options.
+func optionsGen(canvas *image.NRGBA64, opts Options) []byte {
+	bitdepth := opts.Bitdepth
+	var order binary.ByteOrder = binary.BigEndian
+	magic := "SDPX"
+	if opts.Endianness == LittleEndian {
+		order = binary.LittleEndian
+		magic = "XPDS"
+	}
+
 	// Magic Numb]er
 	// offset
 	// version number
@@ -56,7 +111,7 @@ func headerGen(canvas *image.NRGBA64, bitdepth int) []byte {
 	// assign all these values
 	var header dpxHeaders
 
-	header.MagicNumber = "SDPX"
+	header.MagicNumber = magic
 	header.Offset = 8192
 	header.HeaderVersion = "V2.0"
 	header.Creator = "MR MXF's golang dpx writer"
@@ -88,6 +143,14 @@ func headerGen(canvas *image.NRGBA64, bitdepth int) []byte {
 	case 10:
 		ImageBuf = encode10(canvas.Pix, canvas.Bounds().Max.X, canvas.Bounds().Max.Y)
 		header.DataStructure1.Packing = 1
+		if opts.Packing == PackingFilledB {
+			// move the padding bits to the start of the word
+			for i := 0; i+4 <= len(ImageBuf); i += 4 {
+				word := binary.BigEndian.Uint32(ImageBuf[i : i+4])
+				binary.BigEndian.PutUint32(ImageBuf[i:i+4], word>>2)
+			}
+			header.DataStructure1.Packing = 2
+		}
 	case 12:
 		ImageBuf = encode12(canvas.Pix, canvas.Bounds().Max.X, canvas.Bounds().Max.Y)
 		header.DataStructure1.Packing = 0
@@ -106,13 +169,40 @@ func headerGen(canvas *image.NRGBA64, bitdepth int) []byte {
 
 	// assign extra data if required like date time etc
 
-	b, _ := header.byteConvert()
+	if order == binary.LittleEndian {
+		ImageBuf = toLittleEndian(ImageBuf, bitdepth)
+	}
+
+	b, _ := header.byteConvert(order)
 
 	b = append(b, ImageBuf...)
 	return b
 }
 
-func (dpxhead *dpxHeaders) byteConvert() ([]byte, error) {
+// toLittleEndian reverses the bytes of each 16 bit value for 16 bit images,
+// and each 32 bit word for every other bit depth.
+func toLittleEndian(buf []byte, bitdepth int) []byte {
+	if bitdepth == 16 {
+		for i := 0; i+2 <= len(buf); i += 2 {
+			buf[i], buf[i+1] = buf[i+1], buf[i]
+		}
+
+		return buf
+	}
+
+	// pad to a complete 32 bit word
+	if len(buf)%4 != 0 {
+		buf = append(buf, make([]byte, 4-len(buf)%4)...)
+	}
+
+	for i := 0; i+4 <= len(buf); i += 4 {
+		buf[i], buf[i+1], buf[i+2], buf[i+3] = buf[i+3], buf[i+2], buf[i+1], buf[i]
+	}
+
+	return buf
+}
+
+func (dpxhead *dpxHeaders) byteConvert(order binary.ByteOrder) ([]byte, error) {
 
 	v := reflect.ValueOf(dpxhead).Elem()
 	vtype := v.Type()
@@ -124,18 +214,18 @@ func (dpxhead *dpxHeaders) byteConvert() ([]byte, error) {
 	for i := 0; i < v.NumField(); i++ {
 		fieldname := vtype.Field(i).Name
 		// write to a length of bytes as specified
-		dint := dpxhead.fieldTobyte(fieldname, length[i])
+		dint := dpxhead.fieldTobyte(fieldname, length[i], order)
 		// update the final user defined length to access the data
 		data.Write(dint)
 	}
 	return data.Bytes(), nil
 }
 
-func (dpxhead *dpxHeaders) fieldTobyte(fieldname string, length int) []byte {
+func (dpxhead *dpxHeaders) fieldTobyte(fieldname string, length int, order binary.ByteOrder) []byte {
 	structVal := reflect.ValueOf(dpxhead).Elem()
 	structField := structVal.FieldByName(fieldname)
 
-	b := valueGet(structField.Interface())
+	b := valueGet(structField.Interface(), order)
 	if len(b) != length {
 		filler := make([]byte, length-len(b))
 		b = append(b, filler...)
@@ -143,7 +233,7 @@ func (dpxhead *dpxHeaders) fieldTobyte(fieldname string, length int) []byte {
 	return b
 }
 
-func (ii *imageInfo) byteConvert() []byte {
+func (ii *imageInfo) byteConvert(order binary.ByteOrder) []byte {
 
 	v := reflect.ValueOf(ii).Elem()
 	vtype := v.Type()
@@ -155,7 +245,7 @@ func (ii *imageInfo) byteConvert() []byte {
 	for i := 0; i < v.NumField(); i++ {
 		fieldname := vtype.Field(i).Name
 		// write to a length of bytes as specified
-		dataInt := ii.iifieldToByte(fieldname, imageLength[i])
+		dataInt := ii.iifieldToByte(fieldname, imageLength[i], order)
 		// update the final user defined length to access the data
 		data.Write(dataInt)
 	}
@@ -163,10 +253,10 @@ func (ii *imageInfo) byteConvert() []byte {
 	return data.Bytes()
 }
 
-func (ii *imageInfo) iifieldToByte(fieldname string, length int) []byte {
+func (ii *imageInfo) iifieldToByte(fieldname string, length int, order binary.ByteOrder) []byte {
 	structVal := reflect.ValueOf(ii).Elem()
 	structField := structVal.FieldByName(fieldname)
-	b := valueGet(structField.Interface())
+	b := valueGet(structField.Interface(), order)
 	if len(b) != length {
 		filler := make([]byte, length-len(b))
 		b = append(b, filler...)
@@ -174,17 +264,17 @@ func (ii *imageInfo) iifieldToByte(fieldname string, length int) []byte {
 	return b
 }
 
-func valueGet(vinter interface{}) []byte {
+func valueGet(vinter interface{}, order binary.ByteOrder) []byte {
 	var b []byte
 	switch v := vinter.(type) {
 	case string:
 		b = []byte(v)
 	case uint32:
 		b = make([]byte, 4)
-		binary.BigEndian.PutUint32(b, v)
+		order.PutUint32(b, v)
 	case uint16:
 		b = make([]byte, 2)
-		binary.BigEndian.PutUint16(b, v)
+		order.PutUint16(b, v)
 	case uint8:
 		bint := byte(v)
 		b = append(b, bint)
@@ -192,7 +282,7 @@ func valueGet(vinter interface{}) []byte {
 
 		for i := 0; i < len(v); i++ {
 			bint := make([]byte, 4)
-			binary.BigEndian.PutUint32(bint, v[i])
+			order.PutUint32(bint, v[i])
 			// series of integer arrays
 			b = append(b, bint...)
 		}
@@ -200,14 +290,14 @@ func valueGet(vinter interface{}) []byte {
 
 		for i := 0; i < len(v); i++ {
 			bint := make([]byte, 2)
-			binary.BigEndian.PutUint16(bint, v[i])
+			order.PutUint16(bint, v[i])
 			// series of integer arrays
 			b = append(b, bint...)
 		}
 	case imageInfo:
 		tempIm := vinter.(imageInfo)
 		// generate a struct to assign to the element
-		b = tempIm.byteConvert()
+		b = tempIm.byteConvert(order)
 	default:
 		// err = fmt.Errorf("Invalid type for field ")
 	}
@@ -1,9 +1,11 @@
 package dpx
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
 	"os"
 	"testing"
@@ -117,3 +119,61 @@ BenchmarkEncode12-16                1046          45226782 ns/op
 BenchmarkEncode16-16                1098          47361543 ns/op
 BenchmarkEncode8-16                 1395          29190676 ns/op
 */
+
+func TestDecode(t *testing.T) {
+
+	base := image.NewNRGBA64(image.Rect(0, 0, 16, 5))
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 16; x++ {
+			base.Set(x, y, color.NRGBA64{R: uint16(x * 5000), G: uint16(y * 12000), B: uint16((x + y) * 3000), A: 0xffff})
+		}
+	}
+
+	options := []Options{
+		{Bitdepth: 8}, {Bitdepth: 10}, {Bitdepth: 10, Packing: PackingFilledB},
+		{Bitdepth: 12}, {Bitdepth: 16}, {Bitdepth: 10, Endianness: LittleEndian},
+		{Bitdepth: 12, Endianness: LittleEndian}, {Bitdepth: 16, Endianness: LittleEndian},
+	}
+
+	for _, opt := range options {
+		var buf bytes.Buffer
+		encErr := Encode(&buf, base, &opt)
+		decoded, decErr := Decode(&buf)
+
+		// the largest difference between the decoded
+		// image and the original
+		var diff int
+		if decErr == nil {
+			for y := 0; y < 5; y++ {
+				for x := 0; x < 16; x++ {
+					want := base.NRGBA64At(x, y)
+					got := decoded.BaseImage().NRGBA64At(x, y)
+					for _, d := range []int{int(want.R) - int(got.R), int(want.G) - int(got.G), int(want.B) - int(got.B)} {
+						diff = max(diff, d, -d)
+					}
+				}
+			}
+		}
+
+		Convey("Checking dpx files can be decoded", t, func() {
+			Convey(fmt.Sprintf("using a file saved with the options %+v", opt), func() {
+				Convey("the decoded image matches the original to the precision of the bit depth", func() {
+					So(encErr, ShouldBeNil)
+					So(decErr, ShouldBeNil)
+					So(decoded.Bounds(), ShouldResemble, base.Bounds())
+					So(diff, ShouldBeLessThan, 1<<(16-opt.Bitdepth))
+				})
+			})
+		})
+	}
+
+	_, emptyErr := Decode(bytes.NewReader(nil))
+
+	Convey("Checking invalid dpx files are not decoded", t, func() {
+		Convey("using an empty file", func() {
+			Convey("an error is returned", func() {
+				So(emptyErr, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,336 @@
+package exr
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/mrmxf/opentsg-modules/opentsg-core/colour"
+	"github.com/x448/float16"
+)
+
+// tiled is the version flag for tiled exr files
+const tiled = 0x200
+
+// channel is a channel from the exr channel list
+type channel struct {
+	name      string
+	pixelType uint32
+}
+
+// size is the bytes per value of the channel
+func (c channel) size() int {
+	if c.pixelType == 1 {
+		return 2
+	}
+
+	return 4
+}
+
+// primaries are the chromaticities of the known colour spaces,
+// as the r,g,b then whitepoint x and y values.
+var primaries = []struct {
+	space  colour.ColorSpace
+	points [8]float32
+}{
+	{colour.ColorSpace{ColorSpace: "rec709"}, [8]float32{0.64, 0.33, 0.3, 0.6, 0.15, 0.06, 0.3127, 0.3290}},
+	{colour.ColorSpace{ColorSpace: "rec2020"}, [8]float32{0.708, 0.292, 0.170, 0.797, 0.131, 0.046, 0.3127, 0.3290}},
+	{colour.ColorSpace{ColorSpace: "p3"}, [8]float32{0.68, 0.32, 0.265, 0.69, 0.15, 0.06, 0.3127, 0.3290}},
+	{colour.ColorSpace{ColorSpace: "rec601"}, [8]float32{0.63, 0.34, 0.31, 0.595, 0.155, 0.07, 0.3127, 0.3290}},
+}
+
+// Decode reads a scan line exr file, that is uncompressed or zip compressed,
+// as an image. Values are clipped to the range 0 to 1.
+//
+// The colour space of the image is found from the chromaticities of the file.
+// Files without chromaticities are rec709, as the exr specification states,
+// and files with unknown chromaticities have an empty colour space.
+func Decode(r io.Reader) (*colour.NRGBA64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 8 || !bytes.Equal(data[:4], magic) {
+		return nil, fmt.Errorf("invalid exr magic number")
+	}
+
+	dir := binary.LittleEndian
+	if dir.Uint32(data[4:8])&tiled != 0 {
+		return nil, fmt.Errorf("tiled exr files are not supported")
+	}
+
+	var channels []channel
+	var compression byte
+	var window image.Rectangle
+	space := colour.ColorSpace{ColorSpace: "rec709"}
+	windowFound := false
+
+	// read each header until the terminator
+	pos := 8
+	for {
+		name, next, err := nullString(data, pos)
+		if err != nil {
+			return nil, err
+		}
+		pos = next
+		if name == "" {
+			break
+		}
+
+		_, next, err = nullString(data, pos)
+		if err != nil {
+			return nil, err
+		}
+		pos = next
+		if pos+4 > len(data) {
+			return nil, fmt.Errorf("unexpected end of the exr headers")
+		}
+
+		size := int(dir.Uint32(data[pos:]))
+		pos += 4
+		if size < 0 || pos+size > len(data) {
+			return nil, fmt.Errorf("the header %s is larger than the file", name)
+		}
+		value := data[pos : pos+size]
+		pos += size
+
+		switch name {
+		case "channels":
+			channels, err = channelList(value)
+			if err != nil {
+				return nil, err
+			}
+		case "compression":
+			if len(value) > 0 {
+				compression = value[0]
+			}
+		case "dataWindow":
+			if len(value) < 16 {
+				return nil, fmt.Errorf("invalid data window")
+			}
+			window = image.Rect(int(int32(dir.Uint32(value))), int(int32(dir.Uint32(value[4:]))),
+				int(int32(dir.Uint32(value[8:])))+1, int(int32(dir.Uint32(value[12:])))+1)
+			windowFound = true
+		case "chromaticities":
+			if len(value) < 32 {
+				return nil, fmt.Errorf("invalid chromaticities")
+			}
+			var points [8]float32
+			for i := range points {
+				points[i] = math.Float32frombits(dir.Uint32(value[i*4:]))
+			}
+			space = chromaticitySpace(points)
+		}
+	}
+
+	if !windowFound || window.Empty() {
+		return nil, fmt.Errorf("the exr file does not have a valid data window")
+	}
+
+	var lines int
+	switch compression {
+	case 0, 2:
+		lines = 1
+	case 3:
+		lines = 16
+	default:
+		return nil, fmt.Errorf("unsupported compression type %v, only uncompressed and zip compressed exr files can be decoded", compression)
+	}
+
+	width, height := window.Dx(), window.Dy()
+	lineSize := 0
+	for _, c := range channels {
+		lineSize += width * c.size()
+	}
+
+	img := colour.NewNRGBA64(space, image.Rect(0, 0, width, height))
+	base := img.BaseImage()
+	// set the alpha for files without an alpha channel
+	for i := 6; i < len(base.Pix); i += 8 {
+		base.Pix[i], base.Pix[i+1] = 0xff, 0xff
+	}
+
+	chunks := (height + lines - 1) / lines
+	if pos+chunks*8 > len(data) {
+		return nil, fmt.Errorf("unexpected end of the exr offset table")
+	}
+
+	for c := 0; c < chunks; c++ {
+		offset := int(dir.Uint64(data[pos+c*8:]))
+		if offset < 0 || offset+8 > len(data) {
+			return nil, fmt.Errorf("the offset of chunk %v is beyond the end of the file", c)
+		}
+
+		y := int(int32(dir.Uint32(data[offset:]))) - window.Min.Y
+		size := int(dir.Uint32(data[offset+4:]))
+		if offset+8+size > len(data) {
+			return nil, fmt.Errorf("chunk %v is larger than the file", c)
+		}
+		block := data[offset+8 : offset+8+size]
+
+		count := min(lines, height-y)
+		if y < 0 || count <= 0 {
+			return nil, fmt.Errorf("chunk %v has the invalid y coordinate %v", c, y+window.Min.Y)
+		}
+
+		// compressed blocks that are not smaller are stored uncompressed
+		if compression != 0 && len(block) < count*lineSize {
+			block, err = zipDecompress(block)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if len(block) < count*lineSize {
+			return nil, fmt.Errorf("chunk %v is %v bytes, expected %v bytes", c, len(block), count*lineSize)
+		}
+
+		for line := 0; line < count; line++ {
+			setLine(base, block[line*lineSize:(line+1)*lineSize], channels, y+line)
+		}
+	}
+
+	return img, nil
+}
+
+// nullString returns the null terminated string starting
+// at pos and the position after the terminator.
+func nullString(data []byte, pos int) (string, int, error) {
+	end := bytes.IndexByte(data[min(pos, len(data)):], terminator)
+	if end < 0 {
+		return "", 0, fmt.Errorf("unexpected end of the exr headers")
+	}
+
+	return string(data[pos : pos+end]), pos + end + 1, nil
+}
+
+// channelList decodes the channel list header
+func channelList(value []byte) ([]channel, error) {
+	var channels []channel
+	pos := 0
+	for pos < len(value) && value[pos] != terminator {
+		name, next, err := nullString(value, pos)
+		if err != nil {
+			return nil, err
+		}
+		if next+16 > len(value) {
+			return nil, fmt.Errorf("invalid channel list")
+		}
+
+		pixelType := binary.LittleEndian.Uint32(value[next:])
+		if pixelType > 2 {
+			return nil, fmt.Errorf("the channel %s has an unknown pixel type %v", name, pixelType)
+		}
+		channels = append(channels, channel{name: name, pixelType: pixelType})
+		pos = next + 16
+	}
+
+	// the data is always stored in alphabetical order
+	sort.Slice(channels, func(i, j int) bool { return channels[i].name < channels[j].name })
+
+	return channels, nil
+}
+
+// chromaticitySpace returns the colour space
+// that matches the chromaticities.
+func chromaticitySpace(points [8]float32) colour.ColorSpace {
+	for _, p := range primaries {
+		match := true
+		for i, v := range p.points {
+			if math.Abs(float64(v-points[i])) > 0.005 {
+				match = false
+				break
+			}
+		}
+
+		if match {
+			return p.space
+		}
+	}
+
+	return colour.ColorSpace{}
+}
+
+// zipDecompress reverses zipCompress
+func zipDecompress(block []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(block))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	reordered, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	// undo the difference between each byte
+	for i := 1; i < len(reordered); i++ {
+		reordered[i] = byte(int(reordered[i-1]) + int(reordered[i]) - 128)
+	}
+
+	// interleave the even and odd bytes
+	out := make([]byte, len(reordered))
+	half := (len(out) + 1) / 2
+	for i := range out {
+		if i%2 == 0 {
+			out[i] = reordered[i/2]
+		} else {
+			out[i] = reordered[half+i/2]
+		}
+	}
+
+	return out, nil
+}
+
+// setLine sets the pixels of line y from the values
+// of each channel.
+func setLine(img *image.NRGBA64, line []byte, channels []channel, y int) {
+	width := img.Bounds().Dx()
+	pos := 0
+	for _, c := range channels {
+		// the position of the channel in the pixel
+		var pix int
+		switch c.name {
+		case "R":
+			pix = 0
+		case "G":
+			pix = 2
+		case "B":
+			pix = 4
+		case "A":
+			pix = 6
+		default:
+			// skip any other channels
+			pos += width * c.size()
+			continue
+		}
+
+		for x := 0; x < width; x++ {
+			var v float64
+			switch c.pixelType {
+			case 0:
+				// unsigned ints are scaled from their full range
+				v = float64(binary.LittleEndian.Uint32(line[pos:])) / math.MaxUint32
+			case 1:
+				v = float64(float16.Frombits(binary.LittleEndian.Uint16(line[pos:])).Float32())
+			case 2:
+				v = float64(math.Float32frombits(binary.LittleEndian.Uint32(line[pos:])))
+			}
+			pos += c.size()
+			if math.IsNaN(v) {
+				v = 0
+			}
+
+			v16 := uint16(math.Round(math.Max(0, math.Min(1, v)) * 0xffff))
+			i := img.PixOffset(x, y) + pix
+			img.Pix[i], img.Pix[i+1] = byte(v16>>8), byte(v16)
+		}
+	}
+}
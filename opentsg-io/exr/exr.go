@@ -2,6 +2,7 @@ package exr
 
 import (
 	"bytes"
+	"compress/zlib"
 	"encoding/binary"
 	"fmt"
 	"image"
@@ -22,7 +23,78 @@ var (
 	magic = []byte{0x76, 0x2F, 0x31, 0x01}
 )
 
+// Options are the encoding options for an exr file
+type Options struct {
+	// Compression is the compression of the file, either
+	// "none" (the default), "zips" for single scan line zip
+	// compression or "zip" for 16 scan line zip compression.
+	Compression string
+	// PixelType is the type of the channel values, either
+	// "half" (the default) for 16 bit floats or "float" for 32 bit floats.
+	PixelType string
+}
+
+const (
+	CompressionNone = "none"
+	CompressionZIPS = "zips"
+	CompressionZIP  = "zip"
+
+	PixelHalf  = "half"
+	PixelFloat = "float"
+)
+
+// compressionCodes are the exr header values
+// and the scan lines per block of each compression
+var compressionCodes = map[string]struct {
+	code  byte
+	lines int
+}{
+	"":              {0, 1},
+	CompressionNone: {0, 1},
+	CompressionZIPS: {2, 1},
+	CompressionZIP:  {3, 16},
+}
+
+// Encode writes the image as an uncompressed half float exr file.
 func Encode(w io.Writer, in image.Image) error {
+	return EncodeWithOptions(w, in, nil)
+}
+
+// EncodeWithOptions writes the image as an exr file, with the
+// compression and pixel type of the options. If options is nil
+// then an uncompressed half float exr file is saved.
+func EncodeWithOptions(w io.Writer, in image.Image, options *Options) error {
+	if options == nil {
+		options = &Options{}
+	}
+
+	compression, ok := compressionCodes[options.Compression]
+	if !ok {
+		return fmt.Errorf("unknown compression \"%s\" only \"%s\", \"%s\" and \"%s\" are available", options.Compression, CompressionNone, CompressionZIPS, CompressionZIP)
+	}
+
+	// the exr pixel type and the bytes per value
+	pixelType, valueSize := uint32(1), 2
+	switch options.PixelType {
+	case "", PixelHalf:
+	case PixelFloat:
+		pixelType, valueSize = 2, 4
+	default:
+		return fmt.Errorf("unknown pixel type \"%s\" only \"%s\" and \"%s\" are available", options.PixelType, PixelHalf, PixelFloat)
+	}
+
+	var pixels func(x, y int) [4]float32
+	switch dst := in.(type) {
+	case *image.NRGBA64:
+		pixels = nrgba64Values(dst)
+	case *colour.ARGBA:
+		pixels = argbaValues(dst)
+	case *colour.NRGBAF32:
+		pixels = floatValues(dst)
+	default:
+		return fmt.Errorf("image of unkown type only images of type *image.NRGBA64, *colour.ARGBA and *colour.NRGBAF32 can be saved")
+	}
+
 	b := in.Bounds().Max
 	// open exr are little endian
 	dir := binary.LittleEndian
@@ -54,9 +126,9 @@ func Encode(w io.Writer, in image.Image) error {
 		pos := i * 18
 		chans[pos] = byte(c)
 		chans[pos+1] = byte(terminator)
-		// 0 for uint32 bit and unsigned char and resrved
-		// is 1 as we are using linear data
-		dir.PutUint64(chans[pos+2:pos+10:pos+10], uint64(1))
+		// the pixel type then 0 for the
+		// linear and reserved values
+		dir.PutUint64(chans[pos+2:pos+10:pos+10], uint64(pixelType))
 		dir.PutUint32(chans[pos+10:pos+14:pos+14], 1)
 		dir.PutUint32(chans[pos+14:pos+18:pos+18], 1)
 	}
@@ -80,7 +152,7 @@ func Encode(w io.Writer, in image.Image) error {
 	// list of headers to be used for the exr file
 	heads := []headers{
 		{"channels", "chlist", chans},
-		{"compression", "compression", []byte{0x00}},
+		{"compression", "compression", []byte{compression.code}},
 		{"chromaticities", "chromaticities", chromacities},
 		{"dataWindow", "box2i", window},
 		{"displayWindow", "box2i", window},
@@ -106,126 +178,173 @@ func Encode(w io.Writer, in image.Image) error {
 	head = append(head, buf.Bytes()...)
 	head = append(head, byte(terminator)) // add the terminator to signal end of the headers
 
-	offset := uint64(len(head) + b.Y*(8))
-
-	dataSize := len(channels) * 2 // each channel has 2 bytes for 16 bit floats
+	// generate each block of scan lines
+	lineLength := b.X * len(channels) * valueSize
+	blocks := make([][]byte, 0, b.Y/compression.lines+1)
+	for y := 0; y < b.Y; y += compression.lines {
+		end := min(y+compression.lines, b.Y)
+		block := make([]byte, 0, (end-y)*lineLength)
+		for line := y; line < end; line++ {
+			block = append(block, scanLine(pixels, line, b.X, alpha, valueSize)...)
+		}
 
-	lineLength := uint64(b.X * dataSize)
+		if compression.code != 0 {
+			var err error
+			block, err = zipCompress(block)
+			if err != nil {
+				return err
+			}
+		}
+		blocks = append(blocks, block)
+	}
 
-	// first 8 is num then next
-	step := 8 + lineLength // bytes + len per y
-	// add the offset for each y line
-	for y := uint64(0); int(y) < b.Y; y++ {
-		head = append(head, dir.AppendUint64([]byte{}, step*y+offset)...)
+	// add the offset for each block, after the
+	// headers and offset table
+	offset := uint64(len(head) + len(blocks)*8)
+	for _, block := range blocks {
+		head = append(head, dir.AppendUint64([]byte{}, offset)...)
+		// first 8 is the y position and the data length
+		offset += uint64(8 + len(block))
 	}
 
 	// write the header
-	w.Write(head)
+	if _, err := w.Write(head); err != nil {
+		return err
+	}
 
-	pixSize := uint32(dataSize) * uint32(b.X)
+	// write the image bytes
+	var body bytes.Buffer
+	for i, block := range blocks {
+		// write the y pos and data length
+		body.Write(dir.AppendUint32([]byte{}, uint32(i*compression.lines)))
+		body.Write(dir.AppendUint32([]byte{}, uint32(len(block))))
+		body.Write(block)
+	}
 
-	var data []byte
-	switch dst := in.(type) {
-	case *image.NRGBA64:
+	_, err := w.Write(body.Bytes())
 
-		data = saveNRGBA64(dst, pixSize, alpha)
-	case *colour.ARGBA:
+	return err
+}
 
-		data = saveARGBA128(dst, pixSize, alpha)
-	default:
-		return fmt.Errorf("image of unkown type only images of type *image.NRGBA64 and *colour.ARGBA can be saved")
+// scanLine returns the bytes of a line of the image, with
+// each channel written consecutively in alphabetical order.
+func scanLine(pixels func(x, y int) [4]float32, y, width int, alpha bool, valueSize int) []byte {
+	dir := binary.LittleEndian
+	// the channels in order of r, g, b, a
+	chans := make([][]byte, 4)
+	for i := range chans {
+		chans[i] = make([]byte, width*valueSize)
 	}
 
-	// write the image bytes
-	w.Write(data)
+	for x := 0; x < width; x++ {
+		vals := pixels(x, y)
+		pos := x * valueSize
+		for i, v := range vals {
+			if valueSize == 4 {
+				dir.PutUint32(chans[i][pos:pos+4:pos+4], math.Float32bits(v))
+			} else {
+				dir.PutUint16(chans[i][pos:pos+2:pos+2], float16.Fromfloat32(v).Bits())
+			}
+		}
+	}
 
-	return nil
+	line := make([]byte, 0, width*valueSize*4)
+	if alpha {
+		line = append(line, chans[3]...)
+	}
 
-}
+	line = append(line, chans[2]...)
+	line = append(line, chans[1]...)
 
-type headers struct {
-	name    string
-	dataTag string
-	data    []byte
+	return append(line, chans[0]...)
 }
 
-func saveNRGBA64(base *image.NRGBA64, pixSize uint32, alpha bool) []byte {
-	dir := binary.LittleEndian
-	b := base.Bounds().Max
-	var body bytes.Buffer
+// zipCompress compresses a block with the exr zip method.
+// If the compressed data is not smaller the block is returned uncompressed,
+// as the exr specification requires.
+func zipCompress(block []byte) ([]byte, error) {
+	// split the bytes into the even then odd bytes
+	reordered := make([]byte, len(block))
+	half := (len(block) + 1) / 2
+	for i, b := range block {
+		if i%2 == 0 {
+			reordered[i/2] = b
+		} else {
+			reordered[half+i/2] = b
+		}
+	}
 
-	s := base.Stride
-	for y := uint32(0); int(y) < b.Y; y++ {
-		// write the y pos and data length
-		body.Write(dir.AppendUint32([]byte{}, y))
-		body.Write(dir.AppendUint32([]byte{}, pixSize))
-		pixLine := base.Pix[int(y)*s : int(y)*s+s : int(y)*s+s]
-		r := make([]byte, b.X*2)
-		g := make([]byte, b.X*2)
-		bc := make([]byte, b.X*2)
-		a := make([]byte, b.X*2)
-		for i := 0; i < len(pixLine); i += 8 {
-			// make all uint16 from floats etc
-
-			rF := float16.Fromfloat32(float32(uint16(pixLine[i])<<8|uint16(pixLine[i+1])) / 65535)
-			gF := float16.Fromfloat32(float32(uint16(pixLine[i+2])<<8|uint16(pixLine[i+3])) / 65535)
-			bF := float16.Fromfloat32(float32(uint16(pixLine[i+4])<<8|uint16(pixLine[i+5])) / 65535)
-			aF := float16.Fromfloat32(float32(uint16(pixLine[i+6])<<8|uint16(pixLine[i+7])) / 65535)
-			// add the colour to their respective channel
-			pos := (i / 8)
-			dir.PutUint16(r[pos*2:pos*2+2:pos*2+2], rF.Bits())
-			dir.PutUint16(bc[pos*2:pos*2+2:pos*2+2], bF.Bits())
-			dir.PutUint16(g[pos*2:pos*2+2:pos*2+2], gF.Bits())
-			dir.PutUint16(a[pos*2:pos*2+2:pos*2+2], aF.Bits())
+	// then store the difference between each byte
+	prev := 0
+	if len(reordered) > 0 {
+		prev = int(reordered[0])
+	}
+	for i := 1; i < len(reordered); i++ {
+		cur := int(reordered[i])
+		reordered[i] = byte(cur - prev + 128 + 256)
+		prev = cur
+	}
 
-		}
-		if alpha {
-			body.Write(a)
-		}
-		body.Write(bc)
-		body.Write(g)
-		body.Write(r)
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(reordered); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
 	}
 
-	return body.Bytes()
+	if compressed.Len() >= len(block) {
+		return block, nil
+	}
+
+	return compressed.Bytes(), nil
 }
 
-func saveARGBA128(base *colour.ARGBA, pixSize uint32, alpha bool) []byte {
-	dir := binary.LittleEndian
-	b := base.Bounds().Max
-	var body bytes.Buffer
+// nrgba64Values returns the normalised float values of the image.
+func nrgba64Values(base *image.NRGBA64) func(x, y int) [4]float32 {
+	return func(x, y int) [4]float32 {
+		i := base.PixOffset(x, y)
+		pix := base.Pix[i : i+8 : i+8]
+
+		return [4]float32{
+			float32(uint16(pix[0])<<8|uint16(pix[1])) / 65535,
+			float32(uint16(pix[2])<<8|uint16(pix[3])) / 65535,
+			float32(uint16(pix[4])<<8|uint16(pix[5])) / 65535,
+			float32(uint16(pix[6])<<8|uint16(pix[7])) / 65535,
+		}
+	}
+}
 
-	s := base.Stride
-	for y := uint32(0); int(y) < b.Y; y++ {
-		// write the y pos and data length
-		body.Write(dir.AppendUint32([]byte{}, y))
-		body.Write(dir.AppendUint32([]byte{}, pixSize))
-		pixLine := base.Pix[int(y)*s : int(y)*s+s : int(y)*s+s]
-		r := make([]byte, b.X*2)
-		g := make([]byte, b.X*2)
-		bc := make([]byte, b.X*2)
-		a := make([]byte, b.X*2)
-		for i := 0; i < len(pixLine); i += 16 {
-			// make all half floats from the bits
-			rF := float16.Fromfloat32(math.Float32frombits((uint32(pixLine[i])<<24 | uint32(pixLine[i+1])<<16 | uint32(pixLine[i+2])<<8 | uint32(pixLine[i+3]))) / 65535)
-			gF := float16.Fromfloat32(math.Float32frombits((uint32(pixLine[i+4])<<24 | uint32(pixLine[i+5])<<16 | uint32(pixLine[i+6])<<8 | uint32(pixLine[i+7]))) / 65535)
-			bF := float16.Fromfloat32(math.Float32frombits((uint32(pixLine[i+8])<<24 | uint32(pixLine[i+9])<<16 | uint32(pixLine[i+10])<<8 | uint32(pixLine[i+11]))) / 65535)
-			aF := float16.Fromfloat32(math.Float32frombits((uint32(pixLine[i+12])<<24 | uint32(pixLine[i+13])<<16 | uint32(pixLine[i+14])<<8 | uint32(pixLine[i+15]))) / 65535)
-			// add them to their respective channels
-			pos := (i / 16)
-			dir.PutUint16(r[pos*2:pos*2+2:pos*2+2], rF.Bits())
-			dir.PutUint16(bc[pos*2:pos*2+2:pos*2+2], bF.Bits())
-			dir.PutUint16(g[pos*2:pos*2+2:pos*2+2], gF.Bits())
-			dir.PutUint16(a[pos*2:pos*2+2:pos*2+2], aF.Bits())
+// argbaValues returns the normalised float values of the image.
+func argbaValues(base *colour.ARGBA) func(x, y int) [4]float32 {
+	return func(x, y int) [4]float32 {
+		i := base.PixOffset(x, y)
+		pix := base.Pix[i : i+16 : i+16]
 
+		var vals [4]float32
+		for c := range vals {
+			p := pix[c*4 : c*4+4 : c*4+4]
+			vals[c] = math.Float32frombits(uint32(p[0])<<24|uint32(p[1])<<16|uint32(p[2])<<8|uint32(p[3])) / 65535
 		}
-		if alpha {
-			body.Write(a)
-		}
-		body.Write(bc)
-		body.Write(g)
-		body.Write(r)
+
+		return vals
 	}
+}
+
+// floatValues returns the float values of the image,
+// without clipping them.
+func floatValues(base *colour.NRGBAF32) func(x, y int) [4]float32 {
+	return func(x, y int) [4]float32 {
+		i := base.PixOffset(x, y)
+		pix := base.Pix[i : i+4 : i+4]
+
+		return [4]float32{pix[0], pix[1], pix[2], pix[3]}
+	}
+}
 
-	return body.Bytes()
+type headers struct {
+	name    string
+	dataTag string
+	data    []byte
 }
@@ -2,10 +2,14 @@ package exr
 
 import (
 	"bytes"
+	"compress/zlib"
 	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 	"image"
 	"image/color"
+	"io"
+	"math"
 	"os"
 	"testing"
 
@@ -104,3 +108,132 @@ func TestACESWrite(t *testing.T) {
 	}
 
 }
+
+func TestZipCompression(t *testing.T) {
+
+	// a block of repeating data that compresses
+	block := make([]byte, 4000)
+	for i := range block {
+		block[i] = byte(i % 7)
+	}
+
+	compressed, err := zipCompress(block)
+
+	// undo the compression steps
+	zr, zErr := zlib.NewReader(bytes.NewReader(compressed))
+	predicted, _ := io.ReadAll(zr)
+	for i := 1; i < len(predicted); i++ {
+		predicted[i] = byte(int(predicted[i-1]) + int(predicted[i]) - 128)
+	}
+	decoded := make([]byte, len(predicted))
+	half := (len(predicted) + 1) / 2
+	for i := range decoded {
+		if i%2 == 0 {
+			decoded[i] = predicted[i/2]
+		} else {
+			decoded[i] = predicted[half+i/2]
+		}
+	}
+
+	var float bytes.Buffer
+	floatErr := EncodeWithOptions(&float, image.NewNRGBA64(image.Rect(0, 0, 10, 10)), &Options{PixelType: PixelFloat, Compression: CompressionZIPS})
+	badErr := EncodeWithOptions(&float, image.NewNRGBA64(image.Rect(0, 0, 10, 10)), &Options{Compression: "piz"})
+
+	Convey("Checking the zip compression can be reversed", t, func() {
+		Convey("using a block of 4000 repeating bytes", func() {
+			Convey("the decompressed block matches the original block", func() {
+				So(err, ShouldBeNil)
+				So(zErr, ShouldBeNil)
+				So(len(compressed), ShouldBeLessThan, len(block))
+				So(decoded, ShouldResemble, block)
+				So(floatErr, ShouldBeNil)
+				So(badErr, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestDecode(t *testing.T) {
+
+	// 20 lines so the zip blocks have a partial final block
+	base := image.NewNRGBA64(image.Rect(0, 0, 7, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 7; x++ {
+			base.Set(x, y, color.NRGBA64{R: uint16(x * 9000), G: uint16(y * 3000), B: 0x8000, A: uint16(0xffff - y*100)})
+		}
+	}
+
+	options := []*Options{nil, {Compression: CompressionZIPS}, {Compression: CompressionZIP, PixelType: PixelFloat}}
+
+	for _, opt := range options {
+		var buf bytes.Buffer
+		encErr := EncodeWithOptions(&buf, base, opt)
+		decoded, decErr := Decode(&buf)
+
+		// the largest difference between the decoded
+		// image and the original
+		var diff int
+		if decErr == nil {
+			for y := 0; y < 20; y++ {
+				for x := 0; x < 7; x++ {
+					want := base.NRGBA64At(x, y)
+					got := decoded.BaseImage().NRGBA64At(x, y)
+					for _, d := range []int{int(want.R) - int(got.R), int(want.G) - int(got.G), int(want.B) - int(got.B), int(want.A) - int(got.A)} {
+						diff = max(diff, d, -d)
+					}
+				}
+			}
+		}
+
+		Convey("Checking exr files can be decoded", t, func() {
+			Convey(fmt.Sprintf("using a file saved with the options %+v", opt), func() {
+				Convey("the decoded image matches the original to the precision of a half float and is rec709", func() {
+					So(encErr, ShouldBeNil)
+					So(decErr, ShouldBeNil)
+					So(decoded.Bounds(), ShouldResemble, base.Bounds())
+					So(decoded.Space(), ShouldResemble, colour.ColorSpace{ColorSpace: "rec709"})
+					So(diff, ShouldBeLessThan, 64)
+				})
+			})
+		})
+	}
+
+	_, badErr := Decode(bytes.NewReader([]byte("not an exr file")))
+
+	Convey("Checking invalid exr files are not decoded", t, func() {
+		Convey("using a text file", func() {
+			Convey("an error is returned", func() {
+				So(badErr, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestFloatWrite(t *testing.T) {
+
+	base := colour.NewNRGBAF32(colour.ColorSpace{}, image.Rect(0, 0, 3, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			base.Set(x, y, &colour.CNRGBAF32{R: 2.5, G: -0.5, B: 0.25, A: 1})
+		}
+	}
+
+	var buf bytes.Buffer
+	encErr := EncodeWithOptions(&buf, base, &Options{PixelType: PixelFloat})
+
+	// the little endian bytes of each float value
+	floatBytes := func(v float32) []byte {
+		return binary.LittleEndian.AppendUint32(nil, math.Float32bits(v))
+	}
+
+	Convey("Checking float images are saved without clipping", t, func() {
+		Convey("using an image with values above 1 and below 0, saved as 32 bit floats", func() {
+			Convey("the original float values are written to the file", func() {
+				So(encErr, ShouldBeNil)
+				So(bytes.Contains(buf.Bytes(), bytes.Repeat(floatBytes(2.5), 3)), ShouldBeTrue)
+				So(bytes.Contains(buf.Bytes(), bytes.Repeat(floatBytes(-0.5), 3)), ShouldBeTrue)
+				So(bytes.Contains(buf.Bytes(), bytes.Repeat(floatBytes(0.25), 3)), ShouldBeTrue)
+			})
+		})
+	})
+}
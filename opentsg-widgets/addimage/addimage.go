@@ -2,25 +2,19 @@
 package addimage
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
 	"image"
 	"image/draw"
-	"image/png"
-	"io"
 	"math"
 	"os"
 	"path/filepath"
-	"reflect"
-	"regexp"
 	"strings"
 
 	"github.com/mrmxf/opentsg-modules/opentsg-core/colour"
+	"github.com/mrmxf/opentsg-modules/opentsg-core/credentials"
 	"github.com/mrmxf/opentsg-modules/opentsg-core/tsg"
 
 	"github.com/nfnt/resize"
-	"golang.org/x/image/tiff"
 )
 
 const (
@@ -36,30 +30,44 @@ func (c Config) Handle(resp tsg.Response, req *tsg.Request) {
 
 	wDir := req.FrameProperties.WorkingDir
 	// Just check if it's a website first
-	webBytes, errOpen := req.SearchWithCredentials(req.Context, filename)
-	var newImage image.Image
-	var err error
-	var depth int
+	imgBytes, errOpen := req.SearchWithCredentials(req.Context, filename)
+	name := filename
 	// Open a local file next if not
 	if errOpen != nil {
+		// pinned images are never replaced by a local file
+		if _, pin := credentials.SplitPin(filename); pin != "" {
+			resp.Write(tsg.WidgetError, fmt.Sprintf("0162 %v", errOpen))
+			return
+		}
 
-		file, errOpen := os.Open(filepath.Join(wDir, filename))
+		name = filepath.Join(wDir, filename)
+		imgBytes, errOpen = os.ReadFile(name)
 		if errOpen != nil {
 			resp.Write(tsg.WidgetError, errOpen.Error())
 			return
 		}
-		newImage, depth, err = fToImg(file, file.Name())
-	} else {
-		bufRead := bytes.NewReader(webBytes)
-		name := strings.Split(filename, "/")
-		newImage, depth, err = fToImg(bufRead, name[len(name)-1])
 	}
 
+	decoded, err := req.DecodeImage(name, imgBytes)
 	if err != nil {
-		resp.Write(tsg.WidgetError, err.Error())
+		resp.Write(tsg.WidgetError, fmt.Sprintf("0163 %v", err))
 		return
 	}
 
+	// use the image underneath the colour space
+	// so the resizer can use the pixels directly
+	var newImage image.Image = decoded
+	if nrgba, ok := decoded.(*colour.NRGBA64); ok {
+		newImage = nrgba.BaseImage()
+	}
+
+	// images without a colour space are treated
+	// as the colour space of the widget
+	space := decoded.Space()
+	if (space == colour.ColorSpace{}) {
+		space = req.PatchProperties.ColourSpace
+	}
+
 	var extraX, extraY int
 	// stretch the image if required
 	if c.ImgFill != "preserve" {
@@ -84,7 +92,7 @@ func (c Config) Handle(resp tsg.Response, req *tsg.Request) {
 		extraY = (resp.BaseImage().Bounds().Dy() - newImage.Bounds().Dy()) / 2
 	}
 
-	newImg64 := colour.NewNRGBA64(req.PatchProperties.ColourSpace, newImage.Bounds())
+	newImg64 := colour.NewNRGBA64(space, newImage.Bounds())
 
 	imgOffset, err := c.CalcOffset(resp.BaseImage().Bounds().Max)
 	imgOffset = imgOffset.Add(image.Point{X: extraX, Y: extraY})
@@ -94,21 +102,7 @@ func (c Config) Handle(resp tsg.Response, req *tsg.Request) {
 		resp.Write(tsg.WidgetError, fmt.Sprintf("0DEV error extracting the image offset %v", err))
 	}
 
-	if depth == 8 {
-		b := newImg64.Bounds().Max
-		for x := 0; x < b.X; x++ {
-			for y := 0; y < b.Y; y++ {
-				got := newImage.At(x, y)
-
-				// fullDepth := colourgen.ConvertNRGBA64(got)
-
-				newImg64.Set(x, y, got) // fullDepth)
-
-			}
-		}
-	} else {
-		colour.Draw(newImg64, newImg64.Bounds(), newImage, image.Point{}, draw.Over)
-	}
+	colour.Draw(newImg64, newImg64.Bounds(), newImage, image.Point{}, draw.Over)
 
 	// draw.Src ensures the colourspace transformations are kept
 	// as long as the picture has no alpha
@@ -117,142 +111,6 @@ func (c Config) Handle(resp tsg.Response, req *tsg.Request) {
 	resp.Write(tsg.WidgetSuccess, "success")
 }
 
-func fToImg(file io.Reader, fname string) (img image.Image, depth int, err error) {
-
-	regTIFF := regexp.MustCompile(`^[\w\W]{1,255}\.[tT][iI][fF]{1,2}$`)
-	regPNG := regexp.MustCompile(`^[\w\W]{1,255}\.[pP][nN][gG]$`)
-	// var img image.Image
-	// Add checks to ensure 16 bit for png and tiffs
-	switch {
-	case regPNG.MatchString(fname):
-		buf := &bytes.Buffer{} // Get a copy of the reader for both functions
-		tee := io.TeeReader(file, buf)
-		depth, err = pngFence(fname, tee)
-
-		if err != nil {
-			return
-		}
-
-		img, err = png.Decode(buf)
-
-	case regTIFF.MatchString(fname):
-		buf := &bytes.Buffer{}
-		tee := io.TeeReader(file, buf)
-		depth, err = tiffFence(fname, tee)
-		if err != nil {
-			return
-		}
-		img, err = tiff.Decode(buf)
-	default:
-		err = fmt.Errorf("0163 %s is an invalid file type", fname)
-
-	}
-	if err != nil {
-		if err.Error()[:4] != "0163" {
-			err = fmt.Errorf("0167 %v", err)
-		}
-	}
-
-	return
-}
-
-// 16 bit checker for png and tiff
-
-func pngFence(fname string, file io.Reader) (int, error) {
-
-	f, _ := io.ReadAll(file)
-	// Knock through 8byte header magic number
-	// Byte 16 has the required information
-	magicNum := []byte{137, 80, 78, 71, 13, 10, 26, 10}
-	if len(f) < 25 {
-		return 0, fmt.Errorf("0164 file too small")
-	}
-	if !reflect.DeepEqual(f[0:8], magicNum) {
-		return 0, fmt.Errorf("0165 %s is an invalid PNG file", fname)
-	}
-	if f[24] != 16 && f[24] != 8 {
-		return 0, fmt.Errorf("0166 %s colour depth is %v bits not 8/16 bits. Only 8/16 bit files are accepted", fname, f[24])
-	}
-
-	return int(f[24]), nil
-}
-
-func tiffFence(fname string, file io.Reader) (int, error) {
-	// Get the file infortmation
-	f, _ := io.ReadAll(file)
-	var order binary.ByteOrder
-	if len(f) < 24 {
-		return 0, fmt.Errorf("0164 file too small")
-	}
-	// Establish if little endian or big endian
-	switch string(f[:2]) {
-	case "II":
-		order = binary.LittleEndian
-	case "MM":
-		order = binary.BigEndian
-	default:
-		// Blow the doors off if they somehow made it this far
-
-		return 0, fmt.Errorf("0165 %s is an invalid TIFF file", fname)
-	}
-
-	// Check magic number to show it really is a tiff file
-	magic := getUint16(f[2:4], order)
-	if magic != 42 {
-		// Blow the doors off if they somehow made it this far
-		return 0, fmt.Errorf("0165 %s is an invalid TIFF file", fname)
-	}
-
-	// Find the offset of the ifd header
-	ifdOff := getUint32(f[4:8], order)
-
-	// Find how many directories there are
-	ifdNum := getUint16(f[ifdOff:ifdOff+2], order)
-
-	// Offset by 2 as the first 2 are a directory
-	ifdOff += 2
-	var cdepth uint16
-	for i := 0; i < int(ifdNum); i++ {
-		// Check the tag of the ifd
-		tag := getUint16(f[ifdOff+uint32(12*i):ifdOff+uint32(12*i)+2], order)
-		// Fmt.Println(tag)
-
-		if tag == 258 {
-			// Find how many
-			ccount := getUint32(f[ifdOff+uint32(12*i)+4:ifdOff+uint32(12*i)+8], order)
-			// Where are the colour
-			cOff := getUint32(f[ifdOff+uint32(12*i)+8:ifdOff+uint32(12*i)+12], order)
-
-			for i := 0; i < int(ccount); i++ {
-				cdepth = getUint16(f[cOff+uint32(2*i):cOff+uint32(2*i)+2], order)
-
-				if cdepth != 16 && cdepth != 8 {
-
-					return 0, fmt.Errorf("0166 %s colour depth is %v bits not 16 bits. Only 16 bit files are accepted", fname, cdepth)
-				}
-			}
-		}
-	}
-
-	return int(cdepth), nil
-}
-
-func getUint16(b []byte, order binary.ByteOrder) uint16 {
-	var byteNum uint16
-	bufMag := bytes.NewReader(b)
-	_ = binary.Read(bufMag, order, &byteNum)
-
-	return byteNum
-}
-
-func getUint32(b []byte, order binary.ByteOrder) uint32 {
-	var byteNum uint32
-	bufMag := bytes.NewReader(b)
-	_ = binary.Read(bufMag, order, &byteNum)
-
-	return byteNum
-}
-
 func resizeParams(resizeType string, original, target image.Point) (int, int) {
 	// Break up the types here
 	switch strings.ToLower(resizeType) {
@@ -6,15 +6,22 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
 	"image/png"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"runtime/debug"
+	"strings"
 	"testing"
 
 	"github.com/mrmxf/opentsg-modules/opentsg-core/colour"
 	"github.com/mrmxf/opentsg-modules/opentsg-core/config"
+	"github.com/mrmxf/opentsg-modules/opentsg-core/credentials"
 	"github.com/mrmxf/opentsg-modules/opentsg-core/tsg"
+	"github.com/mrmxf/opentsg-modules/opentsg-io/dpx"
 	examplejson "github.com/mrmxf/opentsg-modules/opentsg-widgets/exampleJson"
 	"github.com/mrmxf/opentsg-modules/opentsg-widgets/utils/parameters"
 	. "github.com/smartystreets/goconvey/convey"
@@ -64,8 +71,8 @@ func Test16files(t *testing.T) {
 	goodString := []string{"./testdata/test16bit.tiff", "./testdata/test16bit.png"}
 
 	for _, name := range goodString {
-		tfile, _ := os.Open(name)
-		_, _, genErr := fToImg(tfile, name)
+		tfile, _ := os.ReadFile(name)
+		_, genErr := tsg.Request{}.DecodeImage(name, tfile)
 
 		Convey("Checking that 16 bit files get through the fence", t, func() {
 			Convey(fmt.Sprintf("using a %s as the file to open", name), func() {
@@ -83,8 +90,8 @@ func Test8files(t *testing.T) {
 	good8String := []string{"./testdata/test8bit.png", "./testdata/test8bit.tiff", "./testdata/squares.png"}
 
 	for _, name := range good8String {
-		tfile, _ := os.Open(name)
-		_, _, genErr := fToImg(tfile, name)
+		tfile, _ := os.ReadFile(name)
+		_, genErr := tsg.Request{}.DecodeImage(name, tfile)
 
 		canvas := image.NewNRGBA64(image.Rect(0, 0, 1000, 1000))
 		mockImg := Config{Image: name}
@@ -323,3 +330,56 @@ func compare(base, new draw.Image) {
 
 	fmt.Println(count, "non matches")
 }
+
+func TestDecoders(t *testing.T) {
+
+	// a dpx is not a png or tiff, so is read
+	// by the decoders of the request
+	red := color.NRGBA64{R: 0xffff, G: 0x1000, A: 0xffff}
+	src := image.NewNRGBA64(image.Rect(0, 0, 100, 100))
+	draw.Draw(src, src.Bounds(), &image.Uniform{red}, image.Point{}, draw.Src)
+
+	name := filepath.Join(t.TempDir(), "red.dpx")
+	f, _ := os.Create(name)
+	encErr := dpx.Encode(f, src, nil)
+	f.Close()
+
+	canvas := image.NewNRGBA64(image.Rect(0, 0, 200, 200))
+	out := tsg.TestResponder{BaseImg: canvas}
+	Config{Image: name}.Handle(&out, &tsg.Request{})
+
+	Convey("Checking images are added with the decoders of the request", t, func() {
+		Convey("using a 16 bit dpx file", func() {
+			Convey("the dpx is scaled to fill the canvas", func() {
+				So(encErr, ShouldBeNil)
+				So(out.Status, ShouldResemble, tsg.WidgetSuccess)
+				So(canvas.NRGBA64At(150, 150), ShouldResemble, red)
+			})
+		})
+	})
+}
+
+func TestPinnedImages(t *testing.T) {
+	img, _ := os.ReadFile("./testdata/test8bit.png")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(img)
+	}))
+	defer server.Close()
+
+	sum := sha256.Sum256(img)
+	wrongPin := strings.Repeat("0", 64)
+	pinned := server.URL + "/test8bit.png" + credentials.PinFragment + wrongPin
+
+	out := tsg.TestResponder{BaseImg: image.NewNRGBA64(image.Rect(0, 0, 100, 100))}
+	Config{Image: pinned}.Handle(&out, &tsg.Request{})
+
+	Convey("Checking pinned images are not replaced when they do not match", t, func() {
+		Convey("using an image with a sha256 pin that does not match", func() {
+			Convey("the integrity error is returned", func() {
+				So(out.Status, ShouldResemble, tsg.WidgetError)
+				So(out.Message, ShouldEqual, fmt.Sprintf("0162 integrity check failed for %s/test8bit.png, expected a sha256 of %s and got %x",
+					server.URL, wrongPin, sum))
+			})
+		})
+	})
+}
@@ -55,7 +55,10 @@ func (gt Config) Handle(resp tsg.Response, req *tsg.Request) {
 			tagLines[i] = f.ID[i*int(bestLength) : end]
 		}
 		// lines := strings.Split(f.Name, " ")
-		geomBox.DrawStringsHandler(segment, req, tagLines)
+		if err := geomBox.DrawStringsHandler(segment, req, tagLines); err != nil {
+			resp.Write(tsg.WidgetError, err.Error())
+			return
+		}
 		colour.Draw(resp.BaseImage(), f.Shape, segment, image.Point{}, draw.Over)
 		// geomBox.DrawStrings(f.Shape, cont, lines)
 
@@ -9,6 +9,7 @@ import (
 	"image/draw"
 	"math"
 	"os"
+	"path/filepath"
 	"strings"
 
 	_ "embed"
@@ -17,6 +18,7 @@ import (
 	"github.com/golang/freetype/truetype"
 	"github.com/mrmxf/opentsg-modules/opentsg-core/colour"
 	"github.com/mrmxf/opentsg-modules/opentsg-core/config/core"
+	"github.com/mrmxf/opentsg-modules/opentsg-core/credentials"
 	"github.com/mrmxf/opentsg-modules/opentsg-core/tsg"
 	"golang.org/x/image/font"
 	"golang.org/x/image/math/fixed"
@@ -71,7 +73,10 @@ func (t TextboxProperties) DrawStringsHandler(canvas draw.Image, req *tsg.Reques
 	// or any text
 	if t.textColour != nil && len(labels) > 0 {
 		if t.textColour.A != 0 {
-			fontByte := fontSelectorHandler(req, t.font)
+			fontByte, err := fontSelectorHandler(req, t.font)
+			if err != nil {
+				return fmt.Errorf("0101 %v", err)
+			}
 
 			fontain, err := freetype.ParseFont(fontByte)
 			if err != nil {
@@ -196,7 +201,10 @@ func (t TextboxProperties) DrawStrings(canvas draw.Image, tsgContext *context.Co
 	// or any text
 	if t.textColour != nil && len(labels) > 0 {
 		if t.textColour.A != 0 {
-			fontByte := fontSelector(tsgContext, t.font)
+			fontByte, err := fontSelector(tsgContext, t.font)
+			if err != nil {
+				return fmt.Errorf("0101 %v", err)
+			}
 
 			fontain, err := freetype.ParseFont(fontByte)
 			if err != nil {
@@ -450,49 +458,69 @@ func yPos(canvas image.Image, rect fixed.Rectangle26_6, position string, lines f
 }
 
 // font selector enumerates through the different sources of http,
-// local files,
+// local files, local files relative to the factory,
 // then predetermined embedded fonts and returns the font based on the input string.
-func fontSelector(c *context.Context, fontLocation string) []byte {
+// Fonts pinned with a sha256 are not replaced, the error fetching them is returned.
+func fontSelector(c *context.Context, fontLocation string) ([]byte, error) {
 
 	font, err := core.GetWebBytes(c, fontLocation)
 
 	if err == nil {
-		return font
+		return font, nil
+	}
+
+	if _, pin := credentials.SplitPin(fontLocation); pin != "" {
+		return nil, err
 	}
 
 	font, err = os.ReadFile(fontLocation)
 	if err == nil {
-		return font
+		return font, nil
 	}
 
-	switch fontLocation {
-	case "title":
-		return Title
-	case "body":
-		return Body
-	case "pixel":
-		return Pixel
-	default:
-		return Header
+	// DrawString is called without a context
+	if c != nil {
+		font, err = os.ReadFile(filepath.Join(core.GetDir(*c), fontLocation))
+		if err == nil {
+			return font, nil
+		}
 	}
+
+	return embeddedFont(fontLocation), nil
 }
 
 // font selector enumerates through the different sources of http,
-// local files,
+// local files, local files relative to the factory,
 // then predetermined embedded fonts and returns the font based on the input string.
-func fontSelectorHandler(req *tsg.Request, fontLocation string) []byte {
+// Fonts pinned with a sha256 are not replaced, the error fetching them is returned.
+func fontSelectorHandler(req *tsg.Request, fontLocation string) ([]byte, error) {
 
 	font, err := req.SearchWithCredentials(req.Context, fontLocation)
 
 	if err == nil {
-		return font
+		return font, nil
+	}
+
+	if _, pin := credentials.SplitPin(fontLocation); pin != "" {
+		return nil, err
 	}
 
 	font, err = os.ReadFile(fontLocation)
 	if err == nil {
-		return font
+		return font, nil
+	}
+
+	font, err = os.ReadFile(filepath.Join(req.FrameProperties.WorkingDir, fontLocation))
+	if err == nil {
+		return font, nil
 	}
 
+	return embeddedFont(fontLocation), nil
+}
+
+// embeddedFont returns the embedded font of the name,
+// the header font is used for unknown names.
+func embeddedFont(fontLocation string) []byte {
 	switch fontLocation {
 	case "title":
 		return Title
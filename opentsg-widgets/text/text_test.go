@@ -7,10 +7,15 @@ import (
 	"image"
 	"image/draw"
 	"image/png"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/mrmxf/opentsg-modules/opentsg-core/colour"
+	"github.com/mrmxf/opentsg-modules/opentsg-core/credentials"
+	"github.com/mrmxf/opentsg-modules/opentsg-core/tsg"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -211,3 +216,32 @@ func TestVerticalText(t *testing.T) {
 		})
 	}
 }
+
+func TestPinnedFonts(t *testing.T) {
+	font, _ := os.ReadFile("./MavenPro-Bold.ttf")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(font)
+	}))
+	defer server.Close()
+
+	sum := sha256.Sum256(font)
+	wrongPin := strings.Repeat("0", 64)
+	expected := fmt.Errorf("0101 integrity check failed for %s/MavenPro-Bold.ttf, expected a sha256 of %s and got %x", server.URL, wrongPin, sum)
+
+	pinnedBox := TextboxProperties{font: server.URL + "/MavenPro-Bold.ttf" + credentials.PinFragment + wrongPin,
+		textColour: &colour.CNRGBA64{R: 194 << 8, G: 166 << 8, B: 73 << 8, A: 0xffff}}
+
+	defaultContext := context.Background()
+	base := image.NewNRGBA64(image.Rect(0, 0, 100, 100))
+	contextErr := pinnedBox.DrawStrings(base, &defaultContext, []string{"sample"})
+	handlerErr := pinnedBox.DrawStringsHandler(base, &tsg.Request{}, []string{"sample"})
+
+	Convey("Checking pinned fonts are not replaced when they do not match", t, func() {
+		Convey("using a font with a sha256 pin that does not match", func() {
+			Convey("the integrity error is returned instead of using an embedded font", func() {
+				So(contextErr, ShouldResemble, expected)
+				So(handlerErr, ShouldResemble, expected)
+			})
+		})
+	})
+}
@@ -52,6 +52,7 @@ func (tb TextboxJSON) Handle(resp tsg.Response, req *tsg.Request) {
 	err := textbox.DrawStringsHandler(c, req, tb.Text)
 	if err != nil {
 		resp.Write(tsg.WidgetError, err.Error())
+		return
 	}
 
 	// apply the text